@@ -0,0 +1,84 @@
+package main
+
+import (
+   "flag"
+   "fmt"
+   "os"
+   "path/filepath"
+   "strings"
+
+   "web-service/pkg/mesa"
+
+)
+
+
+const usage = `usage: mesa-export [options] history.data
+
+converts a MESA history (or profile) into csv, jsonl or parquet. output goes to stdout unless -o is
+given, in which case the format is also taken from its extension
+
+options:
+`
+
+
+func main() {
+
+   flag.Usage = func() {
+      fmt.Fprint(flag.CommandLine.Output(), usage)
+      flag.PrintDefaults()
+   }
+
+   format := flag.String("format", "", "output format: csv, jsonl or parquet (default csv)")
+   output := flag.String("o", "", "output file (default stdout)")
+   columns := flag.String("columns", "", "comma separated list of columns to export (default all)")
+   from := flag.Int("from", 0, "first row to export, counted from 0")
+   to := flag.Int("to", 0, "export rows before this one (default until the end)")
+   flag.Parse()
+
+   if flag.NArg() != 1 {
+      flag.Usage()
+      os.Exit(2)
+   }
+
+   // format from flag, then from output extension
+   name := *format
+   if name == "" && *output != "" {
+      name = filepath.Ext(*output)
+   }
+   exportFormat := mesa.FormatCSV
+   if name != "" {
+      var err error
+      exportFormat, err = mesa.ParseExportFormat(name)
+      if err != nil {
+         fmt.Fprintln(os.Stderr, "mesa-export:", err)
+         os.Exit(2)
+      }
+   }
+
+   opts := &mesa.ExportOptions{FirstRow: *from, LastRow: *to}
+   for _, column := range strings.Split(*columns, ",") {
+      if column = strings.TrimSpace(column); column != "" {
+         opts.Columns = append(opts.Columns, column)
+      }
+   }
+
+   out := os.Stdout
+   if *output != "" {
+      f, err := os.Create(*output)
+      if err != nil {
+         fmt.Fprintln(os.Stderr, "mesa-export:", err)
+         os.Exit(1)
+      }
+      out = f
+   }
+
+   err := mesa.ExportHistory(flag.Arg(0), out, exportFormat, opts)
+   if cerr := out.Close(); err == nil {
+      err = cerr
+   }
+   if err != nil {
+      fmt.Fprintln(os.Stderr, "mesa-export:", err)
+      os.Exit(1)
+   }
+
+}
@@ -0,0 +1,332 @@
+package mesa
+
+import (
+   "bufio"
+   "io/ioutil"
+   "math"
+   "os"
+   "path/filepath"
+   "sort"
+   "strconv"
+   "strings"
+
+   "web-service/pkg/io"
+)
+
+// bin2dco writes core-collapse results in this folder, one file per collapse
+var bin2dcoCCDirectory = "cc_data"
+
+// suffixes of files in cc_data with outcome of a core collapse
+var bin2dcoCCSuffixes = []string{".data", ".txt", ".dat"}
+
+// bin2dco names the folders of its stages with this prefix & the stage number, e.g. stage2
+var bin2dcoStagePrefixes = []string{"stage"}
+
+// struct tag used to map keys of bin2dco summary files into struct fields
+const keyTag = "key"
+
+
+// outcome of a core collapse computed by bin2dco, read from a key-value summary file
+type CoreCollapseInfo struct {
+   Filename string
+   Star int `key:"star_index"`
+   ModelNumber int `key:"model_number"`
+   Age float64 `key:"age"`
+   PreSNMass float64 `key:"pre_sn_mass"`
+   RemnantMass float64 `key:"remnant_mass"`
+   CompanionMass float64 `key:"companion_mass"`
+   KickVelocity float64 `key:"natal_kick"`
+   KickTheta float64 `key:"kick_theta"`
+   KickPhi float64 `key:"kick_phi"`
+   PostSNPeriod float64 `key:"period_post_sn"`
+   PostSNSeparation float64 `key:"separation_post_sn"`
+   PostSNEccentricity float64 `key:"eccentricity_post_sn"`
+   Disrupted bool
+   RemnantStage EvolStage
+}
+
+// a MESA run of a bin2dco simulation: the initial binary or a later star + point-mass binary
+type Bin2dcoStage struct {
+   Name string
+   Dir string
+}
+
+// a bin2dco run, with its stages in order of evolution and its core collapses
+type Bin2dcoRun struct {
+   RootDir string
+   Stages []Bin2dcoStage
+   CoreCollapses []CoreCollapseInfo
+}
+
+
+// find out if path holds a bin2dco run: either it has core-collapse results or some of its
+// subfolders are bin2dco stages, named as such & with binary output of their own
+func IsBin2dco (path string) bool {
+
+   if info, err := os.Stat(filepath.Join(path, bin2dcoCCDirectory)); err == nil && info.IsDir() {
+      return true
+   }
+
+   return len(bin2dcoStageDirs(path)) > 0
+
+}
+
+
+// subfolders of path named as bin2dco stages & holding a MESA binary run, in the order of their
+// stage number, so that stage10 comes after stage2
+func bin2dcoStageDirs (path string) []string {
+
+   entries, err := ioutil.ReadDir(path)
+   if err != nil {
+      return nil
+   }
+
+   var dirs []string
+   for _, entry := range entries {
+      if !entry.IsDir() {
+         continue
+      }
+      if prefix, number := stageNumber(entry.Name()); number < 0 || !containsString(bin2dcoStagePrefixes, prefix) {
+         continue
+      }
+      dir := filepath.Join(path, entry.Name()) + "/"
+      if IsBinary(dir) {
+         dirs = append(dirs, dir)
+      }
+   }
+   sort.SliceStable(dirs, func(i, j int) bool {
+      prefixI, numberI := stageNumber(filepath.Base(dirs[i]))
+      prefixJ, numberJ := stageNumber(filepath.Base(dirs[j]))
+      if prefixI != prefixJ || numberI == numberJ {
+         return dirs[i] < dirs[j]
+      }
+      return numberI < numberJ
+   })
+
+   return dirs
+
+}
+
+
+// name of a stage folder split in the text before its trailing number & the number, -1 if none
+func stageNumber (name string) (string, int) {
+
+   k := len(name)
+   for k > 0 && name[k-1] >= '0' && name[k-1] <= '9' {
+      k--
+   }
+
+   number, err := strconv.Atoi(name[k:])
+   if err != nil {
+      return name, -1
+   }
+
+   return name[:k], number
+
+}
+
+
+// load stages & core collapses of a bin2dco run. remnants are classified with t, nil for the defaults
+func LoadBin2dcoRun (path string, t *StageThresholds) (*Bin2dcoRun, error) {
+
+   io.LogInfo("MESA - bin2dco.go - LoadBin2dcoRun", "loading bin2dco run in " + path)
+
+   run := &Bin2dcoRun{RootDir: path}
+
+   // the run directory itself is the first stage when it has binary output
+   if IsBinary(path) {
+      run.Stages = append(run.Stages, Bin2dcoStage{Name: "binary", Dir: path})
+   }
+   for _, dir := range bin2dcoStageDirs(path) {
+      run.Stages = append(run.Stages, Bin2dcoStage{Name: filepath.Base(dir), Dir: dir})
+   }
+
+   // core collapses, in order of age
+   ccDir := filepath.Join(path, bin2dcoCCDirectory)
+   entries, err := ioutil.ReadDir(ccDir)
+   if err != nil {
+      if os.IsNotExist(err) {
+         return run, nil
+      }
+      return run, err
+   }
+
+   var errs FieldErrors
+   for _, entry := range entries {
+      if entry.IsDir() || !hasAnySuffix(entry.Name(), bin2dcoCCSuffixes) {
+         continue
+      }
+      cc, err := LoadCoreCollapse(filepath.Join(ccDir, entry.Name()), t)
+      if err != nil {
+         if fieldErrs, ok := err.(FieldErrors); ok {
+            errs = append(errs, fieldErrs...)
+         } else {
+            return run, err
+         }
+      }
+      run.CoreCollapses = append(run.CoreCollapses, *cc)
+   }
+   sort.SliceStable(run.CoreCollapses, func(i, j int) bool {
+      return run.CoreCollapses[i].Age < run.CoreCollapses[j].Age
+   })
+
+   if len(errs) > 0 {
+      return run, errs
+   }
+
+   return run, nil
+
+}
+
+
+// read outcome of a core collapse from a bin2dco summary file. values that cannot be parsed are
+// reported as FieldErrors, but the rest of the info is still returned. the remnant is classified with
+// t, nil for the defaults
+func LoadCoreCollapse (filename string, t *StageThresholds) (*CoreCollapseInfo, error) {
+
+   names, values, err := readKeyValues(filename)
+   if err != nil {
+      return nil, err
+   }
+
+   cc := &CoreCollapseInfo{Filename: filename}
+   err = assignFields(cc, keyTag, names, values)
+
+   // remnant type & whether the binary survived the explosion
+   if cc.RemnantMass > 0 {
+      cc.RemnantStage, _ = ClassifyPointMass(cc.RemnantMass, t)
+   }
+   cc.Disrupted = cc.PostSNEccentricity >= 1 || math.IsInf(cc.PostSNPeriod, 0) || cc.PostSNSeparation < 0
+   if !isKnown(cc.PostSNPeriod) {
+      cc.PostSNPeriod = 0
+   }
+   for k, name := range names {
+      if name == "disrupted" {
+         v := strings.ToLower(strings.Trim(values[k], "\"'."))
+         cc.Disrupted = v == "t" || v == "true" || v == "1" || v == "yes"
+      }
+   }
+
+   return cc, err
+
+}
+
+
+// read a file with one "name value" or "name = value" pair per line. comments start with # or !
+func readKeyValues (filename string) ([]string, []string, error) {
+
+   f, err := os.Open(filename)
+   if err != nil {
+      return nil, nil, &ParseError{File: filename, Err: err}
+   }
+   defer f.Close()
+
+   var names, values []string
+   scanner := bufio.NewScanner(f)
+
+   for scanner.Scan() {
+
+      line := scanner.Text()
+      if k := strings.IndexAny(line, "#!"); k >= 0 {
+         line = line[:k]
+      }
+      line = strings.Replace(line, "=", " ", 1)
+
+      fields := splitFields(line)
+      if len(fields) < 2 {
+         continue
+      }
+      names = append(names, strings.ToLower(fields[0]))
+      values = append(values, fields[1])
+
+   }
+
+   if err := scanner.Err(); err != nil {
+      return nil, nil, &ParseError{File: filename, Err: err}
+   }
+
+   return names, values, nil
+
+}
+
+
+func hasAnySuffix (name string, suffixes []string) bool {
+
+   for _, suffix := range suffixes {
+      if strings.HasSuffix(name, suffix) {
+         return true
+      }
+   }
+
+   return false
+
+}
+
+
+func containsString (list []string, s string) bool {
+
+   for _, item := range list {
+      if item == s {
+         return true
+      }
+   }
+
+   return false
+
+}
+
+
+// directory of the stage currently being evolved, i.e. the last one
+func (r *Bin2dcoRun) CurrentStage () *Bin2dcoStage {
+
+   if len(r.Stages) == 0 {
+      return nil
+   }
+
+   return &r.Stages[len(r.Stages)-1]
+
+}
+
+
+// binary of two compact objects left by a bin2dco run, once both stars collapsed & the binary
+// survived: remnant masses with the orbit right after the last collapse, with merger time & chirp
+// mass set. nil otherwise
+func (r *Bin2dcoRun) CompactBinary () *MESAbinaryInfo {
+
+   if len(r.CoreCollapses) < 2 {
+      return nil
+   }
+   for _, cc := range r.CoreCollapses {
+      if cc.Disrupted || cc.RemnantMass <= 0 {
+         return nil
+      }
+   }
+
+   // the companion of the last collapse is the remnant of the first one
+   first, last := r.CoreCollapses[0], r.CoreCollapses[len(r.CoreCollapses)-1]
+   companion := last.CompanionMass
+   if companion <= 0 {
+      companion = first.RemnantMass
+   }
+
+   b := &MESAbinaryInfo{
+      Star1Mass: last.RemnantMass,
+      Star2Mass: companion,
+      Period: last.PostSNPeriod,
+      Separation: last.PostSNSeparation,
+      Eccentricity: last.PostSNEccentricity,
+   }
+   if last.Star == 2 {
+      b.Star1Mass, b.Star2Mass = b.Star2Mass, b.Star1Mass
+   }
+   if b.Separation <= 0 && b.Period > 0 {
+      b.Separation = SeparationFromPeriod(b.Star1Mass, b.Star2Mass, b.Period)
+   }
+   if b.Separation <= 0 {
+      return nil
+   }
+   b.SetCompactQuantities()
+
+   return b
+
+}
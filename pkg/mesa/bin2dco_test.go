@@ -0,0 +1,138 @@
+package mesa
+
+import (
+   "errors"
+   "os"
+   "path/filepath"
+   "strings"
+   "testing"
+)
+
+
+// stages are in the order of their numbers, not of their names
+func TestBin2dcoStageDirs (t *testing.T) {
+
+   dir := t.TempDir()
+   for _, name := range []string{"stage1", "stage10", "stage2", "stage9", "LOGS1", "cc_data"} {
+      if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+         t.Fatal(err)
+      }
+      if err := os.WriteFile(filepath.Join(dir, name, "binary_history.data"), nil, 0644); err != nil {
+         t.Fatal(err)
+      }
+   }
+
+   var names []string
+   for _, stage := range bin2dcoStageDirs(dir) {
+      names = append(names, filepath.Base(stage))
+   }
+
+   if got, want := strings.Join(names, " "), "stage1 stage2 stage9 stage10"; got != want {
+      t.Errorf("got stages %q, want %q", got, want)
+   }
+
+}
+
+
+// only folders named as bin2dco stages, with binary output, or a cc_data folder make a bin2dco run
+func TestIsBin2dco (t *testing.T) {
+
+   mkdir := func(dir string, names ...string) {
+      t.Helper()
+      for _, name := range names {
+         if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+            t.Fatal(err)
+         }
+      }
+   }
+
+   cases := []struct {
+      name string
+      dirs []string
+      files []string
+      want bool
+   }{
+      {"empty run", nil, nil, false},
+      {"core collapses", []string{"cc_data"}, nil, true},
+      {"stage folders", []string{"stage1"}, []string{"stage1/binary_history.data"}, true},
+      {"stage folder without binary output", []string{"stage1"}, []string{"stage1/history.data"}, false},
+      {"other binary run inside", []string{"other_run"}, []string{"other_run/binary_history.data"}, false},
+      {"binary LOGS", []string{"LOGS1"}, []string{"LOGS1/binary_history.data"}, false},
+   }
+
+   for _, c := range cases {
+      dir := t.TempDir()
+      mkdir(dir, c.dirs...)
+      for _, name := range c.files {
+         writeFile(t, dir, name, "")
+      }
+      if got := IsBin2dco(dir + "/"); got != c.want {
+         t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+      }
+   }
+
+}
+
+
+func TestLoadCoreCollapse (t *testing.T) {
+
+   cc, err := LoadCoreCollapse("testdata/bin2dco/cc_data/star_1_at_core_collapse.data", nil)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   if cc.Star != 1 || cc.ModelNumber != 2417 || cc.Age != 6.7403417525630933e6 || cc.PreSNMass != 1.1893745220190582e1 {
+      t.Errorf("got star %d, model %d, age %g & pre-SN mass %g", cc.Star, cc.ModelNumber, cc.Age, cc.PreSNMass)
+   }
+   if cc.RemnantMass != 1.5312001094126724 || cc.RemnantStage != StageNS || cc.CompanionMass != 2.3817640127655409e1 {
+      t.Errorf("got remnant of %g (%s) & companion of %g", cc.RemnantMass, cc.RemnantStage, cc.CompanionMass)
+   }
+   if cc.KickVelocity != 2.6587322021347912e2 || cc.KickTheta != 1.9624370193481445 || cc.KickPhi != 4.1135735511779785 {
+      t.Errorf("got kick %g, theta %g & phi %g", cc.KickVelocity, cc.KickTheta, cc.KickPhi)
+   }
+   if cc.PostSNPeriod != 1.2410597503124881e1 || cc.PostSNSeparation != 5.2871364580251112e1 || cc.PostSNEccentricity != 3.4102817177619934e-1 || cc.Disrupted {
+      t.Errorf("got post-SN orbit %+v", cc)
+   }
+
+   // unbound orbits are disrupted, unparsable values reported with the rest kept
+   dir := t.TempDir()
+   filename := writeFile(t, dir, "cc.data", "star_index = 2\nremnant_mass = 8.5\neccentricity_post_sn = 1.2\nperiod_post_sn = ***\n")
+   cc, err = LoadCoreCollapse(filename, nil)
+   var fieldErrs FieldErrors
+   if !errors.As(err, &fieldErrs) || len(fieldErrs) != 1 {
+      t.Errorf("got error %v, want one field error", err)
+   }
+   if cc == nil || cc.Star != 2 || cc.RemnantStage != StageBH || !cc.Disrupted {
+      t.Errorf("got %+v", cc)
+   }
+
+}
+
+
+func TestLoadBin2dcoRun (t *testing.T) {
+
+   run, err := LoadBin2dcoRun("testdata/bin2dco/", nil)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   var names []string
+   for _, stage := range run.Stages {
+      names = append(names, stage.Name)
+   }
+   if got := strings.Join(names, " "); got != "stage1 stage2" {
+      t.Errorf("got stages %q", got)
+   }
+   if len(run.CoreCollapses) != 2 || run.CoreCollapses[0].Star != 1 || run.CoreCollapses[1].Star != 2 {
+      t.Fatalf("got core collapses %+v", run.CoreCollapses)
+   }
+   if cc := run.CoreCollapses[1]; cc.RemnantStage != StageBH || cc.Disrupted || cc.KickVelocity != 0 {
+      t.Errorf("got second core collapse %+v", cc)
+   }
+
+   b := run.CompactBinary()
+   if b == nil || b.Star1Mass != 1.5312001094126724 || b.Star2Mass != 7.8102937745312341 || b.MergerTime <= 0 {
+      t.Errorf("got compact binary %+v", b)
+   }
+
+}
@@ -0,0 +1,582 @@
+package mesa
+
+import (
+   "bufio"
+   "crypto/sha1"
+   "encoding/binary"
+   "encoding/hex"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "hash/crc32"
+   "io"
+   "io/ioutil"
+   "math"
+   "os"
+   "path/filepath"
+   "strconv"
+   "strings"
+   "sync"
+   "time"
+
+   mesaio "web-service/pkg/io"
+)
+
+
+// suffixes of the two files stored per history: metadata (json) & values (binary)
+const cacheMetaSuffix = ".json"
+const cacheDataSuffix = ".bin"
+
+// version of the cache layout, caches with another version are built again
+const cacheVersion = 1
+
+// bytes before the resume offset checked to make sure a history was only appended to
+const cacheTailBytes = 512
+
+// rows kept in memory before being appended as a new chunk
+const cacheChunkRows = 50000
+
+// once a cache has this many chunks it is rewritten as a single one
+const cacheMaxChunks = 64
+
+
+// error returned when a history changed in a way that cannot be appended to the cache
+var errCacheStale = errors.New("history changed, cache must be built again")
+
+
+// a block of rows in the data file. values are stored by column: all rows of the first column,
+// then all of the second, ... each value a little endian float64
+type cacheChunk struct {
+   Offset int64 `json:"offset"`
+   Rows int `json:"rows"`
+}
+
+
+// what is known of a cached history: source file state, where to resume reading it & chunks
+type cacheMeta struct {
+   Version int `json:"version"`
+   Path string `json:"path"`
+   Size int64 `json:"size"`
+   ModTime time.Time `json:"mod_time"`
+   Offset int64 `json:"offset"`
+   Line int `json:"line"`
+   Tail uint32 `json:"tail"`
+   Columns []string `json:"columns"`
+   Rows int `json:"rows"`
+   DataSize int64 `json:"data_size"`
+   Chunks []cacheChunk `json:"chunks"`
+}
+
+
+// cached history, guarded by its own lock so that different histories are read at the same time
+type cacheEntry struct {
+   sync.Mutex
+   meta *cacheMeta
+}
+
+
+// cache of parsed histories in a columnar binary format, keyed by path & checked against size and
+// modification time of the history. when a history grows only new rows are parsed and appended
+type HistoryCache struct {
+   Dir string
+   mu sync.Mutex
+   entries map[string]*cacheEntry
+}
+
+
+// cache stored in dir, which is created if needed
+func NewHistoryCache (dir string) (*HistoryCache, error) {
+
+   if err := os.MkdirAll(dir, 0755); err != nil {
+      return nil, err
+   }
+
+   return &HistoryCache{Dir: dir, entries: make(map[string]*cacheEntry)}, nil
+
+}
+
+
+// read metadata of every history cached in Dir. returns paths of those histories, so that they can
+// be brought up to date
+func (c *HistoryCache) Load () ([]string, error) {
+
+   files, err := filepath.Glob(filepath.Join(c.Dir, "*" + cacheMetaSuffix))
+   if err != nil {
+      return nil, err
+   }
+
+   var paths []string
+   for _, file := range files {
+      meta, err := readCacheMeta(file)
+      if err != nil || meta.Version != cacheVersion {
+         mesaio.LogInfo("MESA - cache.go - Load", "dropping unusable cache " + file)
+         c.remove(strings.TrimSuffix(file, cacheMetaSuffix))
+         continue
+      }
+      c.entry(meta.Path).meta = meta
+      paths = append(paths, meta.Path)
+   }
+
+   mesaio.LogInfo("MESA - cache.go - Load", "found " + strconv.Itoa(len(paths)) + " cached histories")
+
+   return paths, nil
+
+}
+
+
+// entry of a history, created empty when not known yet
+func (c *HistoryCache) entry (path string) *cacheEntry {
+
+   c.mu.Lock()
+   defer c.mu.Unlock()
+
+   e, ok := c.entries[path]
+   if !ok {
+      e = new(cacheEntry)
+      c.entries[path] = e
+   }
+
+   return e
+
+}
+
+
+// base name (no suffix) of the files of a cached history
+func (c *HistoryCache) base (path string) string {
+
+   sum := sha1.Sum([]byte(path))
+
+   return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+
+}
+
+
+func (c *HistoryCache) remove (base string) {
+
+   os.Remove(base + cacheMetaSuffix)
+   os.Remove(base + cacheDataSuffix)
+
+}
+
+
+// bring the cache of a history up to date
+func (c *HistoryCache) Update (path string) error {
+
+   e := c.entry(path)
+   e.Lock()
+   defer e.Unlock()
+
+   return c.update(path, e)
+
+}
+
+
+// load columns of a history out of the cache, updating it first. as ReadHistoryColumns, the map
+// returned is keyed by the names asked for even when found under an alias
+func (c *HistoryCache) ReadColumns (path string, columns ...string) (map[string][]float64, error) {
+
+   e := c.entry(path)
+   e.Lock()
+   defer e.Unlock()
+
+   if err := c.update(path, e); err != nil {
+      return nil, err
+   }
+   meta := e.meta
+
+   // resolve names with the same lookup used on history files
+   layout := &DataFile{Name: path, Columns: meta.Columns}
+   index := make(map[string]int, len(columns))
+   for _, name := range columns {
+      index[name] = layout.LookupColumn(name)
+      if index[name] < 0 {
+         return nil, &ParseError{File: path, Err: fmt.Errorf("%w %s", ErrUnknownColumn, name)}
+      }
+   }
+
+   f, err := os.Open(c.base(path) + cacheDataSuffix)
+   if err != nil {
+      return nil, err
+   }
+   defer f.Close()
+
+   data := make(map[string][]float64, len(columns))
+   for name, k := range index {
+      if _, ok := data[name]; ok {
+         continue
+      }
+      values := make([]float64, 0, meta.Rows)
+      for _, chunk := range meta.Chunks {
+         raw := make([]byte, 8 * chunk.Rows)
+         if _, err := f.ReadAt(raw, chunk.Offset + int64(8 * k * chunk.Rows)); err != nil {
+            return nil, err
+         }
+         for i := 0; i < chunk.Rows; i++ {
+            values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:])))
+         }
+      }
+      data[name] = values
+   }
+
+   return data, nil
+
+}
+
+
+// call fn for every row of a history with the values of the columns asked for, out of the cache
+// updated first. columns not in the history are left out, fn gets the names of those found in the
+// order asked for. the history stays locked until all rows are read. a nil cache reads the history
+// file itself
+func (c *HistoryCache) Rows (path string, columns []string, fn func(names []string, values []float64) error) error {
+
+   if c == nil {
+      d, err := OpenDataFile(path)
+      if err != nil {
+         return err
+      }
+      return d.RowValues(columns, fn)
+   }
+
+   e := c.entry(path)
+   e.Lock()
+   defer e.Unlock()
+
+   if err := c.update(path, e); err != nil {
+      return err
+   }
+   meta := e.meta
+
+   layout := &DataFile{Name: path, Columns: meta.Columns}
+   names, index := layout.findColumns(columns)
+
+   f, err := os.Open(c.base(path) + cacheDataSuffix)
+   if err != nil {
+      return err
+   }
+   defer f.Close()
+
+   // one chunk at a time, so that only its rows are kept in memory
+   chunkValues := make([][]float64, len(index))
+   values := make([]float64, len(index))
+   for _, chunk := range meta.Chunks {
+      raw := make([]byte, 8 * chunk.Rows)
+      for j, k := range index {
+         if _, err := f.ReadAt(raw, chunk.Offset + int64(8 * k * chunk.Rows)); err != nil {
+            return err
+         }
+         chunkValues[j] = chunkValues[j][:0]
+         for i := 0; i < chunk.Rows; i++ {
+            chunkValues[j] = append(chunkValues[j], math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:])))
+         }
+      }
+      for i := 0; i < chunk.Rows; i++ {
+         for j := range index {
+            values[j] = chunkValues[j][i]
+         }
+         if err := fn(names, values); err != nil {
+            return err
+         }
+      }
+   }
+
+   return nil
+
+}
+
+
+// export a history as ExportHistory does, reading its rows out of the cache. a nil cache reads the
+// history file itself
+func (c *HistoryCache) Export (path string, w io.Writer, format ExportFormat, opts *ExportOptions) error {
+
+   if c == nil {
+      return ExportHistory(path, w, format, opts)
+   }
+   if opts == nil {
+      opts = &ExportOptions{}
+   }
+
+   // only the header is read, to check the columns asked for
+   d, err := OpenDataFile(path)
+   if err != nil {
+      return err
+   }
+   columns, _, err := d.exportColumns(opts)
+   if err != nil {
+      return err
+   }
+
+   return exportRows(w, format, columns, opts, func(fn func(values []float64) error) error {
+      return c.Rows(path, columns, func(names []string, values []float64) error {
+         if len(names) != len(columns) {
+            return errCacheStale
+         }
+         return fn(values)
+      })
+   })
+
+}
+
+
+// check the history against its cache: nothing to do when untouched, append new rows when it grew
+// and build it again otherwise
+func (c *HistoryCache) update (path string, e *cacheEntry) error {
+
+   stat, err := os.Stat(path)
+   if err != nil {
+      return &ParseError{File: path, Err: err}
+   }
+
+   if e.meta != nil && e.meta.Size == stat.Size() && e.meta.ModTime.Equal(stat.ModTime()) {
+      return nil
+   }
+
+   if e.meta != nil && stat.Size() > e.meta.Size {
+      err := c.appendRows(path, e.meta, stat)
+      if err == nil {
+         return nil
+      }
+      mesaio.LogInfo("MESA - cache.go - update", "cannot append to cache of " + path + ": " + err.Error())
+   }
+
+   timer := time.Now()
+   meta, err := c.build(path, stat)
+   if err != nil {
+      e.meta = nil
+      c.remove(c.base(path))
+      return err
+   }
+   e.meta = meta
+   mesaio.LogInfo("MESA - cache.go - update", "cached " + path + " in " + time.Since(timer).String())
+
+   return nil
+
+}
+
+
+// write the cache of a history from scratch
+func (c *HistoryCache) build (path string, stat os.FileInfo) (*cacheMeta, error) {
+
+   d, err := OpenDataFile(path)
+   if err != nil {
+      return nil, err
+   }
+
+   offset, line := d.DataStart()
+   meta := &cacheMeta{Version: cacheVersion, Path: path, Columns: d.Columns, Offset: offset, Line: line}
+
+   f, err := os.Create(c.base(path) + cacheDataSuffix)
+   if err != nil {
+      return nil, err
+   }
+   defer f.Close()
+
+   if err := c.scan(d, meta, f, stat); err != nil {
+      return nil, err
+   }
+
+   return meta, nil
+
+}
+
+
+// parse rows added to a history since it was cached and append them
+func (c *HistoryCache) appendRows (path string, meta *cacheMeta, stat os.FileInfo) error {
+
+   d, err := OpenDataFile(path)
+   if err != nil {
+      return err
+   }
+   if strings.Join(d.Columns, " ") != strings.Join(meta.Columns, " ") {
+      return errCacheStale
+   }
+   if tail, err := tailChecksum(path, meta.Offset); err != nil || tail != meta.Tail {
+      return errCacheStale
+   }
+
+   f, err := os.OpenFile(c.base(path) + cacheDataSuffix, os.O_RDWR, 0644)
+   if err != nil {
+      return err
+   }
+   defer f.Close()
+
+   // drop anything written after the last metadata update, e.g. if the service died midway
+   if err := f.Truncate(meta.DataSize); err != nil {
+      return err
+   }
+   if _, err := f.Seek(meta.DataSize, io.SeekStart); err != nil {
+      return err
+   }
+
+   if err := c.scan(d, meta, f, stat); err != nil {
+      return err
+   }
+
+   if len(meta.Chunks) > cacheMaxChunks {
+      return c.compact(meta)
+   }
+
+   return nil
+
+}
+
+
+// parse rows of the history from meta.Offset on, appending them to f by chunks. metadata is saved
+// once all rows are written
+func (c *HistoryCache) scan (d *DataFile, meta *cacheMeta, f *os.File, stat os.FileInfo) error {
+
+   out := bufio.NewWriterSize(f, 1 << 20)
+   columns := make([][]float64, len(meta.Columns))
+
+   flush := func() error {
+      rows := len(columns[0])
+      if rows == 0 {
+         return nil
+      }
+      buf := make([]byte, 8)
+      for k := range columns {
+         for _, v := range columns[k] {
+            binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+            if _, err := out.Write(buf); err != nil {
+               return err
+            }
+         }
+         columns[k] = columns[k][:0]
+      }
+      meta.Chunks = append(meta.Chunks, cacheChunk{Offset: meta.DataSize, Rows: rows})
+      meta.DataSize += int64(8 * rows * len(columns))
+      meta.Rows += rows
+      return nil
+   }
+
+   err := d.RowsFrom(meta.Offset, meta.Line, func(line int, end int64, fields []string) error {
+      // values that cannot be parsed (e.g. ****** written by Fortran) are stored as NaN, as RowValues
+      for k := range columns {
+         v, err := ParseValue(fields[k])
+         if err != nil {
+            v = math.NaN()
+         }
+         columns[k] = append(columns[k], v)
+      }
+      meta.Offset, meta.Line = end, line
+      if len(columns[0]) >= cacheChunkRows {
+         return flush()
+      }
+      return nil
+   })
+   if err != nil {
+      return err
+   }
+   if err := flush(); err != nil {
+      return err
+   }
+   if err := out.Flush(); err != nil {
+      return err
+   }
+
+   meta.Tail, err = tailChecksum(d.Name, meta.Offset)
+   if err != nil {
+      return err
+   }
+   meta.Size = stat.Size()
+   meta.ModTime = stat.ModTime()
+
+   return writeCacheMeta(c.base(meta.Path) + cacheMetaSuffix, meta)
+
+}
+
+
+// rewrite the data of a cache as a single chunk
+func (c *HistoryCache) compact (meta *cacheMeta) error {
+
+   base := c.base(meta.Path)
+
+   src, err := os.Open(base + cacheDataSuffix)
+   if err != nil {
+      return err
+   }
+   defer src.Close()
+
+   dst, err := os.Create(base + cacheDataSuffix + ".tmp")
+   if err != nil {
+      return err
+   }
+   defer dst.Close()
+
+   out := bufio.NewWriterSize(dst, 1 << 20)
+   for k := range meta.Columns {
+      for _, chunk := range meta.Chunks {
+         section := io.NewSectionReader(src, chunk.Offset + int64(8 * k * chunk.Rows), int64(8 * chunk.Rows))
+         if _, err := io.Copy(out, section); err != nil {
+            return err
+         }
+      }
+   }
+   if err := out.Flush(); err != nil {
+      return err
+   }
+
+   if err := os.Rename(base + cacheDataSuffix + ".tmp", base + cacheDataSuffix); err != nil {
+      return err
+   }
+   meta.Chunks = []cacheChunk{{Offset: 0, Rows: meta.Rows}}
+
+   return writeCacheMeta(base + cacheMetaSuffix, meta)
+
+}
+
+
+// checksum of the bytes right before offset, used to tell if a history was rewritten rather than
+// appended to (e.g. MESA restarting from a photo)
+func tailChecksum (path string, offset int64) (uint32, error) {
+
+   f, err := os.Open(path)
+   if err != nil {
+      return 0, err
+   }
+   defer f.Close()
+
+   start := offset - cacheTailBytes
+   if start < 0 {
+      start = 0
+   }
+   buf := make([]byte, offset - start)
+   if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+      return 0, err
+   }
+
+   return crc32.ChecksumIEEE(buf), nil
+
+}
+
+
+func readCacheMeta (filename string) (*cacheMeta, error) {
+
+   raw, err := ioutil.ReadFile(filename)
+   if err != nil {
+      return nil, err
+   }
+
+   meta := new(cacheMeta)
+   if err := json.Unmarshal(raw, meta); err != nil {
+      return nil, err
+   }
+
+   return meta, nil
+
+}
+
+
+// write metadata to a temporary file first, so that a crash never leaves it half written
+func writeCacheMeta (filename string, meta *cacheMeta) error {
+
+   raw, err := json.Marshal(meta)
+   if err != nil {
+      return err
+   }
+   if err := ioutil.WriteFile(filename + ".tmp", raw, 0644); err != nil {
+      return err
+   }
+
+   return os.Rename(filename + ".tmp", filename)
+
+}
@@ -0,0 +1,185 @@
+package mesa
+
+import (
+   "fmt"
+   "math"
+   "os"
+   "testing"
+)
+
+
+// append text to a history as MESA does while running
+func appendHistory (t *testing.T, filename, text string) {
+
+   t.Helper()
+
+   f, err := os.OpenFile(filename, os.O_APPEND | os.O_WRONLY, 0644)
+   if err != nil {
+      t.Fatal(err)
+   }
+   defer f.Close()
+   if _, err := f.WriteString(text); err != nil {
+      t.Fatal(err)
+   }
+
+}
+
+
+// read columns out of the cache, checking model numbers go from 1 to rows
+func readCached (t *testing.T, cache *HistoryCache, filename string, rows int) []float64 {
+
+   t.Helper()
+
+   data, err := cache.ReadColumns(filename, "model_number", "star_age")
+   if err != nil {
+      t.Fatal(err)
+   }
+   models, ages := data["model_number"], data["star_age"]
+   if len(models) != rows || len(ages) != rows {
+      t.Fatalf("got %d models & %d ages, want %d rows", len(models), len(ages), rows)
+   }
+   for i, model := range models {
+      if model != float64(i + 1) {
+         t.Fatalf("got models %v", models)
+      }
+   }
+
+   return ages
+
+}
+
+
+func chunksOf (cache *HistoryCache, filename string) int {
+
+   return len(cache.entry(filename).meta.Chunks)
+
+}
+
+
+// rows added to a history are appended to its cache as a new chunk
+func TestHistoryCacheAppend (t *testing.T) {
+
+   cache := newTestCache(t)
+   filename := writeHistory(t, t.TempDir(), "history.data", []string{"model_number", "star_age"}, [][]float64{{1, 0}, {2, 10}, {3, 20}})
+
+   readCached(t, cache, filename, 3)
+
+   // a row still being written is left for later
+   appendHistory(t, filename, "4 30\n5 ******\n6 5")
+   ages := readCached(t, cache, filename, 5)
+   if ages[3] != 30 || !math.IsNaN(ages[4]) {
+      t.Errorf("got ages %v, want an unparsable one as NaN", ages)
+   }
+   if got := chunksOf(cache, filename); got != 2 {
+      t.Errorf("got %d chunks, want rows appended as a second one", got)
+   }
+
+   appendHistory(t, filename, "0\n")
+   if ages := readCached(t, cache, filename, 6); ages[5] != 50 {
+      t.Errorf("got ages %v once the last row was written", ages)
+   }
+
+   // another cache on the same folder picks up what was cached
+   again, err := NewHistoryCache(cache.Dir)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if paths, err := again.Load(); err != nil || len(paths) != 1 || paths[0] != filename {
+      t.Fatalf("got cached paths %v, %v", paths, err)
+   }
+   readCached(t, again, filename, 6)
+   if got := chunksOf(again, filename); got != 3 {
+      t.Errorf("got %d chunks once loaded, want 3", got)
+   }
+
+}
+
+
+// histories rewritten rather than appended to, e.g. on restarts from a photo, are cached again
+func TestHistoryCacheRebuild (t *testing.T) {
+
+   columns := []string{"model_number", "star_age"}
+
+   t.Run("tail checksum mismatch", func(t *testing.T) {
+
+      cache := newTestCache(t)
+      dir := t.TempDir()
+      filename := writeHistory(t, dir, "history.data", columns, [][]float64{{1, 0}, {2, 10}, {3, 20}})
+      readCached(t, cache, filename, 3)
+
+      // larger than before but with other values in rows already cached
+      writeHistory(t, dir, "history.data", columns, [][]float64{{1, 0}, {2, 11}, {3, 21}, {4, 31}})
+      ages := readCached(t, cache, filename, 4)
+      if ages[1] != 11 || ages[3] != 31 {
+         t.Errorf("got ages %v, want those of the new history", ages)
+      }
+      if got := chunksOf(cache, filename); got != 1 {
+         t.Errorf("got %d chunks, want the cache built again", got)
+      }
+
+   })
+
+   t.Run("truncated history", func(t *testing.T) {
+
+      cache := newTestCache(t)
+      dir := t.TempDir()
+      filename := writeHistory(t, dir, "history.data", columns, [][]float64{{1, 0}, {2, 10}, {3, 20}})
+      readCached(t, cache, filename, 3)
+
+      writeHistory(t, dir, "history.data", columns, [][]float64{{1, 0}, {2, 12}})
+      if ages := readCached(t, cache, filename, 2); ages[1] != 12 {
+         t.Errorf("got ages %v, want those of the new history", ages)
+      }
+
+   })
+
+   t.Run("other columns", func(t *testing.T) {
+
+      cache := newTestCache(t)
+      dir := t.TempDir()
+      filename := writeHistory(t, dir, "history.data", columns, [][]float64{{1, 0}})
+      readCached(t, cache, filename, 1)
+
+      writeHistory(t, dir, "history.data", append(columns, "star_mass"), [][]float64{{1, 0, 10}, {2, 10, 9.9}})
+      data, err := cache.ReadColumns(filename, "star_mass")
+      if err != nil || len(data["star_mass"]) != 2 || data["star_mass"][1] != 9.9 {
+         t.Errorf("got %v, %v", data, err)
+      }
+
+   })
+
+}
+
+
+// once too many rows were appended one chunk at a time, the cache is rewritten as a single chunk
+func TestHistoryCacheCompact (t *testing.T) {
+
+   cache := newTestCache(t)
+   filename := writeHistory(t, t.TempDir(), "history.data", []string{"model_number", "star_age"}, [][]float64{{1, 0}})
+   readCached(t, cache, filename, 1)
+
+   rows := 1
+   for k := 0; k < cacheMaxChunks; k++ {
+      rows++
+      appendHistory(t, filename, fmt.Sprintf("%d %d\n", rows, 10 * (rows - 1)))
+      readCached(t, cache, filename, rows)
+   }
+
+   if got := chunksOf(cache, filename); got != 1 {
+      t.Errorf("got %d chunks, want a single one after %d appends", got, cacheMaxChunks)
+   }
+   ages := readCached(t, cache, filename, rows)
+   for i, age := range ages {
+      if age != float64(10 * i) {
+         t.Fatalf("got ages %v once compacted", ages)
+      }
+   }
+
+   // rows are still appended after compaction
+   appendHistory(t, filename, fmt.Sprintf("%d %d\n", rows + 1, 10 * rows))
+   readCached(t, cache, filename, rows + 1)
+   if got := chunksOf(cache, filename); got != 2 {
+      t.Errorf("got %d chunks after appending to a compacted cache", got)
+   }
+
+}
@@ -0,0 +1,127 @@
+package mesa
+
+import (
+   "errors"
+   "fmt"
+   "math"
+)
+
+
+// error returned when a column asked for is not in the file
+var ErrUnknownColumn = errors.New("unknown column")
+
+
+// names under which the same quantity is written by different MESA versions. this is the only list
+// of aliases: struct tags only hold the first name, see tagAliases
+var ColumnAliases = map[string][]string{
+   "log_center_T": {"log_cntr_T"},
+   "log_center_Rho": {"log_cntr_Rho"},
+   "log_center_P": {"log_cntr_P"},
+   "log_L": {"log_Lsurf"},
+   "age": {"star_age"},
+}
+
+
+// position of a column in file, looking also for its known aliases. -1 if not found
+func (d *DataFile) LookupColumn (name string) int {
+
+   return d.ColumnIndex(append([]string{name}, ColumnAliases[name]...)...)
+
+}
+
+
+// load full columns of a MESA output file. returned map is keyed by the names asked for, even when
+// the column was found under one of its aliases
+func (d *DataFile) ReadColumns (columns ...string) (map[string][]float64, error) {
+
+   // the same column might be asked twice, e.g. for x & y
+   unique := make([]string, 0, len(columns))
+   seen := make(map[string]bool, len(columns))
+   for _, name := range columns {
+      if !seen[name] {
+         seen[name] = true
+         unique = append(unique, name)
+      }
+   }
+   columns = unique
+
+   index := make([]int, len(columns))
+   for k, name := range columns {
+      index[k] = d.LookupColumn(name)
+      if index[k] < 0 {
+         return nil, &ParseError{File: d.Name, Err: fmt.Errorf("%w %s", ErrUnknownColumn, name)}
+      }
+   }
+
+   data := make(map[string][]float64, len(columns))
+
+   err := d.Rows(func(line int, fields []string) error {
+      for k, name := range columns {
+         f, err := ParseValue(fields[index[k]])
+         if err != nil {
+            return &ParseError{File: d.Name, Line: line, Err: err}
+         }
+         data[name] = append(data[name], f)
+      }
+      return nil
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   return data, nil
+
+}
+
+
+// load full columns of a MESA history file
+func ReadHistoryColumns (filename string, columns ...string) (map[string][]float64, error) {
+
+   d, err := OpenDataFile(filename)
+   if err != nil {
+      return nil, err
+   }
+
+   return d.ReadColumns(columns...)
+
+}
+
+
+// columns asked for that are in the file, in the order asked for, with their position. names not
+// found are left out
+func (d *DataFile) findColumns (columns []string) ([]string, []int) {
+
+   var names []string
+   var index []int
+   for _, name := range columns {
+      if k := d.LookupColumn(name); k >= 0 {
+         names = append(names, name)
+         index = append(index, k)
+      }
+   }
+
+   return names, index
+
+}
+
+
+// call fn for every row with the values of the columns asked for that are in the file, see
+// HistoryCache.Rows. values that do not parse are NaN
+func (d *DataFile) RowValues (columns []string, fn func(names []string, values []float64) error) error {
+
+   names, index := d.findColumns(columns)
+   values := make([]float64, len(index))
+
+   return d.Rows(func(line int, fields []string) error {
+      for j, k := range index {
+         values[j] = math.NaN()
+         if k < len(fields) {
+            if v, err := ParseValue(fields[k]); err == nil {
+               values[j] = v
+            }
+         }
+      }
+      return fn(names, values)
+   })
+
+}
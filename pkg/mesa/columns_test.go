@@ -0,0 +1,59 @@
+package mesa
+
+import (
+   "math"
+   "testing"
+)
+
+
+// fields are found under every alias of ColumnAliases, from text rows, parsed values & files
+func TestColumnAliases (t *testing.T) {
+
+   names := []string{"model_number", "log_cntr_T", "log_Lsurf", "star_mass"}
+   raw := []string{"12", "7.5", "2.25", "9.5"}
+   values := []float64{12, 7.5, 2.25, 9.5}
+
+   check := func(how string, in StageInput) {
+      t.Helper()
+      if in.LogTcntr != 7.5 || in.LogL != 2.25 || in.Mass != 9.5 || !math.IsNaN(in.LogTeff) {
+         t.Errorf("%s: got %+v", how, in)
+      }
+   }
+
+   check("text row", stageInputFromRow(names, raw))
+
+   in := NewStageInput()
+   assignValues(&in, columnTag, names, values)
+   check("values", in)
+
+   // an exact name is used before an alias
+   star := new(MESAstarInfo)
+   if err := assignFields(star, columnTag, []string{"log_cntr_T", "log_center_T"}, []string{"7", "8"}); err != nil {
+      t.Fatal(err)
+   }
+   if star.LogTcntr != 8 {
+      t.Errorf("got log_center_T %g, want the exact name over its alias", star.LogTcntr)
+   }
+
+   dir := t.TempDir()
+   filename := writeHistory(t, dir, "history.data", names, [][]float64{values})
+   for _, cache := range []*HistoryCache{nil, newTestCache(t)} {
+      err := cache.Rows(filename, tagNames(&StageInput{}, columnTag), func(found []string, row []float64) error {
+         in := NewStageInput()
+         assignValues(&in, columnTag, found, row)
+         check("history rows", in)
+         return nil
+      })
+      if err != nil {
+         t.Fatal(err)
+      }
+   }
+
+   d := &DataFile{Columns: names}
+   for name, want := range map[string]int{"log_center_T": 1, "log_L": 2, "log_Lsurf": 2, "age": -1, "center_h1": -1} {
+      if got := d.LookupColumn(name); got != want {
+         t.Errorf("LookupColumn(%q) = %d, want %d", name, got, want)
+      }
+   }
+
+}
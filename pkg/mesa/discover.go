@@ -0,0 +1,116 @@
+package mesa
+
+import (
+   "os"
+   "path/filepath"
+   "strconv"
+   "strings"
+
+   "web-service/pkg/io"
+)
+
+// files & folders telling a directory is a MESA run
+var inlistName = "inlist"
+var runScriptName = "rn"
+
+// folders never holding a MESA run, not worth walking into
+var skipDirs = map[string]bool{
+   "photos": true,
+   "make": true,
+   "src": true,
+   ".git": true,
+   "png": true,
+   ".mesa_temp_cache": true,
+}
+
+
+// find out if path is a MESA run directory: it has an inlist, plus LOGS or the rn script used to
+// start the run, so that runs still waiting in a queue are also found
+func IsRunDir (path string) bool {
+
+   entries, err := os.ReadDir(path)
+   if err != nil {
+      return false
+   }
+
+   hasInlist, hasLogs, hasScript := false, false, false
+   for _, entry := range entries {
+      name := entry.Name()
+      switch {
+      case !entry.IsDir() && name == inlistName:
+         hasInlist = true
+      case entry.IsDir() && strings.HasPrefix(name, starLogDirectory):
+         hasLogs = true
+      case !entry.IsDir() && name == runScriptName:
+         hasScript = true
+      }
+   }
+
+   return hasInlist && (hasLogs || hasScript)
+
+}
+
+
+// walk recursively through roots looking for MESA run directories. once a run is found its
+// subfolders are not searched, as those belong to the run (e.g. bin2dco stages). returned paths are
+// absolute with symlinks resolved, as cwd of running processes, and end with a slash as RootDir in
+// MESAInfo. runs under several of the roots are returned once
+func DiscoverRuns (roots []string) ([]string, error) {
+
+   var runs []string
+   seen := make(map[string]bool)
+
+   for _, root := range roots {
+
+      io.LogInfo("MESA - discover.go - DiscoverRuns", "searching for MESA runs in " + root)
+
+      // roots might be symlinks, which are not followed when walking
+      dir, err := filepath.EvalSymlinks(root)
+      if err == nil {
+         dir, err = filepath.Abs(dir)
+      }
+      if err != nil {
+         io.LogError("MESA - discover.go - DiscoverRuns", "skipping root " + root + ": " + err.Error())
+         continue
+      }
+
+      err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+
+         // unreadable folders are just skipped
+         if err != nil {
+            if info != nil && info.IsDir() {
+               return filepath.SkipDir
+            }
+            return nil
+         }
+
+         if !info.IsDir() {
+            return nil
+         }
+         if path != dir && (skipDirs[info.Name()] || strings.HasPrefix(info.Name(), starLogDirectory)) {
+            return filepath.SkipDir
+         }
+
+         if IsRunDir(path) {
+            run := strings.TrimSuffix(path, "/") + "/"
+            if !seen[run] {
+               runs = append(runs, run)
+               seen[run] = true
+            }
+            return filepath.SkipDir
+         }
+
+         return nil
+
+      })
+      if err != nil {
+         return runs, err
+      }
+
+   }
+
+   io.LogInfo("MESA - discover.go - DiscoverRuns", "found " + strconv.Itoa(len(runs)) + " MESA runs")
+
+   return runs, nil
+
+}
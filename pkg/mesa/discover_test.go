@@ -0,0 +1,110 @@
+package mesa
+
+import (
+   "os"
+   "path/filepath"
+   "strings"
+   "testing"
+)
+
+
+// make a run directory in dir, with an inlist & either LOGS or the rn script
+func makeRun (t *testing.T, dir string, logs bool) {
+
+   t.Helper()
+
+   if err := os.MkdirAll(dir, 0755); err != nil {
+      t.Fatal(err)
+   }
+   writeFile(t, dir, "inlist", "")
+   if logs {
+      if err := os.MkdirAll(filepath.Join(dir, "LOGS"), 0755); err != nil {
+         t.Fatal(err)
+      }
+   } else {
+      writeFile(t, dir, "rn", "")
+   }
+
+}
+
+
+func TestDiscoverRuns (t *testing.T) {
+
+   base, err := filepath.EvalSymlinks(t.TempDir())
+   if err != nil {
+      t.Fatal(err)
+   }
+   root := filepath.Join(base, "grid")
+
+   makeRun(t, filepath.Join(root, "m10"), true)
+   makeRun(t, filepath.Join(root, "set1", "m20"), false)
+   // runs inside runs, LOGS & photos are not searched
+   makeRun(t, filepath.Join(root, "m10", "stage1"), true)
+   makeRun(t, filepath.Join(root, "set1", "LOGS_old", "m30"), true)
+   makeRun(t, filepath.Join(root, "set1", "photos", "m40"), true)
+   // an inlist alone is not a run
+   if err := os.MkdirAll(filepath.Join(root, "set2"), 0755); err != nil {
+      t.Fatal(err)
+   }
+   writeFile(t, filepath.Join(root, "set2"), "inlist", "")
+
+   want := root + "/m10/ " + root + "/set1/m20/"
+
+   cases := []struct {
+      name string
+      roots []string
+   }{
+      {"root", []string{root}},
+      {"root with a trailing slash", []string{root + "/"}},
+      {"relative root", []string{mustRel(t, root)}},
+      {"nested roots", []string{root, filepath.Join(root, "set1"), filepath.Join(root, "m10")}},
+      {"missing root", []string{filepath.Join(base, "missing"), root}},
+   }
+
+   // symlinks to roots give the paths the runs really are at
+   link := filepath.Join(base, "link")
+   if err := os.Symlink(root, link); err != nil {
+      t.Fatal(err)
+   }
+   cases = append(cases, struct {
+      name string
+      roots []string
+   }{"symlinked root", []string{link}})
+
+   for _, c := range cases {
+      runs, err := DiscoverRuns(c.roots)
+      if err != nil {
+         t.Errorf("%s: %v", c.name, err)
+         continue
+      }
+      if got := strings.Join(runs, " "); got != want {
+         t.Errorf("%s: got runs %q, want %q", c.name, got, want)
+      }
+   }
+
+   // a run given as root is found itself
+   runs, err := DiscoverRuns([]string{filepath.Join(root, "m10")})
+   if err != nil || len(runs) != 1 || runs[0] != root + "/m10/" {
+      t.Errorf("got runs %v, %v", runs, err)
+   }
+
+}
+
+
+// path of dir relative to the working directory
+func mustRel (t *testing.T, dir string) string {
+
+   t.Helper()
+
+   wd, err := os.Getwd()
+   if err != nil {
+      t.Fatal(err)
+   }
+   rel, err := filepath.Rel(wd, dir)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   return rel
+
+}
@@ -0,0 +1,287 @@
+package mesa
+
+import (
+   "bufio"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "io"
+   "math"
+   "strconv"
+   "strings"
+)
+
+
+// formats histories can be exported to
+type ExportFormat int
+
+const (
+   FormatCSV ExportFormat = iota
+   FormatJSONLines
+   FormatParquet
+)
+
+var exportFormatNames = map[ExportFormat]string{
+   FormatCSV: "csv",
+   FormatJSONLines: "jsonl",
+   FormatParquet: "parquet",
+}
+
+
+func (f ExportFormat) String() string {
+
+   return exportFormatNames[f]
+
+}
+
+
+// file extension for a format
+func (f ExportFormat) Extension() string {
+
+   return "." + exportFormatNames[f]
+
+}
+
+
+// MIME type for a format
+func (f ExportFormat) ContentType() string {
+
+   switch f {
+   case FormatCSV:
+      return "text/csv"
+   case FormatJSONLines:
+      return "application/x-ndjson"
+   }
+
+   return "application/vnd.apache.parquet"
+
+}
+
+
+// format from its name. arrow files are not written, parquet is the way to go for arrow users as
+// both pyarrow and the arrow R package read it directly
+func ParseExportFormat (name string) (ExportFormat, error) {
+
+   switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+   case "csv":
+      return FormatCSV, nil
+   case "jsonl", "ndjson", "json":
+      return FormatJSONLines, nil
+   case "parquet", "pq":
+      return FormatParquet, nil
+   case "arrow", "feather", "ipc":
+      return FormatCSV, fmt.Errorf("export format %q is not supported, use parquet which arrow reads", name)
+   }
+
+   return FormatCSV, fmt.Errorf("unknown export format %q", name)
+
+}
+
+
+// what to export out of a history. rows are counted from 0 in the order found in the file, LastRow
+// excluded. LastRow <= 0 exports until the end. no columns means all of them
+type ExportOptions struct {
+   Columns []string
+   FirstRow int
+   LastRow int
+}
+
+
+// writes rows into an exported file
+type rowWriter interface {
+   WriteRow (values []float64) error
+   Close () error
+}
+
+
+// used to stop reading rows once past the last one asked for
+var errStopRows = errors.New("stop reading rows")
+
+
+// export a history file, see DataFile.Export
+func ExportHistory (filename string, w io.Writer, format ExportFormat, opts *ExportOptions) error {
+
+   d, err := OpenDataFile(filename)
+   if err != nil {
+      return err
+   }
+
+   return d.Export(w, format, opts)
+
+}
+
+
+// write columns & rows of the file into w in a given format. rows are streamed one by one (or one
+// row group at a time for parquet), so files do not need to fit in memory
+func (d *DataFile) Export (w io.Writer, format ExportFormat, opts *ExportOptions) error {
+
+   if opts == nil {
+      opts = &ExportOptions{}
+   }
+
+   columns, index, err := d.exportColumns(opts)
+   if err != nil {
+      return err
+   }
+
+   return exportRows(w, format, columns, opts, func(fn func(values []float64) error) error {
+      values := make([]float64, len(columns))
+      return d.Rows(func(line int, fields []string) error {
+         for k := range columns {
+            f, err := ParseValue(fields[index[k]])
+            if err != nil {
+               return &ParseError{File: d.Name, Line: line, Err: err}
+            }
+            values[k] = f
+         }
+         return fn(values)
+      })
+   })
+
+}
+
+
+// columns to export & their position in the file, all of them when none are asked for
+func (d *DataFile) exportColumns (opts *ExportOptions) ([]string, []int, error) {
+
+   columns := opts.Columns
+   if len(columns) == 0 {
+      columns = d.Columns
+   }
+   index := make([]int, len(columns))
+   for k, name := range columns {
+      index[k] = d.LookupColumn(name)
+      if index[k] < 0 {
+         return nil, nil, &ParseError{File: d.Name, Err: fmt.Errorf("%w %s", ErrUnknownColumn, name)}
+      }
+   }
+
+   return columns, index, nil
+
+}
+
+
+// write the rows passed by rows to fn into w, keeping those between opts.FirstRow & opts.LastRow
+func exportRows (w io.Writer, format ExportFormat, columns []string, opts *ExportOptions, rows func(fn func(values []float64) error) error) error {
+
+   var out rowWriter
+   switch format {
+   case FormatCSV:
+      out = newCSVWriter(w, columns)
+   case FormatJSONLines:
+      out = newJSONLinesWriter(w, columns)
+   case FormatParquet:
+      out = newParquetWriter(w, columns)
+   default:
+      return fmt.Errorf("unknown export format %d", format)
+   }
+
+   row := 0
+   err := rows(func(values []float64) error {
+
+      if opts.LastRow > 0 && row >= opts.LastRow {
+         return errStopRows
+      }
+      row++
+      if row <= opts.FirstRow {
+         return nil
+      }
+
+      return out.WriteRow(values)
+
+   })
+   if err != nil && err != errStopRows {
+      return err
+   }
+
+   return out.Close()
+
+}
+
+
+// comma separated values, with a header line of column names. NaN & Inf are written as such, which
+// both pandas & R understand
+type csvWriter struct {
+   out *bufio.Writer
+   buf []byte
+}
+
+func newCSVWriter (w io.Writer, columns []string) *csvWriter {
+
+   c := &csvWriter{out: bufio.NewWriter(w)}
+   c.out.WriteString(strings.Join(columns, ",") + "\n")
+
+   return c
+
+}
+
+func (c *csvWriter) WriteRow (values []float64) error {
+
+   c.buf = c.buf[:0]
+   for k, v := range values {
+      if k > 0 {
+         c.buf = append(c.buf, ',')
+      }
+      c.buf = strconv.AppendFloat(c.buf, v, 'g', -1, 64)
+   }
+   c.buf = append(c.buf, '\n')
+
+   _, err := c.out.Write(c.buf)
+
+   return err
+
+}
+
+func (c *csvWriter) Close () error {
+
+   return c.out.Flush()
+
+}
+
+
+// one JSON object per row, keyed by column name. values that are not finite are written as null
+type jsonLinesWriter struct {
+   out *bufio.Writer
+   keys [][]byte
+   buf []byte
+}
+
+func newJSONLinesWriter (w io.Writer, columns []string) *jsonLinesWriter {
+
+   j := &jsonLinesWriter{out: bufio.NewWriter(w)}
+   for _, name := range columns {
+      key, _ := json.Marshal(name)
+      j.keys = append(j.keys, append(key, ':'))
+   }
+
+   return j
+
+}
+
+func (j *jsonLinesWriter) WriteRow (values []float64) error {
+
+   j.buf = append(j.buf[:0], '{')
+   for k, v := range values {
+      if k > 0 {
+         j.buf = append(j.buf, ',')
+      }
+      j.buf = append(j.buf, j.keys[k]...)
+      if math.IsNaN(v) || math.IsInf(v, 0) {
+         j.buf = append(j.buf, "null"...)
+      } else {
+         j.buf = strconv.AppendFloat(j.buf, v, 'g', -1, 64)
+      }
+   }
+   j.buf = append(j.buf, '}', '\n')
+
+   _, err := j.out.Write(j.buf)
+
+   return err
+
+}
+
+func (j *jsonLinesWriter) Close () error {
+
+   return j.out.Flush()
+
+}
@@ -0,0 +1,216 @@
+package mesa
+
+import (
+   "encoding"
+   "errors"
+   "reflect"
+   "strconv"
+   "strings"
+)
+
+// struct tags used to map MESA output names into struct fields. each tag holds a comma separated
+// list of names; the first one present in the file is the one used. column names are also looked
+// for under their ColumnAliases, which are not repeated in tags, e.g.
+//
+//    LogTcntr float64 `column:"log_center_T"`
+//
+// also matches log_cntr_T of older MESA versions
+const headerTag = "header"
+const columnTag = "column"
+
+
+// error returned when a column is listed in the file but the row has no value for it
+var ErrMissingValue = errors.New("missing value")
+
+
+// error on a single struct field while mapping MESA output into it
+type FieldError struct {
+   Field string
+   Name string
+   Value string
+   Err error
+}
+
+func (e *FieldError) Error() string {
+   return "field " + e.Field + " (" + e.Name + " = \"" + e.Value + "\"): " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+   return e.Err
+}
+
+
+// collection of all the errors found while mapping a row into a struct
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+   msgs := make([]string, len(e))
+   for k, err := range e {
+      msgs[k] = err.Error()
+   }
+   return strings.Join(msgs, "; ")
+}
+
+
+// fill fields of the struct pointed by dst whose tag matches one of the names with the
+// corresponding value. fields without a matching name are left untouched. every field that could
+// not be parsed is reported in the returned FieldErrors, the rest are still assigned
+func assignFields (dst interface{}, tag string, names, values []string) error {
+
+   // position of each name in the row
+   index := make(map[string]int, len(names))
+   for k, name := range names {
+      if _, ok := index[name]; !ok {
+         index[name] = k
+      }
+   }
+
+   v := reflect.ValueOf(dst).Elem()
+   t := v.Type()
+
+   var errs FieldErrors
+   for i := 0; i < t.NumField(); i++ {
+
+      aliases, ok := t.Field(i).Tag.Lookup(tag)
+      if !ok {
+         continue
+      }
+
+      for _, alias := range tagAliases(tag, aliases) {
+
+         k, found := index[alias]
+         if !found {
+            continue
+         }
+
+         if k >= len(values) {
+            errs = append(errs, &FieldError{Field: t.Field(i).Name, Name: alias, Err: ErrMissingValue})
+            break
+         }
+
+         if err := setField(v.Field(i), values[k]); err != nil {
+            errs = append(errs, &FieldError{Field: t.Field(i).Name, Name: alias, Value: values[k], Err: err})
+         }
+         break
+
+      }
+
+   }
+
+   if len(errs) > 0 {
+      return errs
+   }
+
+   return nil
+
+}
+
+
+// parse raw into field according to its kind
+func setField (field reflect.Value, raw string) error {
+
+   // types knowing how to parse themselves, e.g. MESAVersion
+   if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+      return u.UnmarshalText([]byte(raw))
+   }
+
+   raw = strings.Trim(raw, "\"")
+
+   switch field.Kind() {
+   case reflect.Int:
+      i, err := strconv.Atoi(raw)
+      if err != nil {
+         return err
+      }
+      field.SetInt(int64(i))
+   case reflect.Float64:
+      f, err := ParseValue(raw)
+      if err != nil {
+         return err
+      }
+      field.SetFloat(f)
+   case reflect.String:
+      field.SetString(raw)
+   default:
+      return errors.New("unsupported field kind " + field.Kind().String())
+   }
+
+   return nil
+
+}
+
+
+// every name listed in the tags of the struct pointed by dst, aliases included
+func tagNames (dst interface{}, tag string) []string {
+
+   t := reflect.TypeOf(dst).Elem()
+
+   var names []string
+   for i := 0; i < t.NumField(); i++ {
+      if aliases, ok := t.Field(i).Tag.Lookup(tag); ok {
+         names = append(names, strings.Split(aliases, ",")...)
+      }
+   }
+
+   return names
+
+}
+
+
+// as assignFields, for values already parsed (e.g. out of a HistoryCache). only float & int fields
+// are set, others are left untouched
+func assignValues (dst interface{}, tag string, names []string, values []float64) {
+
+   index := make(map[string]int, len(names))
+   for k, name := range names {
+      if _, ok := index[name]; !ok {
+         index[name] = k
+      }
+   }
+
+   v := reflect.ValueOf(dst).Elem()
+   t := v.Type()
+
+   for i := 0; i < t.NumField(); i++ {
+
+      aliases, ok := t.Field(i).Tag.Lookup(tag)
+      if !ok {
+         continue
+      }
+
+      for _, alias := range tagAliases(tag, aliases) {
+         k, found := index[alias]
+         if !found || k >= len(values) {
+            continue
+         }
+         switch v.Field(i).Kind() {
+         case reflect.Float64:
+            v.Field(i).SetFloat(values[k])
+         case reflect.Int:
+            if isKnown(values[k]) {
+               v.Field(i).SetInt(int64(values[k]))
+            }
+         }
+         break
+      }
+
+   }
+
+}
+
+
+// names a field is looked for under: those listed in its tag, each followed (for columns) by its
+// ColumnAliases
+func tagAliases (tag, list string) []string {
+
+   var names []string
+   for _, name := range strings.Split(list, ",") {
+      names = append(names, name)
+      if tag == columnTag {
+         names = append(names, ColumnAliases[name]...)
+      }
+   }
+
+   return names
+
+}
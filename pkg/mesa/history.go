@@ -0,0 +1,415 @@
+package mesa
+
+import (
+   "bufio"
+   "bytes"
+   "errors"
+   "io"
+   "os"
+   "strconv"
+   "strings"
+)
+
+
+// errors found while parsing MESA output files (history or profile)
+var (
+   ErrNoColumns = errors.New("cannot find column names")
+   ErrShortRow = errors.New("row has fewer values than columns")
+   ErrNoRows = errors.New("no complete data rows")
+)
+
+// size of chunks read from the end of file when looking for the last row
+const tailChunkSize = 64 * 1024
+
+
+// error while parsing a given line of a MESA output file
+type ParseError struct {
+   File string
+   Line int
+   Err error
+}
+
+func (e *ParseError) Error() string {
+   if e.Line > 0 {
+      return e.File + ":" + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+   }
+   return e.File + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+   return e.Err
+}
+
+
+// MESA version, either a plain number ("15140") or a release string ("r23.05.1")
+type MESAVersion struct {
+   Number int
+   Release string
+}
+
+func (v *MESAVersion) UnmarshalText(text []byte) error {
+   raw := strings.Trim(string(text), "\"")
+   if i, err := strconv.Atoi(raw); err == nil {
+      v.Number = i
+      v.Release = ""
+      return nil
+   }
+   if raw == "" {
+      return errors.New("empty version")
+   }
+   v.Number = 0
+   v.Release = raw
+   return nil
+}
+
+// versions are written as in history headers, so that they are read back with UnmarshalText
+func (v MESAVersion) MarshalText() ([]byte, error) {
+   return []byte(v.String()), nil
+}
+
+func (v MESAVersion) String() string {
+   if v.Release != "" {
+      return v.Release
+   }
+   return strconv.Itoa(v.Number)
+}
+
+
+// layout of a MESA output file: header names & values, column names and where data rows start
+type DataFile struct {
+   Name string
+   HeaderNames []string
+   HeaderValues []string
+   Columns []string
+   dataOffset int64
+   dataLine int
+}
+
+
+// read the layout of a MESA history or profile file. MESA writes a row of column numbers before
+// header names and before column names; when those are not found, fall back to the classic layout
+// with header names on line 2, values on line 3 and column names on line 6
+func OpenDataFile (name string) (*DataFile, error) {
+
+   f, err := os.Open(name)
+   if err != nil {
+      return nil, &ParseError{File: name, Err: err}
+   }
+   defer f.Close()
+
+   d := &DataFile{Name: name}
+
+   reader := bufio.NewReaderSize(f, 64*1024)
+   var lines [][]string
+   var offset int64
+   indexLines := 0
+   lineCount := 0
+
+   for {
+
+      line, err := reader.ReadString('\n')
+      if err != nil && err != io.EOF {
+         return nil, &ParseError{File: name, Line: lineCount + 1, Err: err}
+      }
+      if line == "" && err == io.EOF {
+         break
+      }
+      if err == io.EOF {
+         // the column names cannot be on a line that is still being written
+         break
+      }
+
+      lineCount++
+      offset += int64(len(line))
+      fields := splitFields(line)
+      lines = append(lines, fields)
+
+      if isIndexLine(fields) {
+         indexLines++
+         continue
+      }
+
+      // line after first index line holds header names, then comes header values
+      if indexLines == 1 && len(lines) >= 2 && isIndexLine(lines[len(lines)-2]) {
+         d.HeaderNames = fields
+         continue
+      }
+      if indexLines == 1 && d.HeaderNames != nil && d.HeaderValues == nil {
+         d.HeaderValues = fields
+         continue
+      }
+
+      // line after second index line holds column names, data starts right after it
+      if indexLines == 2 && isIndexLine(lines[len(lines)-2]) {
+         d.Columns = fields
+         d.dataOffset = offset
+         d.dataLine = lineCount
+         break
+      }
+
+      // no index lines at all, go with classic layout
+      if indexLines == 0 && lineCount == 6 {
+         if len(lines[1]) > 0 {
+            d.HeaderNames = lines[1]
+            d.HeaderValues = lines[2]
+         }
+         d.Columns = fields
+         d.dataOffset = offset
+         d.dataLine = lineCount
+         break
+      }
+
+   }
+
+   if len(d.Columns) == 0 {
+      return nil, &ParseError{File: name, Err: ErrNoColumns}
+   }
+
+   return d, nil
+
+}
+
+
+// position of the first alias found among column names, -1 if none
+func (d *DataFile) ColumnIndex (aliases ...string) int {
+
+   for _, alias := range aliases {
+      for k, name := range d.Columns {
+         if name == alias {
+            return k
+         }
+      }
+   }
+
+   return -1
+
+}
+
+
+// return the last complete data row. rows that are still being written (no trailing newline or
+// fewer values than columns) are skipped
+func (d *DataFile) LastRow () ([]string, error) {
+
+   f, err := os.Open(d.Name)
+   if err != nil {
+      return nil, &ParseError{File: d.Name, Err: err}
+   }
+   defer f.Close()
+
+   stat, err := f.Stat()
+   if err != nil {
+      return nil, &ParseError{File: d.Name, Err: err}
+   }
+
+   end := stat.Size()
+   var buf []byte
+
+   for end > d.dataOffset {
+
+      // read one more chunk from the end of file
+      start := end - tailChunkSize
+      if start < d.dataOffset {
+         start = d.dataOffset
+      }
+      chunk := make([]byte, end-start)
+      if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+         return nil, &ParseError{File: d.Name, Err: err}
+      }
+      buf = append(chunk, buf...)
+      end = start
+
+      // drop a trailing row without newline, it is still being written
+      i := bytes.LastIndexByte(buf, '\n')
+      if i < 0 {
+         continue
+      }
+
+      // check complete lines from the end, the first one might be cut unless we reached data start
+      lines := bytes.Split(buf[:i], []byte("\n"))
+      for k := len(lines) - 1; k >= 0; k-- {
+         if k == 0 && end > d.dataOffset {
+            break
+         }
+         fields := splitFields(string(lines[k]))
+         if len(fields) >= len(d.Columns) {
+            return fields, nil
+         }
+      }
+
+   }
+
+   return nil, &ParseError{File: d.Name, Err: ErrNoRows}
+
+}
+
+
+// call fn for every complete data row in file. a partial row at the end of file is silently
+// skipped; a short row followed by more data is reported as a ParseError
+func (d *DataFile) Rows (fn func(line int, fields []string) error) error {
+
+   return d.RowsFrom(d.dataOffset, d.dataLine, func(line int, _ int64, fields []string) error {
+      return fn(line, fields)
+   })
+
+}
+
+
+// same as Rows, but starting at a given byte offset of the file which is line number line. fn also
+// gets the offset right after each row, from where reading can be resumed once the file grows
+func (d *DataFile) RowsFrom (offset int64, line int, fn func(line int, end int64, fields []string) error) error {
+
+   f, err := os.Open(d.Name)
+   if err != nil {
+      return &ParseError{File: d.Name, Err: err}
+   }
+   defer f.Close()
+
+   if offset < d.dataOffset {
+      offset, line = d.dataOffset, d.dataLine
+   }
+   if _, err := f.Seek(offset, io.SeekStart); err != nil {
+      return &ParseError{File: d.Name, Err: err}
+   }
+
+   return d.scanRows(f, offset, line, fn)
+
+}
+
+
+// data offset & line number of the first data row
+func (d *DataFile) DataStart () (int64, int) {
+
+   return d.dataOffset, d.dataLine
+
+}
+
+
+// scan data rows from r, where the first line read starts at offset and is the one after lineCount
+func (d *DataFile) scanRows (r io.Reader, offset int64, lineCount int, fn func(line int, end int64, fields []string) error) error {
+
+   reader := bufio.NewReaderSize(r, 64*1024)
+
+   // short rows are only an error if something comes after them
+   var shortRow error
+
+   for {
+
+      line, err := reader.ReadString('\n')
+      if err != nil && err != io.EOF {
+         return &ParseError{File: d.Name, Line: lineCount + 1, Err: err}
+      }
+
+      // a line without newline is the one MESA is still writing
+      if err == io.EOF {
+         return nil
+      }
+
+      lineCount++
+      offset += int64(len(line))
+
+      fields := splitFields(line)
+      if len(fields) == 0 {
+         continue
+      }
+      if shortRow != nil {
+         return shortRow
+      }
+      if len(fields) < len(d.Columns) {
+         shortRow = &ParseError{File: d.Name, Line: lineCount, Err: ErrShortRow}
+         continue
+      }
+
+      if err := fn(lineCount, offset, fields); err != nil {
+         return err
+      }
+
+   }
+
+}
+
+
+// parse a numeric value as written by MESA. besides the usual formats it handles Fortran D
+// exponents (1.0D+00), exponents without letter (1.0-100), NaN, Infinity and quoted values
+func ParseValue (raw string) (float64, error) {
+
+   raw = strings.Trim(raw, "\"'")
+
+   f, err := strconv.ParseFloat(raw, 64)
+   if err == nil {
+      return f, nil
+   }
+
+   // Fortran double precision exponent
+   fixed := strings.NewReplacer("D", "E", "d", "e").Replace(raw)
+
+   // Fortran drops the exponent letter for exponents with three digits
+   if !strings.ContainsAny(fixed, "Ee") {
+      if k := strings.LastIndexAny(fixed, "+-"); k > 0 {
+         fixed = fixed[:k] + "E" + fixed[k:]
+      }
+   }
+
+   f, err2 := strconv.ParseFloat(fixed, 64)
+   if err2 != nil {
+      return 0, err
+   }
+
+   return f, nil
+
+}
+
+
+// split a row into values, keeping quoted strings with spaces as a single value
+func splitFields (line string) []string {
+
+   if !strings.Contains(line, "\"") {
+      return strings.Fields(line)
+   }
+
+   var fields []string
+   var current strings.Builder
+   inQuotes := false
+   hasField := false
+
+   for _, c := range line {
+      switch {
+      case c == '"':
+         inQuotes = !inQuotes
+         current.WriteRune(c)
+         hasField = true
+      case !inQuotes && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+         if hasField {
+            fields = append(fields, current.String())
+            current.Reset()
+            hasField = false
+         }
+      default:
+         current.WriteRune(c)
+         hasField = true
+      }
+   }
+   if hasField {
+      fields = append(fields, current.String())
+   }
+
+   return fields
+
+}
+
+
+// a row made only of consecutive integers starting at 1, which MESA writes above names
+func isIndexLine (fields []string) bool {
+
+   if len(fields) == 0 {
+      return false
+   }
+
+   for k, field := range fields {
+      if field != strconv.Itoa(k+1) {
+         return false
+      }
+   }
+
+   return true
+
+}
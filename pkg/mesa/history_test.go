@@ -0,0 +1,261 @@
+package mesa
+
+import (
+   "errors"
+   "math"
+   "os"
+   "path/filepath"
+   "strconv"
+   "strings"
+   "testing"
+)
+
+
+// write content as a file in dir
+func writeFile (t *testing.T, dir, name, content string) string {
+
+   t.Helper()
+
+   filename := filepath.Join(dir, name)
+   if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+   }
+
+   return filename
+
+}
+
+
+// all rows of a file, as lines & values
+func readRows (t *testing.T, filename string) ([]int, [][]string, error) {
+
+   t.Helper()
+
+   d, err := OpenDataFile(filename)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   var lines []int
+   var rows [][]string
+   err = d.Rows(func(line int, fields []string) error {
+      lines = append(lines, line)
+      rows = append(rows, fields)
+      return nil
+   })
+
+   return lines, rows, err
+
+}
+
+
+// header of a history as MESA writes it: index line, names, values with quoted strings, blank line
+const historyHeader = `                 1                  2                  3                  4
+    version_number           compiler               date       initial_mass
+        "r24.03.1"         "gfortran"   "Mon 19 Oct 2026"                 10
+
+                 1                  2                  3
+      model_number           star_age          star_mass
+`
+
+
+func TestOpenDataFile (t *testing.T) {
+
+   dir := t.TempDir()
+
+   d, err := OpenDataFile(writeFile(t, dir, "history.data", historyHeader + "1 0 10\n"))
+   if err != nil {
+      t.Fatal(err)
+   }
+   if got := strings.Join(d.HeaderNames, ","); got != "version_number,compiler,date,initial_mass" {
+      t.Errorf("got header names %s", got)
+   }
+   if got := strings.Join(d.HeaderValues, ","); got != `"r24.03.1","gfortran","Mon 19 Oct 2026",10` {
+      t.Errorf("got header values %s", got)
+   }
+   if got := strings.Join(d.Columns, ","); got != "model_number,star_age,star_mass" {
+      t.Errorf("got columns %s", got)
+   }
+   if offset, line := d.DataStart(); offset != int64(len(historyHeader)) || line != 6 {
+      t.Errorf("data starts at %d, line %d", offset, line)
+   }
+
+   // quoted strings & release versions are read into fields
+   star := new(MESAstarInfo)
+   if err := assignFields(star, headerTag, d.HeaderNames, d.HeaderValues); err != nil {
+      t.Fatal(err)
+   }
+   if star.Version.Release != "r24.03.1" || star.Version.Number != 0 || star.Date != "Mon 19 Oct 2026" {
+      t.Errorf("got version %+v & date %q", star.Version, star.Date)
+   }
+
+   // layout of old files, without index lines
+   classic := "header\nversion_number initial_mass\n15140 10\n\n\nmodel_number star_age star_mass\n1 0 10\n"
+   d, err = OpenDataFile(writeFile(t, dir, "classic.data", classic))
+   if err != nil {
+      t.Fatal(err)
+   }
+   if strings.Join(d.HeaderValues, ",") != "15140,10" || len(d.Columns) != 3 {
+      t.Errorf("got header %v & columns %v", d.HeaderValues, d.Columns)
+   }
+
+   // column names still being written, or not there yet
+   for name, content := range map[string]string{
+      "partial.data": strings.TrimSuffix(historyHeader, "\n"),
+      "header.data": historyHeader[:strings.Index(historyHeader, "\n\n") + 2],
+   } {
+      if _, err := OpenDataFile(writeFile(t, dir, name, content)); !errors.Is(err, ErrNoColumns) {
+         t.Errorf("%s: got %v, want %v", name, err, ErrNoColumns)
+      }
+   }
+
+   if _, err := OpenDataFile(filepath.Join(dir, "missing.data")); err == nil {
+      t.Error("opening a missing file did not fail")
+   }
+
+}
+
+
+func TestDataFileRows (t *testing.T) {
+
+   dir := t.TempDir()
+
+   cases := []struct {
+      name string
+      rows string
+      lines string
+      err int
+   }{
+      {"complete rows", "1 0 10\n2 1e5 9.9\n", "7 8", 0},
+      {"blank lines skipped", "1 0 10\n\n2 1e5 9.9\n", "7 9", 0},
+      {"partial last row", "1 0 10\n2 1e5 9.9\n3 2e5", "7 8", 0},
+      {"short last row", "1 0 10\n2 1e5 9.9\n3 2e5\n", "7 8", 0},
+      {"short interior row", "1 0 10\n2 1e5\n3 2e5 9.8\n", "7", 8},
+   }
+
+   for _, c := range cases {
+      t.Run(c.name, func(t *testing.T) {
+
+         lines, _, err := readRows(t, writeFile(t, dir, "history.data", historyHeader + c.rows))
+
+         var got []string
+         for _, line := range lines {
+            got = append(got, strconv.Itoa(line))
+         }
+         if strings.Join(got, " ") != c.lines {
+            t.Errorf("got rows at lines %v, want %s", got, c.lines)
+         }
+
+         if c.err == 0 {
+            if err != nil {
+               t.Errorf("got error %v", err)
+            }
+            return
+         }
+         var parseErr *ParseError
+         if !errors.As(err, &parseErr) || !errors.Is(err, ErrShortRow) || parseErr.Line != c.err {
+            t.Errorf("got error %v, want %v at line %d", err, ErrShortRow, c.err)
+         }
+
+      })
+   }
+
+   // the last row is the last complete one
+   d, err := OpenDataFile(writeFile(t, dir, "last.data", historyHeader + "1 0 10\n2 1e5 9.9\n3 2e5\n4 3e5 9"))
+   if err != nil {
+      t.Fatal(err)
+   }
+   if row, err := d.LastRow(); err != nil || strings.Join(row, " ") != "2 1e5 9.9" {
+      t.Errorf("got last row %v, %v", row, err)
+   }
+
+   // values as Fortran writes them are read in columns
+   filename := writeFile(t, dir, "fortran.data", historyHeader + "1 0.0D+00 1.0D+01\n2 1.5-300 NaN\n3 Infinity 9.9E-01\n")
+   data, err := ReadHistoryColumns(filename, "star_age", "star_mass")
+   if err != nil {
+      t.Fatal(err)
+   }
+   age, mass := data["star_age"], data["star_mass"]
+   if len(age) != 3 || age[1] != 1.5e-300 || !math.IsInf(age[2], 1) || mass[0] != 10 || !math.IsNaN(mass[1]) || mass[2] != 0.99 {
+      t.Errorf("got ages %v & masses %v", age, mass)
+   }
+
+}
+
+
+func TestParseValue (t *testing.T) {
+
+   cases := []struct {
+      raw string
+      want float64
+   }{
+      {"1.5", 1.5},
+      {"-2.5E+03", -2500},
+      {"1.0D+00", 1},
+      {"2.5d-3", 2.5e-3},
+      {"1.0-300", 1e-300},
+      {"-1.5+300", -1.5e300},
+      {"7.0-100", 7e-100},
+      {`"3.5"`, 3.5},
+      {"'42'", 42},
+      {"Infinity", math.Inf(1)},
+      {"-Infinity", math.Inf(-1)},
+      {"+Inf", math.Inf(1)},
+   }
+
+   for _, c := range cases {
+      got, err := ParseValue(c.raw)
+      if err != nil || got != c.want {
+         t.Errorf("ParseValue(%q) = %g, %v, want %g", c.raw, got, err, c.want)
+      }
+   }
+
+   for _, raw := range []string{"NaN", "nan", `"NaN"`} {
+      if got, err := ParseValue(raw); err != nil || !math.IsNaN(got) {
+         t.Errorf("ParseValue(%q) = %g, %v, want NaN", raw, got, err)
+      }
+   }
+
+   for _, raw := range []string{"***", "", "star", "1.0-+3"} {
+      if got, err := ParseValue(raw); err == nil {
+         t.Errorf("ParseValue(%q) = %g, want an error", raw, got)
+      }
+   }
+
+}
+
+
+func TestMESAVersion (t *testing.T) {
+
+   cases := []struct {
+      raw string
+      number int
+      release string
+   }{
+      {"15140", 15140, ""},
+      {`"r23.05.1"`, 0, "r23.05.1"},
+      {"r24.03.1", 0, "r24.03.1"},
+      {`"12778"`, 12778, ""},
+   }
+
+   for _, c := range cases {
+      var v MESAVersion
+      if err := v.UnmarshalText([]byte(c.raw)); err != nil || v.Number != c.number || v.Release != c.release {
+         t.Errorf("version %s: got %+v, %v", c.raw, v, err)
+         continue
+      }
+
+      // written back as in history headers
+      text, _ := v.MarshalText()
+      var again MESAVersion
+      if err := again.UnmarshalText(text); err != nil || again != v {
+         t.Errorf("version %s: %s read back as %+v, %v", c.raw, text, again, err)
+      }
+   }
+
+   var v MESAVersion
+   if err := v.UnmarshalText([]byte(`""`)); err == nil {
+      t.Error("empty version accepted")
+   }
+
+}
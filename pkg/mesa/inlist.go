@@ -0,0 +1,525 @@
+package mesa
+
+import (
+   "fmt"
+   "io/ioutil"
+   "path/filepath"
+   "regexp"
+   "sort"
+   "strconv"
+   "strings"
+)
+
+
+// namelists of the inlists of a star, read from the inlist of the run or from inlist_names of
+// binary_job in binary runs
+var starNamelists = []string{"star_job", "eos", "kap", "controls", "pgstar"}
+
+// namelists of a binary, read from the inlist of the run
+var binaryNamelists = []string{"binary_job", "binary_controls", "binary_pgstar"}
+
+// inlists of each star in binary runs, unless set in binary_job
+var defaultStarInlists = []string{"inlist1", "inlist2"}
+
+// order namelists are shown in, others go after these
+var namelistOrder = []string{"star_job", "controls", "binary_controls", "binary_job", "eos", "kap", "pgstar", "binary_pgstar"}
+
+// MESA reads at most this many extra inlists for each namelist, nested no deeper than this
+const maxExtraInlists = 5
+const maxInlistDepth = 10
+
+// start of an assignment inside a namelist: name, maybe with array index, followed by "="
+var inlistAssignment = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_%]*\s*(\([^()=]*\))?)\s*=`)
+
+// extra inlists, as in MESA >= r15140 (read_extra_controls_inlist(1)) & before it
+// (read_extra_controls_inlist1)
+var extraInlistFlag = regexp.MustCompile(`^read_extra_([a-z_]+)_inlist\(?(\d)\)?$`)
+
+
+// value set to a control & the file where that was done
+type InlistValue struct {
+   Value string
+   File string
+}
+
+
+// values set in a namelist, after reading all its extra inlists. Star is 1 or 2 for namelists of
+// the stars of binary runs, 0 otherwise
+type Namelist struct {
+   Name string
+   Star int
+   Values map[string]InlistValue
+}
+
+
+// title of a namelist, telling the star it belongs to in binaries
+func (n *Namelist) Title () string {
+
+   if n.Star > 0 {
+      return fmt.Sprintf("%s (star %d)", n.Name, n.Star)
+   }
+
+   return n.Name
+
+}
+
+
+// effective controls of a run, as MESA reads them from its inlists
+type Inlist struct {
+   RootDir string
+   IsBinary bool
+   Files []string
+   Namelists []Namelist
+}
+
+
+// namelist with a name, for star 0 (single stars or binary namelists), 1 or 2. nil if not found
+func (in *Inlist) Namelist (name string, star int) *Namelist {
+
+   for k := range in.Namelists {
+      if in.Namelists[k].Name == name && in.Namelists[k].Star == star {
+         return &in.Namelists[k]
+      }
+   }
+
+   return nil
+
+}
+
+
+// reads namelists of inlists, parsing each file once
+type inlistReader struct {
+   dir string
+   files map[string]map[string]map[string]string
+   order []string
+}
+
+
+// effective controls of the run in m.RootDir
+func (m *MESAInfo) LoadInlist () (*Inlist, error) {
+
+   return LoadInlist(m.RootDir)
+
+}
+
+
+// read the inlist of a run in rootDir, following extra inlists of each namelist as MESA does.
+// runs with a binary_job namelist are binaries, with star namelists read from their inlist_names
+func LoadInlist (rootDir string) (*Inlist, error) {
+
+   r := &inlistReader{dir: rootDir, files: make(map[string]map[string]map[string]string)}
+   in := &Inlist{RootDir: rootDir}
+
+   top, err := r.parse(inlistName)
+   if err != nil {
+      return nil, err
+   }
+
+   var starInlists []string
+   if _, ok := top["binary_job"]; ok {
+      in.IsBinary = true
+      for _, name := range binaryNamelists {
+         if _, ok := top[name]; !ok {
+            continue
+         }
+         values, err := r.namelist(inlistName, name, 0)
+         if err != nil {
+            return nil, err
+         }
+         in.Namelists = append(in.Namelists, Namelist{Name: name, Values: values})
+      }
+      starInlists = append(starInlists, defaultStarInlists...)
+      if job := in.Namelist("binary_job", 0); job != nil {
+         for k := range starInlists {
+            if v, ok := job.Values[fmt.Sprintf("inlist_names(%d)", k + 1)]; ok {
+               starInlists[k] = unquote(v.Value)
+            }
+         }
+      }
+   } else {
+      starInlists = []string{inlistName}
+   }
+
+   for k, file := range starInlists {
+      star := 0
+      if in.IsBinary {
+         star = k + 1
+      }
+      blocks, err := r.parse(file)
+      if err != nil {
+         // point masses have no inlist
+         if in.IsBinary {
+            continue
+         }
+         return nil, err
+      }
+      for _, name := range starNamelists {
+         if _, ok := blocks[name]; !ok {
+            continue
+         }
+         values, err := r.namelist(file, name, 0)
+         if err != nil {
+            return nil, err
+         }
+         in.Namelists = append(in.Namelists, Namelist{Name: name, Star: star, Values: values})
+      }
+   }
+
+   in.Files = r.order
+
+   return in, nil
+
+}
+
+
+// values of a namelist in a file, overridden by those of its extra inlists
+func (r *inlistReader) namelist (file, name string, depth int) (map[string]InlistValue, error) {
+
+   if depth > maxInlistDepth {
+      return nil, fmt.Errorf("extra inlists of %s nested too deep in %s", name, file)
+   }
+
+   blocks, err := r.parse(file)
+   if err != nil {
+      return nil, err
+   }
+
+   values := make(map[string]InlistValue)
+   extras := make([]string, maxExtraInlists + 1)
+   for key, value := range blocks[name] {
+      if match := extraInlistFlag.FindStringSubmatch(key); match != nil && match[1] == name {
+         k, _ := strconv.Atoi(match[2])
+         if k <= maxExtraInlists && normalizeInlistValue(value) == ".true." {
+            extras[k] = extraInlistName(blocks[name], name, k)
+         }
+         continue
+      }
+      if strings.HasPrefix(key, "extra_" + name + "_inlist") {
+         continue
+      }
+      values[key] = InlistValue{Value: value, File: file}
+   }
+
+   for _, extra := range extras {
+      if extra == "" {
+         continue
+      }
+      more, err := r.namelist(extra, name, depth + 1)
+      if err != nil {
+         return nil, err
+      }
+      for key, value := range more {
+         values[key] = value
+      }
+   }
+
+   return values, nil
+
+}
+
+
+// name of the extra inlist k of a namelist, with either naming of MESA versions
+func extraInlistName (values map[string]string, name string, k int) string {
+
+   for _, key := range []string{
+      fmt.Sprintf("extra_%s_inlist_name(%d)", name, k),
+      fmt.Sprintf("extra_%s_inlist%d_name", name, k),
+   } {
+      if v, ok := values[key]; ok {
+         return unquote(v)
+      }
+   }
+
+   return ""
+
+}
+
+
+// namelists of a file, with names of controls in lowercase. parsed only once
+func (r *inlistReader) parse (file string) (map[string]map[string]string, error) {
+
+   if blocks, ok := r.files[file]; ok {
+      return blocks, nil
+   }
+
+   filename := file
+   if !filepath.IsAbs(filename) {
+      filename = filepath.Join(r.dir, file)
+   }
+   raw, err := ioutil.ReadFile(filename)
+   if err != nil {
+      return nil, err
+   }
+
+   blocks, err := ParseNamelists(string(raw))
+   if err != nil {
+      return nil, &ParseError{File: filename, Err: err}
+   }
+   r.files[file] = blocks
+   r.order = append(r.order, file)
+
+   return blocks, nil
+
+}
+
+
+// parse the namelists of a Fortran inlist: "&name", assignments, and "/" closing it. values are
+// kept as written, except for their comments
+func ParseNamelists (text string) (map[string]map[string]string, error) {
+
+   blocks := make(map[string]map[string]string)
+
+   var body strings.Builder
+   current := ""
+
+   for _, line := range strings.Split(text, "\n") {
+
+      line = stripInlistComment(line)
+      masked := maskQuoted(line)
+
+      for line != "" {
+         if current == "" {
+            k := strings.Index(masked, "&")
+            if k < 0 {
+               break
+            }
+            rest := strings.TrimLeft(masked[k+1:], " \t")
+            end := strings.IndexAny(rest, " \t/")
+            if end < 0 {
+               end = len(rest)
+            }
+            current = strings.ToLower(rest[:end])
+            if current == "" {
+               return nil, fmt.Errorf("namelist without name")
+            }
+            skip := len(masked) - len(rest) + end
+            line, masked = line[skip:], masked[skip:]
+            body.Reset()
+            continue
+         }
+
+         k := strings.IndexByte(masked, '/')
+         if k < 0 {
+            body.WriteString(line + "\n")
+            break
+         }
+         body.WriteString(line[:k])
+         blocks[current] = parseAssignments(body.String(), blocks[current])
+         current = ""
+         line, masked = line[k+1:], masked[k+1:]
+      }
+
+   }
+
+   if current != "" {
+      return nil, fmt.Errorf("namelist %s is not closed with /", current)
+   }
+
+   return blocks, nil
+
+}
+
+
+// assignments inside a namelist, adding them to values. later ones replace earlier ones
+func parseAssignments (body string, values map[string]string) map[string]string {
+
+   if values == nil {
+      values = make(map[string]string)
+   }
+
+   masked := maskQuoted(body)
+   matches := inlistAssignment.FindAllStringSubmatchIndex(masked, -1)
+   for k, match := range matches {
+      end := len(body)
+      if k + 1 < len(matches) {
+         end = matches[k+1][0]
+      }
+      key := strings.ToLower(strings.Join(strings.Fields(body[match[2]:match[3]]), ""))
+      value := strings.TrimSpace(body[match[1]:end])
+      value = strings.TrimSpace(strings.TrimRight(value, ", \t\n"))
+      values[key] = value
+   }
+
+   return values
+
+}
+
+
+// line without its "!" comment, if not inside quotes
+func stripInlistComment (line string) string {
+
+   if k := strings.IndexByte(maskQuoted(line), '!'); k >= 0 {
+      return line[:k]
+   }
+
+   return line
+
+}
+
+
+// text with characters inside quotes replaced, so that "=", "!" or "/" in strings are not seen
+func maskQuoted (text string) string {
+
+   masked := []byte(text)
+   var quote byte
+   for k := 0; k < len(masked); k++ {
+      c := masked[k]
+      switch {
+      case quote == 0 && (c == '\'' || c == '"'):
+         quote = c
+      case quote != 0 && c == quote:
+         quote = 0
+      case quote != 0:
+         masked[k] = '_'
+      }
+   }
+
+   return string(masked)
+
+}
+
+
+// value without quotes
+func unquote (value string) string {
+
+   value = strings.TrimSpace(value)
+   if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+      return strings.ReplaceAll(value[1:len(value)-1], string(value[0]) + string(value[0]), string(value[0]))
+   }
+
+   return value
+
+}
+
+
+// value written in a single way, so that 1d-3 & 0.001 or .TRUE. & .true. compare equal
+func normalizeInlistValue (value string) string {
+
+   var parts []string
+   for _, part := range splitInlistValues(value) {
+      part = strings.TrimSpace(part)
+      lower := strings.ToLower(part)
+      switch {
+      case part == "":
+      case part[0] == '\'' || part[0] == '"':
+         part = "'" + unquote(part) + "'"
+      case lower == ".true." || lower == ".t." || lower == "t" || lower == "true":
+         part = ".true."
+      case lower == ".false." || lower == ".f." || lower == "f" || lower == "false":
+         part = ".false."
+      default:
+         if v, err := ParseValue(part); err == nil {
+            part = strconv.FormatFloat(v, 'g', -1, 64)
+         }
+      }
+      parts = append(parts, part)
+   }
+
+   return strings.Join(parts, ", ")
+
+}
+
+
+// values of a list separated by commas, outside quotes
+func splitInlistValues (value string) []string {
+
+   masked := maskQuoted(value)
+
+   var parts []string
+   start := 0
+   for k := 0; k < len(masked); k++ {
+      if masked[k] == ',' {
+         parts = append(parts, value[start:k])
+         start = k + 1
+      }
+   }
+
+   return append(parts, value[start:])
+
+}
+
+
+// a control set differently in some runs. Values has the one of each run, empty when not set (i.e.
+// left to its default)
+type InlistDiff struct {
+   Namelist string
+   Star int
+   Control string
+   Values []string
+}
+
+
+// controls that differ between runs, grouped by namelist & sorted by name. with all, every control
+// set in some run is returned
+func DiffInlists (inlists []*Inlist, all bool) []InlistDiff {
+
+   type group struct {
+      name string
+      star int
+   }
+
+   controls := make(map[group]map[string]bool)
+   for _, in := range inlists {
+      for _, nl := range in.Namelists {
+         g := group{nl.Name, nl.Star}
+         if controls[g] == nil {
+            controls[g] = make(map[string]bool)
+         }
+         for key := range nl.Values {
+            controls[g][key] = true
+         }
+      }
+   }
+
+   var diffs []InlistDiff
+   for g, keys := range controls {
+      for key := range keys {
+         values := make([]string, len(inlists))
+         differ := false
+         for k, in := range inlists {
+            if nl := in.Namelist(g.name, g.star); nl != nil {
+               if v, ok := nl.Values[key]; ok {
+                  values[k] = v.Value
+               }
+            }
+            if normalizeInlistValue(values[k]) != normalizeInlistValue(values[0]) {
+               differ = true
+            }
+         }
+         if differ || all {
+            diffs = append(diffs, InlistDiff{Namelist: g.name, Star: g.star, Control: key, Values: values})
+         }
+      }
+   }
+
+   sort.Slice(diffs, func(i, j int) bool {
+      a, b := namelistRank(diffs[i].Namelist), namelistRank(diffs[j].Namelist)
+      if a != b {
+         return a < b
+      }
+      if diffs[i].Namelist != diffs[j].Namelist {
+         return diffs[i].Namelist < diffs[j].Namelist
+      }
+      if diffs[i].Star != diffs[j].Star {
+         return diffs[i].Star < diffs[j].Star
+      }
+      return diffs[i].Control < diffs[j].Control
+   })
+
+   return diffs
+
+}
+
+
+// position of a namelist in namelistOrder, unknown ones last
+func namelistRank (name string) int {
+
+   for k, n := range namelistOrder {
+      if n == name {
+         return k
+      }
+   }
+
+   return len(namelistOrder)
+
+}
@@ -0,0 +1,221 @@
+package mesa
+
+import (
+   "path/filepath"
+   "strings"
+   "testing"
+)
+
+
+func TestParseNamelists (t *testing.T) {
+
+   text := `! inlist of a test run
+&Star_Job ! comment after the name
+   Create_Pre_Main_Sequence_Model = .TRUE.
+   save_model_filename = 'end/final.mod' ! written at the end
+   pgstar_flag = T
+/ ! end of star_job
+
+&controls
+   initial_mass = 15d0, initial_z = 0.02 ! two on a line
+   log_directory = "LOGS!1"
+   x_ctrl(1) = 1.5
+   X_CTRL( 2 ) = 2
+   ! commented_out = 1
+   history_interval = 1
+   history_interval = 5
+   star_history_name = 'it''s.data' /
+`
+
+   blocks, err := ParseNamelists(text)
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   want := map[string]map[string]string{
+      "star_job": {
+         "create_pre_main_sequence_model": ".TRUE.",
+         "save_model_filename": "'end/final.mod'",
+         "pgstar_flag": "T",
+      },
+      "controls": {
+         "initial_mass": "15d0",
+         "initial_z": "0.02",
+         "log_directory": `"LOGS!1"`,
+         "x_ctrl(1)": "1.5",
+         "x_ctrl(2)": "2",
+         "history_interval": "5",
+         "star_history_name": "'it''s.data'",
+      },
+   }
+   for name, values := range want {
+      got := blocks[name]
+      if len(got) != len(values) {
+         t.Errorf("%s: got %v, want %v", name, got, values)
+         continue
+      }
+      for key, value := range values {
+         if got[key] != value {
+            t.Errorf("%s: got %s = %q, want %q", name, key, got[key], value)
+         }
+      }
+   }
+   if unquote(blocks["controls"]["star_history_name"]) != "it's.data" {
+      t.Errorf("got name %q", unquote(blocks["controls"]["star_history_name"]))
+   }
+
+   for _, bad := range []string{"&controls\n   initial_mass = 15\n", "& \n/\n"} {
+      if _, err := ParseNamelists(bad); err == nil {
+         t.Errorf("parsed %q", bad)
+      }
+   }
+
+}
+
+
+// extra inlists override the values of the inlist reading them, with both namings of MESA versions
+func TestLoadInlist (t *testing.T) {
+
+   dir := t.TempDir()
+   writeFile(t, dir, "inlist", `&star_job
+   read_extra_star_job_inlist1 = .true.
+   extra_star_job_inlist1_name = 'inlist_project'
+/
+&controls
+   Read_Extra_Controls_Inlist(1) = T
+   Extra_Controls_Inlist_Name(1) = "inlist_project"
+   initial_mass = 10
+/
+`)
+   writeFile(t, dir, "inlist_project", `&star_job
+   pgstar_flag = .false.
+/
+&controls
+   read_extra_controls_inlist2 = .true.
+   extra_controls_inlist2_name = 'inlist_mass'
+   initial_z = 0.014
+   mixing_length_alpha = 2
+/
+`)
+   writeFile(t, dir, "inlist_mass", "&controls\n   INITIAL_MASS = 20d0 ! this one wins\n/\n")
+
+   in, err := LoadInlist(dir)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if in.IsBinary || strings.Join(in.Files, " ") != "inlist inlist_project inlist_mass" {
+      t.Errorf("got binary %v & files %v", in.IsBinary, in.Files)
+   }
+
+   controls := in.Namelist("controls", 0)
+   if controls == nil {
+      t.Fatal("no controls")
+   }
+   for key, want := range map[string]InlistValue{
+      "initial_mass": {"20d0", "inlist_mass"},
+      "initial_z": {"0.014", "inlist_project"},
+      "mixing_length_alpha": {"2", "inlist_project"},
+   } {
+      if got := controls.Values[key]; got != want {
+         t.Errorf("got %s = %+v, want %+v", key, got, want)
+      }
+   }
+   for key := range controls.Values {
+      if strings.Contains(key, "extra_controls_inlist") {
+         t.Errorf("flag %s kept among the controls", key)
+      }
+   }
+   if job := in.Namelist("star_job", 0); job == nil || job.Values["pgstar_flag"].File != "inlist_project" {
+      t.Errorf("got star_job %+v", job)
+   }
+
+   // an extra inlist that is not there
+   writeFile(t, dir, "inlist_mass", "&controls\n   read_extra_controls_inlist1 = .true.\n   extra_controls_inlist1_name = 'inlist_missing'\n/\n")
+   if _, err := LoadInlist(dir); err == nil || !strings.Contains(err.Error(), "inlist_missing") {
+      t.Errorf("got %v reading a missing extra inlist", err)
+   }
+
+}
+
+
+// binary runs read the inlist of each star from inlist_names, point masses have none
+func TestLoadInlistBinary (t *testing.T) {
+
+   dir := t.TempDir()
+   writeFile(t, dir, "inlist", `&binary_job
+   inlist_names(1) = 'inlist_donor'
+   inlist_names(2) = 'inlist_accretor'
+   evolve_both_stars = .false.
+/
+&binary_controls
+   initial_period_in_days = 5
+/
+`)
+   writeFile(t, dir, "inlist_donor", "&star_job\n/\n&controls\n   initial_mass = 30\n/\n")
+
+   in, err := LoadInlist(dir)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if !in.IsBinary {
+      t.Error("binary run not seen as such")
+   }
+   if nl := in.Namelist("binary_controls", 0); nl == nil || nl.Values["initial_period_in_days"].Value != "5" {
+      t.Errorf("got binary_controls %+v", nl)
+   }
+   if nl := in.Namelist("controls", 1); nl == nil || nl.Values["initial_mass"].Value != "30" || nl.Values["initial_mass"].File != "inlist_donor" {
+      t.Errorf("got controls of star 1 %+v", nl)
+   }
+   if nl := in.Namelist("controls", 2); nl != nil {
+      t.Errorf("got controls of a point mass %+v", nl)
+   }
+
+   if _, err := LoadInlist(filepath.Join(dir, "missing")); err == nil {
+      t.Error("loaded the inlist of a missing run")
+   }
+
+}
+
+
+// values written differently but equal are not reported as changed
+func TestDiffInlists (t *testing.T) {
+
+   inlist := func(values map[string]string) *Inlist {
+      nl := Namelist{Name: "controls", Values: make(map[string]InlistValue)}
+      for key, value := range values {
+         nl.Values[key] = InlistValue{Value: value, File: "inlist"}
+      }
+      return &Inlist{Namelists: []Namelist{nl}}
+   }
+
+   a := inlist(map[string]string{
+      "initial_mass": "15",
+      "initial_z": "1d-3",
+      "do_element_diffusion": ".TRUE.",
+      "log_directory": "'LOGS'",
+      "x_ctrl(1)": "1, 2",
+      "mesh_delta_coeff": "1",
+   })
+   b := inlist(map[string]string{
+      "initial_mass": "15.0d0",
+      "initial_z": "0.001",
+      "do_element_diffusion": "T",
+      "log_directory": `"LOGS"`,
+      "x_ctrl(1)": "1.0,2.0",
+      "mesh_delta_coeff": "0.5",
+      "max_age": "1e10",
+   })
+
+   var got []string
+   for _, d := range DiffInlists([]*Inlist{a, b}, false) {
+      got = append(got, d.Control + "=" + strings.Join(d.Values, "|"))
+   }
+   if strings.Join(got, " ") != "max_age=|1e10 mesh_delta_coeff=1|0.5" {
+      t.Errorf("got diffs %v", got)
+   }
+
+   if all := DiffInlists([]*Inlist{a, b}, true); len(all) != 7 {
+      t.Errorf("got %d controls with all, want 7", len(all))
+   }
+
+}
@@ -2,11 +2,8 @@
 package mesa
 
 import (
-   "bufio"
    "fmt"
    "os"
-   "strconv"
-   "strings"
 
    "web-service/pkg/io"
 )
@@ -20,36 +17,55 @@ var star1LogDirectory = "LOGS1"
 var star2LogDirectory = "LOGS2"
 
 
-// struct holding info on MESAstar
+// struct holding info on MESAstar. tags map MESA history names (and their aliases) into fields
 type MESAstarInfo struct {
-   Version int
-   Date string
+   Version MESAVersion `header:"version_number"`
+   Date string `header:"date"`
    HistoryName string
-   ModelNumber int
-   NumZones int
-   Mass float64
-   LogMdot float64
-   Age float64
-   CenterH1, CenterHe4 float64
-   LogTcntr float64
-   NumRetries, NumIters int
-   ElapsedTime float64
+   ModelNumber int `column:"model_number"`
+   NumZones int `column:"num_zones"`
+   Mass float64 `column:"star_mass"`
+   LogMdot float64 `column:"log_abs_mdot"`
+   Age float64 `column:"star_age"`
+   CenterH1 float64 `column:"center_h1"`
+   CenterHe4 float64 `column:"center_he4"`
+   LogTcntr float64 `column:"log_center_T"`
+   NumRetries int `column:"num_retries"`
+   NumIters int `column:"num_iters"`
+   ElapsedTime float64 `column:"elapsed_time"`
    EvolState string
+   EvolStage EvolStage
+   EvolReason string
+   Thresholds *StageThresholds `json:"-"`
 }
 
 
-// struct holding info on MESAbinary
+// struct holding info on MESAbinary. tags map MESA history names (and their aliases) into fields
 type MESAbinaryInfo struct {
-   ModelNumber int
-   InitialDonorMass, InitialAccretorMass float64
-   InitialPeriod float64
-   Age float64
-   Star1Mass, Star2Mass float64
-   Period float64
+   ModelNumber int `column:"model_number"`
+   InitialDonorMass float64 `header:"initial_don_mass"`
+   InitialAccretorMass float64 `header:"initial_acc_mass"`
+   InitialPeriod float64 `header:"initial_period_days"`
+   Age float64 `column:"age"`
+   Star1Mass float64 `column:"star_1_mass"`
+   Star2Mass float64 `column:"star_2_mass"`
+   Period float64 `column:"period_days"`
    MTCase string
+   MT MTState
    HistoryName string
-   DonorIndex, PointMassIndex int
-   RelRLOF1, RelRLOF2 float64
+   DonorIndex int `column:"donor_index"`
+   PointMassIndex int `column:"point_mass_index"`
+   RelRLOF1 float64 `column:"rl_relative_overflow_1"`
+   RelRLOF2 float64 `column:"rl_relative_overflow_2"`
+   LogMTRate float64 `column:"lg_mtransfer_rate"`
+   Separation float64 `column:"binary_separation"`
+   Eccentricity float64 `column:"eccentricity"`
+   MassRatio float64
+   RL1, RL2 float64
+   OrbitalVelocity1, OrbitalVelocity2 float64
+   IsCompactBinary bool
+   MergerTime float64
+   ChirpMass float64
 }
 
 
@@ -64,13 +80,33 @@ type MESAInfo struct {
    Star2Info *MESAstarInfo
    Have2Stars bool
    IsBinaryEvolution bool
+   Timeline *Timeline
+   DataDir string
+   IsBin2dco bool
+   Bin2dco *Bin2dcoRun
+   Thresholds *Thresholds `json:"-"`
 }
 
 // get useful information of a MESA run
 func (m *MESAInfo) LoadMESAData () error {
    
+   // LOGS are found in RootDir, except for bin2dco runs which are split in stages, each with its own
+   // folder
+   m.DataDir = m.RootDir
+   m.IsBin2dco = IsBin2dco(m.RootDir)
+   if m.IsBin2dco {
+      run, err := LoadBin2dcoRun(m.RootDir, m.Thresholds.ForStage())
+      if err != nil {
+         io.LogError("MESA - mesa.go - LoadMESAData", "problem loading bin2dco run: " + err.Error())
+      }
+      m.Bin2dco = run
+      if stage := run.CurrentStage(); stage != nil {
+         m.DataDir = stage.Dir
+      }
+   }
+
    // find out if it is a binary or isolated evolution
-   m.IsBinaryEvolution = IsBinary(m.RootDir)
+   m.IsBinaryEvolution = IsBinary(m.DataDir)
 
    // get LOG names for either single or binary evolutions.
    // in the case of a single evolution, only star1LogName should not be empty
@@ -85,6 +121,32 @@ func (m *MESAInfo) LoadMESAData () error {
 
 }
 
+// load info of the binary when the run started, i.e. initial masses & period. these are found in
+// the header of the binary history, except for bin2dco runs where the first stage has them
+func (m *MESAInfo) LoadInitialBinaryData () (*MESAbinaryInfo, error) {
+
+   first := &MESAInfo{RootDir: m.RootDir, DataDir: m.DataDir, IsBinaryEvolution: m.IsBinaryEvolution}
+   if m.Bin2dco != nil && len(m.Bin2dco.Stages) > 0 {
+      first.DataDir = m.Bin2dco.Stages[0].Dir
+      first.IsBinaryEvolution = true
+   }
+   if !first.IsBinaryEvolution {
+      return nil, fmt.Errorf("%s is not a binary run", m.RootDir)
+   }
+
+   if first.DataDir == m.DataDir && m.BinaryFilename != "" {
+      first.BinaryFilename = m.BinaryFilename
+   } else if err := first.getLogNames(); err != nil {
+      return nil, err
+   }
+
+   b := &MESAbinaryInfo{HistoryName: first.BinaryFilename}
+   err := b.LoadMESAbinaryData()
+
+   return b, err
+
+}
+
 // return logs names from MESA folder
 func (m *MESAInfo) getLogNames () error {
 
@@ -98,10 +160,10 @@ func (m *MESAInfo) getLogNames () error {
 
       // search for binary output
       // use defaults values defined at beginning of module
-      binaryLogName = fmt.Sprintf("%s%s", m.RootDir, binaryHistoryName)
+      binaryLogName = fmt.Sprintf("%s%s", m.DataDir, binaryHistoryName)
       _, err := os.Stat(binaryLogName)
       if err != nil {
-         binaryLogName = fmt.Sprintf("%s%s/%s", m.RootDir, binaryLogDirectory, binaryHistoryName)
+         binaryLogName = fmt.Sprintf("%s%s/%s", m.DataDir, binaryLogDirectory, binaryHistoryName)
          _, err = os.Stat(binaryLogName)
          if err != nil {
             io.LogError("MESA - mesa.go - getLogNames", "cannot find binary LOG output file")
@@ -110,16 +172,16 @@ func (m *MESAInfo) getLogNames () error {
       io.LogInfo("MESA - mesa.go - getLogNames", "found binary output: " + binaryLogName)
 
       // now look for star 1 data
-      star1LogName = fmt.Sprintf("%s%s/%s", m.RootDir, starLogDirectory, starHistoryName)
+      star1LogName = fmt.Sprintf("%s%s/%s", m.DataDir, starLogDirectory, starHistoryName)
       _, err = os.Stat(star1LogName)
       if err != nil {
-         star1LogName = fmt.Sprintf("%s%s/%s", m.RootDir, star1LogDirectory, starHistoryName)
+         star1LogName = fmt.Sprintf("%s%s/%s", m.DataDir, star1LogDirectory, starHistoryName)
          _, err = os.Stat(star1LogName)
          if err != nil {
-            star1LogName = fmt.Sprintf("%s%s/%s", m.RootDir, star1LogDirectory, "primary_history.data")
+            star1LogName = fmt.Sprintf("%s%s/%s", m.DataDir, star1LogDirectory, "primary_history.data")
             _, err = os.Stat(star1LogName)
             if err != nil {
-               star1LogName = fmt.Sprintf("%s%s/%s", m.RootDir, "LOGS_companion", starHistoryName)
+               star1LogName = fmt.Sprintf("%s%s/%s", m.DataDir, "LOGS_companion", starHistoryName)
                _, err = os.Stat(star1LogName)
                if err != nil {
                   io.LogError("MESA - mesa.go - getLogNames", "cannot find star 1 LOG output file")
@@ -130,10 +192,10 @@ func (m *MESAInfo) getLogNames () error {
       io.LogInfo("MESA - mesa.go - getLogNames", "found star 1 output: " + star1LogName)
 
       // now look for star 2 data (though not always found if doing star + point-mass)
-      star2LogName = fmt.Sprintf("%s%s/%s", m.RootDir, star2LogDirectory, starHistoryName)
+      star2LogName = fmt.Sprintf("%s%s/%s", m.DataDir, star2LogDirectory, starHistoryName)
       _, err = os.Stat(star2LogName)
       if err != nil {
-         star2LogName = fmt.Sprintf("%s%s/%s", m.RootDir, star2LogDirectory, "secondary_history.data")
+         star2LogName = fmt.Sprintf("%s%s/%s", m.DataDir, star2LogDirectory, "secondary_history.data")
          _, err = os.Stat(star2LogName)
          if err != nil {
             io.LogInfo("MESA - mesa.go - getLogNames", "cannot find star 2 LOG output file. maybe doing star + point-mass evolution")
@@ -148,7 +210,7 @@ func (m *MESAInfo) getLogNames () error {
    } else {
 
       // only need to search for star1LogName
-      star1LogName = fmt.Sprintf("%s%s/%s", m.RootDir, starLogDirectory, starHistoryName)
+      star1LogName = fmt.Sprintf("%s%s/%s", m.DataDir, starLogDirectory, starHistoryName)
 
       _, err := os.Stat(star1LogName)
       if err != nil {
@@ -169,187 +231,27 @@ func (m *MESAInfo) getLogNames () error {
 
 // get useful information for the summary of a MESAstar run
 func (s *MESAstarInfo) LoadMESAstarData () error {
-   
-   // MESA specific row numbers for header names & values in history output
-   nr_header_names := 2
-   nr_header_values := 3
-   nr_column_names := 6
 
-    // open star file
-   fstar, err := os.Open(s.HistoryName)
+   header_names, header_values, column_names, column_values, err := readHistorySummary(s.HistoryName)
    if err != nil {
-      io.LogError("MESA - mesa.go - loadMESAstarData", "problem opening star data file")
-      return nil
-   }
-   defer fstar.Close()
-
-   // scan star file
-   scanner := bufio.NewScanner(fstar)
-
-   // arrays holding star header names & values
-   var header_names []string
-   var header_values []string
-   var header_names_found, header_values_found bool
-   var column_names []string
-   var column_values []string
-   var column_names_found bool
-   lineCount := 0
-
-   for scanner.Scan() {
-
-      lineCount++
-
-      // get header names
-      if lineCount == nr_header_names {
-         header_names = strings.Fields(scanner.Text())
-         header_names_found = true
-      }
-
-      // find header values
-      if lineCount == nr_header_values {
-         header_values = strings.Fields(scanner.Text())
-         header_values_found = true
-      }
-
-      if (header_names_found && header_values_found) {
-         for k, name := range header_names {
-            if name == "version_number" {
-               i, err := strconv.Atoi(strings.Split(header_values[k], "\"")[1])
-               // handle error
-               if err != nil {
-                  fmt.Println(err)
-                  return nil
-               }
-               s.Version = i
-            }
-            if name == "date" {s.Date = header_values[k]}
-         }
-      }
-
-      // get header names
-      if lineCount == nr_column_names {
-         column_names = strings.Fields(scanner.Text())
-         column_names_found = true
-      }
-
-      if column_names_found {
-         break
-      }
-
+      io.LogError("MESA - mesa.go - loadMESAstarData", "problem reading star data file: " + err.Error())
+      return err
    }
 
-   if (column_names_found) {
-      column_values = strings.Fields(GetLastLineWithSeek(s.HistoryName))
-
-      for k, name := range column_names {
-         val := column_values[k]
-         if name == "model_number" {
-            i, err := strconv.Atoi(val)
-            // handle error
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.ModelNumber = i
-         }
-         if name == "num_zones" {
-            i, err := strconv.Atoi(val)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.NumZones = i
-         }
-         if name == "star_mass" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.Mass = i
-         }
-         if name == "log_abs_mdot" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.LogMdot = i
-         }
-         if name == "star_age" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.Age = i
-         }
-         if name == "center_h1" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.CenterH1 = i
-         }
-         if name == "center_he4" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.CenterHe4 = i
-         }
-         if name == "log_center_T" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.LogTcntr = i
-         }
-         if name == "log_cntr_T" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.LogTcntr = i
-         }
-         if name == "num_retries" {
-            i, err := strconv.Atoi(val)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.NumRetries = i
-         }
-         if name == "num_iters" {
-            i, err := strconv.Atoi(val)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.NumIters = i
-         }
-         if name == "elapsed_time" {
-            i, err := strconv.ParseFloat(val, 64)  // i is in sec
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            s.ElapsedTime = i / 60 // from sec to min
-         }
-
-      }
+   // match header & last row values with struct fields, keeping track of every failure
+   var errs FieldErrors
+   errs = appendFieldErrors(errs, assignFields(s, headerTag, header_names, header_values))
+   errs = appendFieldErrors(errs, assignFields(s, columnTag, column_names, column_values))
 
-   }
+   // elapsed_time is in sec, but we show it in min
+   s.ElapsedTime = s.ElapsedTime / 60
 
-   s.EvolState = SetEvolutionaryStage(s.Mass, s.CenterH1, s.CenterHe4, s.LogTcntr)
+   s.EvolStage, s.EvolReason = ClassifyStage(stageInputFromRow(column_names, column_values), s.Thresholds)
+   s.EvolState = s.EvolStage.String()
 
-   if err := scanner.Err(); err != nil {
-      io.LogError("MESA - mesa.go - loadMESAstarData", "problem while scanning binary data file")
-      return nil
+   if len(errs) > 0 {
+      io.LogError("MESA - mesa.go - loadMESAstarData", "problem parsing star data file: " + errs.Error())
+      return errs
    }
 
    return nil
@@ -359,177 +261,54 @@ func (s *MESAstarInfo) LoadMESAstarData () error {
 // get useful information for the summary of a MESAbinary run
 func (b *MESAbinaryInfo) LoadMESAbinaryData () error {
 
-   // MESA specific row numbers for header names & values in history output
-   nr_header_names := 2
-   nr_header_values := 3
-   nr_column_names := 6
-
-   // open binary file
-   fbinary, err := os.Open(b.HistoryName)
+   header_names, header_values, column_names, column_values, err := readHistorySummary(b.HistoryName)
    if err != nil {
-      io.LogError("MESA - mesa.go - loadMESAbinaryData", "problem opening binary data file")
-      return nil
+      io.LogError("MESA - mesa.go - loadMESAbinaryData", "problem reading binary data file: " + err.Error())
+      return err
    }
-   defer fbinary.Close()
-
-   // scan star file
-   scanner := bufio.NewScanner(fbinary)
-
-   // arrays holding header, column names and values
-   var header_names []string
-   var header_values []string
-   var header_names_found, header_values_found bool
-   var column_names []string
-   var column_values []string
-   var column_names_found bool
-   lineCount := 0
 
-   for scanner.Scan() {
+   // match header & last row values with struct fields, keeping track of every failure
+   var errs FieldErrors
+   errs = appendFieldErrors(errs, assignFields(b, headerTag, header_names, header_values))
+   errs = appendFieldErrors(errs, assignFields(b, columnTag, column_names, column_values))
 
-      lineCount++
+   // separation, Roche lobes, velocities
+   b.SetOrbitalQuantities()
 
-      // get header names
-      if lineCount == nr_header_names {
-         header_names = strings.Fields(scanner.Text())
-         header_names_found = true
-      }
+   if len(errs) > 0 {
+      io.LogError("MESA - mesa.go - loadMESAbinaryData", "problem parsing binary data file: " + errs.Error())
+      return errs
+   }
 
-      // find header values
-      if lineCount == nr_header_values {
-         header_values = strings.Fields(scanner.Text())
-         header_values_found = true
-      }
+   return nil
 
-      if (header_names_found && header_values_found) {
-         for k, name := range header_names {
-            val := header_values[k]
-            if name == "initial_don_mass" {
-               i, err := strconv.ParseFloat(val, 64)  // i is in Msun
-               if err != nil {
-                  fmt.Println(err)
-                  return nil
-               }
-               b.InitialDonorMass = i
-            }
-            if name == "initial_acc_mass" {
-               i, err := strconv.ParseFloat(val, 64)  // i is in Msun
-               if err != nil {
-                  fmt.Println(err)
-                  return nil
-               }
-               b.InitialAccretorMass = i
-            }
-            if name == "initial_period_days" {
-               i, err := strconv.ParseFloat(val, 64)  // i is in days
-               if err != nil {
-                  fmt.Println(err)
-                  return nil
-               }
-               b.InitialPeriod = i
-            }
-         }
-      }
+}
 
-      // get column names
-      if lineCount == nr_column_names {
-         column_names = strings.Fields(scanner.Text())
-         column_names_found = true
-      }
+// read header names & values, column names and the values of the last complete row of a MESA
+// history file
+func readHistorySummary (filename string) ([]string, []string, []string, []string, error) {
 
-      // once row with column names is found, just exit loop
-      if column_names_found {
-         break
-      }
+   d, err := OpenDataFile(filename)
+   if err != nil {
+      return nil, nil, nil, nil, err
+   }
 
+   column_values, err := d.LastRow()
+   if err != nil {
+      return nil, nil, nil, nil, err
    }
 
-   // load last row of file and loop through it to match each column value with name
-   if (column_names_found) {
-      column_values = strings.Fields(GetLastLineWithSeek(b.HistoryName))
+   return d.HeaderNames, d.HeaderValues, d.Columns, column_values, nil
 
-      for k, name := range column_names {
-         val := column_values[k]
-         if name == "model_number" {
-            i, err := strconv.Atoi(val)
-            // handle error
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.ModelNumber = i
-         }
-         if name == "age" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.Age = i
-         }
-         if name == "period_days" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.Period = i
-         }
-         if name == "star_1_mass" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.Star1Mass = i
-         }
-         if name == "star_2_mass" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.Star2Mass = i
-         }
-         if name == "donor_index" {
-            i, err := strconv.Atoi(val)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.DonorIndex = i
-         }
-         if name == "point_mass_index" {
-            i, err := strconv.Atoi(val)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.PointMassIndex = i
-         }
-         if name == "rl_relative_overflow_1" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.RelRLOF1 = i
-         }
-         if name == "rl_relative_overflow_2" {
-            i, err := strconv.ParseFloat(val, 64)
-            if err != nil {
-               fmt.Println(err)
-               return nil
-            }
-            b.RelRLOF2 = i
-         }
-      }
-   }
+}
 
-   if err := scanner.Err(); err != nil {
-      io.LogError("MESA - mesa.go - loadMESAbinaryData", "problem while scanning binary data file")
-      return nil
+// add errors coming out of assignFields to a list of field errors
+func appendFieldErrors (errs FieldErrors, err error) FieldErrors {
+
+   if fieldErrs, ok := err.(FieldErrors); ok {
+      return append(errs, fieldErrs...)
    }
 
-   return nil
+   return errs
 
 }
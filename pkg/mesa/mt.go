@@ -0,0 +1,389 @@
+package mesa
+
+import (
+   "fmt"
+   "math"
+   "sort"
+   "strconv"
+   "strings"
+)
+
+
+// case of mass transfer, according to the phase of evolution of the donor
+type MTCase int
+
+const (
+   MTNone MTCase = iota
+   MTCaseA
+   MTCaseAB
+   MTCaseB
+   MTCaseBA
+   MTCaseBB
+   MTCaseC
+   MTUnknown
+)
+
+var mtCaseNames = map[MTCase]string{
+   MTNone: "No MT (R < RL)",
+   MTCaseA: "Case A",
+   MTCaseAB: "Case AB",
+   MTCaseB: "Case B",
+   MTCaseBA: "Case BA",
+   MTCaseBB: "Case BB",
+   MTCaseC: "Case C",
+   MTUnknown: "unknown MT case",
+}
+
+func (c MTCase) String() string {
+   if name, ok := mtCaseNames[c]; ok {
+      return name
+   }
+   return "MT case " + strconv.Itoa(int(c))
+}
+
+// cases are written by name in JSON
+func (c MTCase) MarshalText() ([]byte, error) {
+   return []byte(c.String()), nil
+}
+
+// and read back from it, e.g. when stored
+func (c *MTCase) UnmarshalText(text []byte) error {
+   for mtCase, name := range mtCaseNames {
+      if name == string(text) {
+         *c = mtCase
+         return nil
+      }
+   }
+   if n, err := strconv.Atoi(strings.TrimPrefix(string(text), "MT case ")); err == nil {
+      *c = MTCase(n)
+      return nil
+   }
+   return fmt.Errorf("unknown MT case %q", text)
+}
+
+
+// thresholds used to tell stable from unstable mass transfer
+type MTThresholds struct {
+   // log10 of mass transfer rate (Msun/yr) above which MT is considered dynamically unstable
+   UnstableLogMdot float64
+   // log10 of mass transfer rate (Msun/yr) above which a common envelope is assumed to start
+   CELogMdot float64
+}
+
+// thresholds used when none are given
+var DefaultMTThresholds = MTThresholds{
+   UnstableLogMdot: -2,
+   CELogMdot: -1,
+}
+
+
+// values of a binary history row used to define a MT phase. columns not in history are NaN
+type MTInput struct {
+   ModelNumber float64 `column:"model_number"`
+   Age float64 `column:"age"`
+   DonorIndex float64 `column:"donor_index"`
+   RelRLOF1 float64 `column:"rl_relative_overflow_1"`
+   RelRLOF2 float64 `column:"rl_relative_overflow_2"`
+   LogMTRate float64 `column:"lg_mtransfer_rate"`
+   LogMdot1 float64 `column:"lg_mstar_dot_1"`
+   LogMdot2 float64 `column:"lg_mstar_dot_2"`
+}
+
+
+// input with every value unknown
+func NewMTInput () MTInput {
+
+   nan := math.NaN()
+   return MTInput{nan, nan, nan, nan, nan, nan, nan, nan}
+
+}
+
+
+// state of mass transfer in a binary at a given time
+type MTState struct {
+   Case MTCase
+   Donor int
+   Stable bool
+   Contact bool
+   CommonEnvelope bool
+   Reason string
+}
+
+func (s MTState) String() string {
+
+   if s.Case == MTNone {
+      return s.Case.String()
+   }
+
+   str := s.Case.String()
+   switch {
+   case s.CommonEnvelope:
+      str += " (common envelope)"
+   case s.Contact:
+      str += " (contact)"
+   case s.Stable:
+      str += " (stable)"
+   default:
+      str += " (unstable)"
+   }
+
+   return str
+
+}
+
+
+// keeps track of previous MT episodes of each star, which are needed to tell Case AB & BB apart
+type MTClassifier struct {
+   Thresholds *MTThresholds
+   hadCaseA [3]bool
+   hadCaseB [3]bool
+}
+
+
+// define MT state at one step of evolution, given the stage of both stars. steps must be given in
+// order of evolution
+func (c *MTClassifier) Step (in MTInput, stage1, stage2 EvolStage) MTState {
+
+   t := c.Thresholds
+   if t == nil {
+      t = &DefaultMTThresholds
+   }
+
+   overflow1 := isKnown(in.RelRLOF1) && in.RelRLOF1 > 0
+   overflow2 := isKnown(in.RelRLOF2) && in.RelRLOF2 > 0
+
+   state := MTState{Contact: overflow1 && overflow2}
+
+   // donor is the star overflowing its RL, favour the one MESA says is the donor
+   donor := 0
+   if isKnown(in.DonorIndex) {
+      donor = int(in.DonorIndex)
+   }
+   if (donor == 1 && !overflow1) || (donor == 2 && !overflow2) || (donor != 1 && donor != 2) {
+      switch {
+      case overflow1:
+         donor = 1
+      case overflow2:
+         donor = 2
+      default:
+         donor = 0
+      }
+   }
+
+   if donor == 0 {
+      state.Case = MTNone
+      state.Stable = true
+      state.Reason = "no star overflows its Roche lobe"
+      return state
+   }
+   state.Donor = donor
+
+   stage := stage1
+   if donor == 2 {
+      stage = stage2
+   }
+
+   // case from stage of donor and its previous MT episodes
+   switch {
+   case stage.IsHBurning():
+      state.Case = MTCaseA
+      c.hadCaseA[donor] = true
+   case stage == StageHG || stage == StageRGB || stage == StageCHeB:
+      state.Case = MTCaseB
+      if c.hadCaseA[donor] {
+         state.Case = MTCaseAB
+      }
+      c.hadCaseB[donor] = true
+   case stage == StageStrippedHe:
+      // stripped star still burning He in its core
+      state.Case = MTCaseBA
+      c.hadCaseB[donor] = true
+   case stage.IsPostHe():
+      state.Case = MTCaseC
+      if c.hadCaseB[donor] || c.hadCaseA[donor] || stage == StageStrippedHeDepleted {
+         state.Case = MTCaseBB
+      }
+   default:
+      state.Case = MTUnknown
+   }
+   state.Reason = "star " + strconv.Itoa(donor) + " overflows its Roche lobe as " + stage.String()
+
+   // rate of MT, using mass loss of donor when transfer rate is not in history
+   logRate := in.LogMTRate
+   if !isKnown(logRate) {
+      logRate = in.LogMdot1
+      if donor == 2 {
+         logRate = in.LogMdot2
+      }
+   }
+
+   state.Stable = !isKnown(logRate) || logRate < t.UnstableLogMdot
+   if !state.Stable {
+      state.Reason += ", MT rate 10^" + formatValue(logRate) + " Msun/yr"
+   }
+
+   state.CommonEnvelope = (!state.Stable && state.Contact) || (isKnown(logRate) && logRate >= t.CELogMdot)
+   if state.Contact {
+      state.Reason += ", both stars overflow their Roche lobes"
+   }
+
+   return state
+
+}
+
+
+// MT input from the last row of a binary history
+func (b *MESAbinaryInfo) MTInput () MTInput {
+
+   in := NewMTInput()
+   in.ModelNumber = float64(b.ModelNumber)
+   in.Age = b.Age
+   in.DonorIndex = float64(b.DonorIndex)
+   in.RelRLOF1 = b.RelRLOF1
+   in.RelRLOF2 = b.RelRLOF2
+   if b.LogMTRate != 0 {
+      in.LogMTRate = b.LogMTRate
+   }
+
+   return in
+
+}
+
+
+// define MT state from a single binary history row, without knowing previous MT episodes. a nil t
+// uses DefaultMTThresholds
+func ClassifyMT (in MTInput, stage1, stage2 EvolStage, t *MTThresholds) MTState {
+
+   c := &MTClassifier{Thresholds: t}
+
+   return c.Step(in, stage1, stage2)
+
+}
+
+
+// check for MT case in a binary
+//
+// Deprecated: use ClassifyMT or ClassifyMTHistory, which tell stable from unstable MT and know
+// about Case AB & BB
+func SetMTCase(rel_rlof float64, stage string) string {
+
+   in := NewMTInput()
+   in.DonorIndex = 1
+   in.RelRLOF1 = rel_rlof
+
+   return ClassifyMT(in, stageFromName(stage), StageUnknown, nil).Case.String()
+
+}
+
+
+// stage matching a name as returned by EvolStage.String
+func stageFromName (name string) EvolStage {
+
+   for stage, stageName := range stageNames {
+      if stageName == name {
+         return stage
+      }
+   }
+
+   return StageUnknown
+
+}
+
+
+// change of stage of a star at a given model number
+type stagePoint struct {
+   ModelNumber int
+   Stage EvolStage
+}
+
+
+// stage of a star along its whole history, only keeping the models where it changes. rows are read
+// out of cache when not nil
+func readStageTrack (filename string, t *StageThresholds, cache *HistoryCache) ([]stagePoint, error) {
+
+   columns := append([]string{"model_number"}, tagNames(&StageInput{}, columnTag)...)
+
+   var track []stagePoint
+   err := cache.Rows(filename, columns, func(names []string, values []float64) error {
+      if len(names) == 0 || names[0] != "model_number" {
+         return &ParseError{File: filename, Err: fmt.Errorf("%w model_number", ErrUnknownColumn)}
+      }
+      number := int(values[0])
+
+      in := NewStageInput()
+      assignValues(&in, columnTag, names, values)
+      stage, _ := ClassifyStage(in, t)
+
+      // a restart from a photo goes back to earlier models, forget what came after them
+      for len(track) > 0 && track[len(track)-1].ModelNumber >= number {
+         track = track[:len(track)-1]
+      }
+
+      if len(track) == 0 || track[len(track)-1].Stage != stage {
+         track = append(track, stagePoint{ModelNumber: number, Stage: stage})
+      }
+      return nil
+   })
+
+   return track, err
+
+}
+
+
+// stage at a model number from a track
+func stageAt (track []stagePoint, model int) EvolStage {
+
+   k := sort.Search(len(track), func(i int) bool { return track[i].ModelNumber > model })
+   if k == 0 {
+      return StageUnknown
+   }
+
+   return track[k-1].Stage
+
+}
+
+
+// call fn with the MT state of every row of a binary history, matching each row with the stage of
+// both stars from their own histories. star histories might be empty (e.g. point masses). fn also
+// gets the values of the columns asked for besides those of MTInput, for callers needing more. rows
+// are read out of cache when not nil. a nil t uses the default thresholds
+func ScanMTHistory (binaryFile, star1File, star2File string, t *Thresholds, cache *HistoryCache, columns []string, fn func(names []string, values []float64, in MTInput, state MTState) error) error {
+
+   var tracks [2][]stagePoint
+   for k, name := range []string{star1File, star2File} {
+      if name == "" {
+         continue
+      }
+      track, err := readStageTrack(name, t.ForStage(), cache)
+      if err != nil {
+         return err
+      }
+      tracks[k] = track
+   }
+
+   c := &MTClassifier{Thresholds: t.ForMT()}
+   columns = append(tagNames(&MTInput{}, columnTag), columns...)
+
+   return cache.Rows(binaryFile, columns, func(names []string, values []float64) error {
+      in := NewMTInput()
+      assignValues(&in, columnTag, names, values)
+      model := int(in.ModelNumber)
+      state := c.Step(in, stageAt(tracks[0], model), stageAt(tracks[1], model))
+      return fn(names, values, in, state)
+   })
+
+}
+
+
+// MT state at the end of a binary history, taking into account all previous MT episodes
+func ClassifyMTHistory (binaryFile, star1File, star2File string, t *Thresholds, cache *HistoryCache) (MTState, error) {
+
+   var last MTState
+   err := ScanMTHistory(binaryFile, star1File, star2File, t, cache, nil, func(names []string, values []float64, in MTInput, state MTState) error {
+      last = state
+      return nil
+   })
+
+   return last, err
+
+}
@@ -0,0 +1,397 @@
+package mesa
+
+import (
+   "fmt"
+   "math"
+   "os"
+   "path/filepath"
+   "strings"
+   "testing"
+)
+
+
+// write a history file with MESA layout: index line, header names & values, blank line, index
+// line, column names & rows. NaN values are written as MESA does
+func writeHistory (t *testing.T, dir, name string, columns []string, rows [][]float64) string {
+
+   t.Helper()
+
+   index := func(n int) string {
+      fields := make([]string, n)
+      for k := range fields {
+         fields[k] = fmt.Sprint(k + 1)
+      }
+      return strings.Join(fields, " ")
+   }
+
+   var b strings.Builder
+   fmt.Fprintln(&b, index(1))
+   fmt.Fprintln(&b, "version_number")
+   fmt.Fprintln(&b, "\"r23.05.1\"")
+   fmt.Fprintln(&b)
+   fmt.Fprintln(&b, index(len(columns)))
+   fmt.Fprintln(&b, strings.Join(columns, " "))
+   for _, row := range rows {
+      fields := make([]string, len(row))
+      for k, v := range row {
+         fields[k] = fmt.Sprint(v)
+         if math.IsNaN(v) {
+            fields[k] = "NaN"
+         }
+      }
+      fmt.Fprintln(&b, strings.Join(fields, " "))
+   }
+
+   filename := filepath.Join(dir, name)
+   if err := os.WriteFile(filename, []byte(b.String()), 0644); err != nil {
+      t.Fatal(err)
+   }
+
+   return filename
+
+}
+
+
+// columns of synthetic star histories, after model_number
+var starColumns = []string{"model_number", "star_mass", "center_h1", "center_he4", "log_center_T", "surface_h1"}
+
+// values of a star history row at some phases of evolution
+var starPhases = map[EvolStage][]float64{
+   StageMS: {10, 0.5, 0.48, 7.4, 0.7},
+   StageHG: {9, 1e-6, 0.98, 7.6, 0.7},
+   StageCHeB: {8, 1e-6, 0.5, 8.1, 0.7},
+   StageStrippedHe: {5, 1e-6, 0.5, 8.1, 0.01},
+   StageStrippedHeDepleted: {4, 1e-6, 1e-6, 8.5, 0.01},
+   StageCoreCBurning: {6, 1e-6, 1e-6, 8.9, 0.7},
+}
+
+
+// star history going through a phase of evolution at each model, starting at model 1
+func writeStarHistory (t *testing.T, dir, name string, stages []EvolStage) string {
+
+   t.Helper()
+
+   var rows [][]float64
+   for k, stage := range stages {
+      values, ok := starPhases[stage]
+      if !ok {
+         t.Fatalf("no synthetic star for stage %s", stage)
+      }
+      rows = append(rows, append([]float64{float64(k + 1)}, values...))
+   }
+
+   return writeHistory(t, dir, name, starColumns, rows)
+
+}
+
+
+// the synthetic stars really are at the phases they stand for
+func TestStarPhases (t *testing.T) {
+
+   for want, values := range starPhases {
+      fields := []string{"1"}
+      for _, v := range values {
+         fields = append(fields, fmt.Sprint(v))
+      }
+      got, reason := ClassifyStage(stageInputFromRow(starColumns, fields), nil)
+      if got != want {
+         t.Errorf("star meant as %s classified as %s (%s)", want, got, reason)
+      }
+   }
+
+}
+
+
+// empty history cache in a temporary directory
+func newTestCache (t *testing.T) *HistoryCache {
+
+   t.Helper()
+
+   cache, err := NewHistoryCache(t.TempDir())
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   return cache
+
+}
+
+
+// columns of synthetic binary histories, unless a case sets its own
+var binaryColumns = []string{"model_number", "donor_index", "rl_relative_overflow_1", "rl_relative_overflow_2", "lg_mtransfer_rate"}
+
+
+func TestClassifyMTHistory (t *testing.T) {
+
+   ms, hg, cheb, stripped, postHe := StageMS, StageHG, StageCHeB, StageStrippedHe, StageCoreCBurning
+   strippedPostHe := StageStrippedHeDepleted
+
+   cases := []struct {
+      name string
+      thresholds *Thresholds
+      star1, star2 []EvolStage
+      columns []string
+      rows [][]float64
+      want MTState
+   }{
+      {
+         name: "no overflow",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, -0.5, -0.6, -99}},
+         want: MTState{Case: MTNone, Stable: true},
+      },
+      {
+         name: "case A",
+         star1: []EvolStage{ms, ms}, star2: []EvolStage{ms, ms},
+         rows: [][]float64{{1, 1, -0.1, -0.5, -99}, {2, 1, 0.01, -0.5, -6}},
+         want: MTState{Case: MTCaseA, Donor: 1, Stable: true},
+      },
+      {
+         name: "case B from a HG donor",
+         star1: []EvolStage{hg}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case B from a CHeB donor",
+         star1: []EvolStage{cheb}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case AB after case A",
+         star1: []EvolStage{ms, hg, hg}, star2: []EvolStage{ms, ms, ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -6}, {2, 1, -0.1, -0.5, -99}, {3, 1, 0.02, -0.5, -5}},
+         want: MTState{Case: MTCaseAB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case BB after case B",
+         star1: []EvolStage{hg, postHe}, star2: []EvolStage{ms, ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}, {2, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseBB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case BA of a core He burning stripped star",
+         star1: []EvolStage{stripped}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseBA, Donor: 1, Stable: true},
+      },
+      {
+         name: "case BB of a He depleted stripped star",
+         star1: []EvolStage{strippedPostHe}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseBB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case BB after case BA",
+         star1: []EvolStage{stripped, postHe}, star2: []EvolStage{ms, ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}, {2, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseBB, Donor: 1, Stable: true},
+      },
+      {
+         name: "case C",
+         star1: []EvolStage{postHe}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -5}},
+         want: MTState{Case: MTCaseC, Donor: 1, Stable: true},
+      },
+      {
+         name: "stable just below UnstableLogMdot",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -2.01}},
+         want: MTState{Case: MTCaseA, Donor: 1, Stable: true},
+      },
+      {
+         name: "unstable at UnstableLogMdot",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -2}},
+         want: MTState{Case: MTCaseA, Donor: 1},
+      },
+      {
+         name: "unstable below CELogMdot",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -1.01}},
+         want: MTState{Case: MTCaseA, Donor: 1},
+      },
+      {
+         name: "common envelope at CELogMdot",
+         star1: []EvolStage{hg}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -1}},
+         want: MTState{Case: MTCaseB, Donor: 1, CommonEnvelope: true},
+      },
+      {
+         name: "thresholds from config",
+         thresholds: &Thresholds{Stage: DefaultStageThresholds, MT: MTThresholds{UnstableLogMdot: -3, CELogMdot: -2.5}},
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -2.5}},
+         want: MTState{Case: MTCaseA, Donor: 1, CommonEnvelope: true},
+      },
+      {
+         name: "stable contact",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, 0.02, -6}},
+         want: MTState{Case: MTCaseA, Donor: 1, Stable: true, Contact: true},
+      },
+      {
+         name: "unstable contact is a common envelope",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, 0.02, -1.5}},
+         want: MTState{Case: MTCaseA, Donor: 1, Contact: true, CommonEnvelope: true},
+      },
+      {
+         name: "no contact when only one star overflows",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         rows: [][]float64{{1, 1, 0.01, 0, -6}},
+         want: MTState{Case: MTCaseA, Donor: 1, Stable: true},
+      },
+      {
+         name: "donor_index of a star not overflowing",
+         star1: []EvolStage{ms}, star2: []EvolStage{hg},
+         rows: [][]float64{{1, 1, -0.1, 0.01, -6}},
+         want: MTState{Case: MTCaseB, Donor: 2, Stable: true},
+      },
+      {
+         name: "donor_index not in history",
+         star1: []EvolStage{ms}, star2: []EvolStage{hg},
+         columns: []string{"model_number", "rl_relative_overflow_1", "rl_relative_overflow_2", "lg_mtransfer_rate"},
+         rows: [][]float64{{1, -0.1, 0.01, -6}},
+         want: MTState{Case: MTCaseB, Donor: 2, Stable: true},
+      },
+      {
+         name: "lg_mstar_dot_1 without lg_mtransfer_rate",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         columns: []string{"model_number", "donor_index", "rl_relative_overflow_1", "rl_relative_overflow_2", "lg_mstar_dot_1", "lg_mstar_dot_2"},
+         rows: [][]float64{{1, 1, 0.01, -0.5, -1.5, -9}},
+         want: MTState{Case: MTCaseA, Donor: 1},
+      },
+      {
+         name: "lg_mstar_dot_2 without lg_mtransfer_rate",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         columns: []string{"model_number", "donor_index", "rl_relative_overflow_1", "rl_relative_overflow_2", "lg_mstar_dot_1", "lg_mstar_dot_2"},
+         rows: [][]float64{{1, 2, -0.5, 0.01, -1.5, -6}},
+         want: MTState{Case: MTCaseA, Donor: 2, Stable: true},
+      },
+      {
+         name: "no MT rate at all is stable",
+         star1: []EvolStage{ms}, star2: []EvolStage{ms},
+         columns: []string{"model_number", "donor_index", "rl_relative_overflow_1", "rl_relative_overflow_2"},
+         rows: [][]float64{{1, 1, 0.01, -0.5}},
+         want: MTState{Case: MTCaseA, Donor: 1, Stable: true},
+      },
+   }
+
+   for _, c := range cases {
+      c := c
+      t.Run(c.name, func(t *testing.T) {
+
+         dir := t.TempDir()
+         columns := c.columns
+         if columns == nil {
+            columns = binaryColumns
+         }
+         binary := writeHistory(t, dir, "binary_history.data", columns, c.rows)
+         star1 := writeStarHistory(t, dir, "history1.data", c.star1)
+         star2 := writeStarHistory(t, dir, "history2.data", c.star2)
+
+         // same answer from the history files & out of the cache
+         for _, cache := range []*HistoryCache{nil, newTestCache(t)} {
+            got, err := ClassifyMTHistory(binary, star1, star2, c.thresholds, cache)
+            if err != nil {
+               t.Fatal(err)
+            }
+            if got.Case != c.want.Case || got.Donor != c.want.Donor || got.Stable != c.want.Stable ||
+               got.Contact != c.want.Contact || got.CommonEnvelope != c.want.CommonEnvelope {
+               t.Errorf("cached %t: got %+v, want %+v", cache != nil, got, c.want)
+            }
+         }
+
+      })
+   }
+
+}
+
+
+// every row is classified in order, knowing about previous episodes
+func TestScanMTHistory (t *testing.T) {
+
+   dir := t.TempDir()
+   binary := writeHistory(t, dir, "binary_history.data", binaryColumns, [][]float64{
+      {1, 1, -0.5, -0.5, -99},
+      {2, 1, 0.01, -0.5, -6},
+      {3, 1, -0.1, -0.5, -99},
+      {4, 1, 0.01, -0.5, -5},
+      {5, 1, 0.01, -0.5, -0.5},
+      {6, 1, -0.1, -0.5, -99},
+   })
+   star1 := writeStarHistory(t, dir, "history1.data", []EvolStage{StageMS, StageMS, StageHG, StageHG, StageHG, StageCoreCBurning})
+   star2 := writeStarHistory(t, dir, "history2.data", []EvolStage{StageMS, StageMS, StageMS, StageMS, StageMS, StageMS})
+
+   want := []string{"No MT (R < RL)", "Case A (stable)", "No MT (R < RL)", "Case AB (stable)", "Case AB (common envelope)", "No MT (R < RL)"}
+
+   for _, cache := range []*HistoryCache{nil, newTestCache(t)} {
+
+      var got []string
+      var extra []float64
+      err := ScanMTHistory(binary, star1, star2, nil, cache, []string{"lg_mtransfer_rate", "not_a_column"}, func(names []string, values []float64, in MTInput, state MTState) error {
+         got = append(got, state.String())
+         if names[len(names)-1] != "lg_mtransfer_rate" {
+            t.Fatalf("got columns %v", names)
+         }
+         extra = append(extra, values[len(values)-1])
+         return nil
+      })
+      if err != nil {
+         t.Fatal(err)
+      }
+
+      if strings.Join(got, "; ") != strings.Join(want, "; ") {
+         t.Errorf("cached %t: got %q, want %q", cache != nil, got, want)
+      }
+      if fmt.Sprint(extra) != "[-99 -6 -99 -5 -0.5 -99]" {
+         t.Errorf("cached %t: got extra column %v", cache != nil, extra)
+      }
+
+   }
+
+}
+
+
+// single rows are classified without history, with the default thresholds unless given
+func TestClassifyMT (t *testing.T) {
+
+   in := NewMTInput()
+   in.DonorIndex = 2
+   in.RelRLOF2 = 0.1
+   in.LogMTRate = -2.5
+
+   if got := ClassifyMT(in, StageMS, StageCHeB, nil); got.Case != MTCaseB || got.Donor != 2 || !got.Stable {
+      t.Errorf("got %+v, want stable case B from star 2", got)
+   }
+   if got := ClassifyMT(in, StageMS, StageCHeB, &MTThresholds{UnstableLogMdot: -3, CELogMdot: 0}); got.Stable {
+      t.Errorf("got %+v, want unstable MT", got)
+   }
+
+}
+
+
+// the deprecated SetMTCase used to compare stages against "CheB star", so CHeB donors were Case C
+func TestSetMTCase (t *testing.T) {
+
+   cases := []struct {
+      relRLOF float64
+      stage string
+      want string
+   }{
+      {-0.1, "MS star", "No MT (R < RL)"},
+      {0.1, "MS star", "Case A"},
+      {0.1, "HG star", "Case B"},
+      {0.1, "CHeB star", "Case B"},
+      {0.1, "core C burning star", "Case C"},
+   }
+
+   for _, c := range cases {
+      if got := SetMTCase(c.relRLOF, c.stage); got != c.want {
+         t.Errorf("SetMTCase(%g, %q) = %q, want %q", c.relRLOF, c.stage, got, c.want)
+      }
+   }
+
+}
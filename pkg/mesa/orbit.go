@@ -0,0 +1,131 @@
+package mesa
+
+import (
+   "math"
+)
+
+
+// physical constants in cgs, with the values MESA uses
+const (
+   clight = 2.99792458e10
+   cgrav = 6.67430e-8
+   msun = 1.98840987e33
+   rsun = 6.957e10
+   secday = 86400.0
+   secyer = 3.1557600e7
+)
+
+
+// orbital separation (Rsun) from Kepler's third law, for masses in Msun & period in days
+func SeparationFromPeriod (m1, m2, period float64) float64 {
+
+   p := period * secday
+   m := (m1 + m2) * msun
+
+   return math.Cbrt(cgrav * m * p * p / (4 * math.Pi * math.Pi)) / rsun
+
+}
+
+
+// orbital period (days) from Kepler's third law, for masses in Msun & separation in Rsun
+func PeriodFromSeparation (m1, m2, separation float64) float64 {
+
+   a := separation * rsun
+   m := (m1 + m2) * msun
+
+   return 2 * math.Pi * math.Sqrt(a * a * a / (cgrav * m)) / secday
+
+}
+
+
+// radius of the Roche lobe (same units as separation) of a star with mass ratio q = M_star / M_companion,
+// using the fit of Eggleton (1983)
+func EggletonRocheLobe (q, separation float64) float64 {
+
+   q13 := math.Cbrt(q)
+   q23 := q13 * q13
+
+   return separation * 0.49 * q23 / (0.6 * q23 + math.Log(1 + q13))
+
+}
+
+
+// orbital velocities (km/s) of each star around the center of mass of a circular orbit, for masses
+// in Msun & separation in Rsun
+func OrbitalVelocities (m1, m2, separation float64) (float64, float64) {
+
+   m := m1 + m2
+   v := math.Sqrt(cgrav * m * msun / (separation * rsun)) / 1e5
+
+   return v * m2 / m, v * m1 / m
+
+}
+
+
+// time (yr) for a binary to merge due to emission of gravitational waves (Peters 1964), for masses in
+// Msun & separation in Rsun. eccentricity is taken into account with the usual (1 - e^2)^(7/2) factor
+func PetersMergerTime (m1, m2, separation, eccentricity float64) float64 {
+
+   a := separation * rsun
+   g3 := cgrav * cgrav * cgrav
+   c5 := math.Pow(clight, 5)
+   mm := m1 * m2 * (m1 + m2) * msun * msun * msun
+
+   t := 5.0 / 256.0 * c5 * a * a * a * a / (g3 * mm)
+   if eccentricity > 0 && eccentricity < 1 {
+      t *= math.Pow(1 - eccentricity * eccentricity, 3.5)
+   }
+
+   return t / secyer
+
+}
+
+
+// chirp mass, in the same units as masses
+func ChirpMass (m1, m2 float64) float64 {
+
+   return math.Pow(m1 * m2, 0.6) / math.Pow(m1 + m2, 0.2)
+
+}
+
+
+// compute derived orbital quantities from the values of the last binary history row
+func (b *MESAbinaryInfo) SetOrbitalQuantities () {
+
+   if b.Star1Mass <= 0 || b.Star2Mass <= 0 {
+      return
+   }
+
+   // use separation from history when there
+   if b.Separation <= 0 && b.Period > 0 {
+      b.Separation = SeparationFromPeriod(b.Star1Mass, b.Star2Mass, b.Period)
+   }
+
+   // mass ratio of donor over accretor
+   b.MassRatio = b.Star1Mass / b.Star2Mass
+   if b.DonorIndex == 2 {
+      b.MassRatio = b.Star2Mass / b.Star1Mass
+   }
+
+   if b.Separation > 0 {
+      b.RL1 = EggletonRocheLobe(b.Star1Mass / b.Star2Mass, b.Separation)
+      b.RL2 = EggletonRocheLobe(b.Star2Mass / b.Star1Mass, b.Separation)
+      b.OrbitalVelocity1, b.OrbitalVelocity2 = OrbitalVelocities(b.Star1Mass, b.Star2Mass, b.Separation)
+   }
+
+}
+
+
+// compute quantities only meaningful when both stars are compact objects: merger time due to
+// gravitational waves & chirp mass
+func (b *MESAbinaryInfo) SetCompactQuantities () {
+
+   if b.Star1Mass <= 0 || b.Star2Mass <= 0 || b.Separation <= 0 {
+      return
+   }
+
+   b.IsCompactBinary = true
+   b.MergerTime = PetersMergerTime(b.Star1Mass, b.Star2Mass, b.Separation, b.Eccentricity)
+   b.ChirpMass = ChirpMass(b.Star1Mass, b.Star2Mass)
+
+}
@@ -0,0 +1,107 @@
+package mesa
+
+import (
+   "math"
+   "testing"
+)
+
+
+// whether got is within a relative tolerance of want
+func closeTo (got, want, tolerance float64) bool {
+
+   return math.Abs(got - want) <= tolerance * math.Abs(want)
+
+}
+
+
+func TestOrbitHelpers (t *testing.T) {
+
+   // 1 AU = 215.03 Rsun & Earth moves at 29.78 km/s
+   mEarth := 3.003e-6
+
+   // Hulse-Taylor pulsar PSR B1913+16 merges in about 300 Myr
+   mPSR, mCompanion, pPSR, ePSR := 1.4398, 1.3886, 0.322997, 0.6171334
+   aPSR := SeparationFromPeriod(mPSR, mCompanion, pPSR)
+
+   cases := []struct {
+      name string
+      got, want, tolerance float64
+   }{
+      {"Kepler separation of the Sun & Earth", SeparationFromPeriod(1, mEarth, 365.25), 215.03, 1e-4},
+      {"Kepler period of the Sun & Earth", PeriodFromSeparation(1, mEarth, 215.03), 365.25, 1e-4},
+      {"Hulse-Taylor separation", aPSR, 2.80, 1e-2},
+      {"Eggleton Roche lobe at q = 1", EggletonRocheLobe(1, 1), 0.49 / (0.6 + math.Ln2), 1e-12},
+      {"Eggleton Roche lobe scales with separation", EggletonRocheLobe(1, 10), 3.789, 1e-3},
+      {"Eggleton Roche lobe of the Earth", EggletonRocheLobe(mEarth, 215.03), 215.03 * 0.49 * math.Pow(mEarth, 2.0 / 3) / (0.6 * math.Pow(mEarth, 2.0 / 3) + math.Log(1 + math.Cbrt(mEarth))), 1e-12},
+      {"Hulse-Taylor merger time", PetersMergerTime(mPSR, mCompanion, aPSR, ePSR), 3.0e8, 0.05},
+      {"circular merger time scales as separation^4", PetersMergerTime(1.4, 1.4, 2, 0) / PetersMergerTime(1.4, 1.4, 1, 0), 16, 1e-12},
+      {"chirp mass of equal masses", ChirpMass(1.4, 1.4), 1.4 * math.Pow(2, -0.2), 1e-12},
+      {"chirp mass of a BH-BH pair", ChirpMass(30, 30), 26.12, 1e-3},
+   }
+
+   for _, c := range cases {
+      if !closeTo(c.got, c.want, c.tolerance) {
+         t.Errorf("%s: got %g, want %g", c.name, c.got, c.want)
+      }
+   }
+
+   v1, v2 := OrbitalVelocities(1, mEarth, 215.03)
+   if !closeTo(v1 + v2, 29.78, 1e-3) || !closeTo(v1 / v2, mEarth, 1e-12) {
+      t.Errorf("orbital velocities of the Sun & Earth: got %g & %g km/s", v1, v2)
+   }
+
+}
+
+
+func TestSetOrbitalQuantities (t *testing.T) {
+
+   b := &MESAbinaryInfo{Star1Mass: 1.4, Star2Mass: 1.4, Period: 1, DonorIndex: 2}
+   b.SetOrbitalQuantities()
+
+   if !closeTo(b.Separation, SeparationFromPeriod(1.4, 1.4, 1), 1e-12) {
+      t.Errorf("separation not taken from period: %g", b.Separation)
+   }
+   if b.MassRatio != 1 || !closeTo(b.RL1, b.RL2, 1e-12) || !closeTo(b.RL1, 0.3789 * b.Separation, 1e-3) {
+      t.Errorf("got q = %g, RL1 = %g, RL2 = %g", b.MassRatio, b.RL1, b.RL2)
+   }
+
+   b.SetCompactQuantities()
+   if !b.IsCompactBinary || !closeTo(b.ChirpMass, 1.2188, 1e-3) || b.MergerTime <= 0 {
+      t.Errorf("got chirp mass %g & merger time %g", b.ChirpMass, b.MergerTime)
+   }
+
+}
+
+
+// bin2dco runs end at the second core collapse, the double compact object is the one it left
+func TestBin2dcoCompactBinary (t *testing.T) {
+
+   run := &Bin2dcoRun{CoreCollapses: []CoreCollapseInfo{
+      {Star: 1, Age: 1e7, RemnantMass: 1.4, PostSNPeriod: 10},
+      {Star: 2, Age: 2e7, RemnantMass: 1.3, CompanionMass: 1.4, PostSNPeriod: 0.322997, PostSNEccentricity: 0.6171334},
+   }}
+
+   b := run.CompactBinary()
+   if b == nil {
+      t.Fatal("no compact binary after two core collapses")
+   }
+   if b.Star1Mass != 1.4 || b.Star2Mass != 1.3 {
+      t.Errorf("got masses %g & %g", b.Star1Mass, b.Star2Mass)
+   }
+   if !closeTo(b.ChirpMass, ChirpMass(1.4, 1.3), 1e-12) {
+      t.Errorf("got chirp mass %g", b.ChirpMass)
+   }
+   a := SeparationFromPeriod(1.4, 1.3, 0.322997)
+   if !closeTo(b.MergerTime, PetersMergerTime(1.4, 1.3, a, 0.6171334), 1e-12) {
+      t.Errorf("got merger time %g", b.MergerTime)
+   }
+
+   run.CoreCollapses[1].Disrupted = true
+   if run.CompactBinary() != nil {
+      t.Error("compact binary of a disrupted binary")
+   }
+   if (&Bin2dcoRun{CoreCollapses: run.CoreCollapses[:1]}).CompactBinary() != nil {
+      t.Error("compact binary after a single core collapse")
+   }
+
+}
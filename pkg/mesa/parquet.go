@@ -0,0 +1,344 @@
+package mesa
+
+import (
+   "encoding/binary"
+   "io"
+   "math"
+)
+
+
+// parquet files start & end with this
+const parquetMagic = "PAR1"
+
+// rows are written in row groups of about this size, so only one group is kept in memory
+const parquetRowGroupBytes = 16 << 20
+
+// parquet enum values used by the writer
+const (
+   parquetTypeDouble = 5
+   parquetRequired = 0
+   parquetEncodingPlain = 0
+   parquetEncodingRLE = 3
+   parquetCodecUncompressed = 0
+   parquetDataPage = 0
+)
+
+
+// minimal parquet writer: every column is a required double, written as a single uncompressed page
+// with plain encoding per row group. this is all MESA histories need and keeps the service free of
+// the (large) parquet & arrow libraries
+type parquetWriter struct {
+   out io.Writer
+   offset int64
+   columns []string
+   data [][]float64
+   groupRows int
+   groups []parquetRowGroup
+   numRows int64
+   err error
+}
+
+type parquetChunk struct {
+   offset int64
+   size int64
+   numValues int64
+}
+
+type parquetRowGroup struct {
+   chunks []parquetChunk
+   numRows int64
+   size int64
+}
+
+
+func newParquetWriter (w io.Writer, columns []string) *parquetWriter {
+
+   p := &parquetWriter{out: w, columns: columns, data: make([][]float64, len(columns))}
+
+   p.groupRows = parquetRowGroupBytes / (8 * len(columns) + 1)
+   if p.groupRows < 1 {
+      p.groupRows = 1
+   }
+
+   p.write([]byte(parquetMagic))
+
+   return p
+
+}
+
+
+func (p *parquetWriter) write (b []byte) {
+
+   if p.err != nil {
+      return
+   }
+
+   n, err := p.out.Write(b)
+   p.offset += int64(n)
+   p.err = err
+
+}
+
+
+func (p *parquetWriter) WriteRow (values []float64) error {
+
+   for k, v := range values {
+      p.data[k] = append(p.data[k], v)
+   }
+   if len(p.data[0]) >= p.groupRows {
+      p.flushGroup()
+   }
+
+   return p.err
+
+}
+
+
+// write rows kept in memory as a new row group
+func (p *parquetWriter) flushGroup () {
+
+   if len(p.columns) == 0 || len(p.data[0]) == 0 {
+      return
+   }
+
+   numRows := len(p.data[0])
+   group := parquetRowGroup{numRows: int64(numRows)}
+   page := make([]byte, 8 * numRows)
+
+   for k := range p.columns {
+
+      for i, v := range p.data[k] {
+         binary.LittleEndian.PutUint64(page[8*i:], math.Float64bits(v))
+      }
+
+      t := new(thriftWriter)
+      t.i32(1, parquetDataPage)
+      t.i32(2, int32(len(page)))
+      t.i32(3, int32(len(page)))
+      t.beginStruct(5)
+      t.i32(1, int32(numRows))
+      t.i32(2, parquetEncodingPlain)
+      t.i32(3, parquetEncodingRLE)
+      t.i32(4, parquetEncodingRLE)
+      t.endStruct()
+      t.stop()
+
+      chunk := parquetChunk{offset: p.offset, size: int64(len(t.buf) + len(page)), numValues: int64(numRows)}
+      p.write(t.buf)
+      p.write(page)
+
+      group.chunks = append(group.chunks, chunk)
+      group.size += chunk.size
+      p.data[k] = p.data[k][:0]
+
+   }
+
+   p.groups = append(p.groups, group)
+   p.numRows += int64(numRows)
+
+}
+
+
+// write remaining rows and the file metadata
+func (p *parquetWriter) Close () error {
+
+   p.flushGroup()
+
+   t := new(thriftWriter)
+   t.i32(1, 1)
+
+   // schema: a root with every column as a child
+   t.list(2, thriftStruct, len(p.columns) + 1)
+   t.begin()
+   t.str(4, "schema")
+   t.i32(5, int32(len(p.columns)))
+   t.stop()
+   for _, name := range p.columns {
+      t.begin()
+      t.i32(1, parquetTypeDouble)
+      t.i32(3, parquetRequired)
+      t.str(4, name)
+      t.stop()
+   }
+
+   t.i64(3, p.numRows)
+
+   t.list(4, thriftStruct, len(p.groups))
+   for _, group := range p.groups {
+      t.begin()
+      t.list(1, thriftStruct, len(group.chunks))
+      for k, chunk := range group.chunks {
+         t.begin()
+         t.i64(2, chunk.offset)
+         t.beginStruct(3)
+         t.i32(1, parquetTypeDouble)
+         t.list(2, thriftI32, 2)
+         t.listI32(parquetEncodingPlain)
+         t.listI32(parquetEncodingRLE)
+         t.list(3, thriftBinary, 1)
+         t.listStr(p.columns[k])
+         t.i32(4, parquetCodecUncompressed)
+         t.i64(5, chunk.numValues)
+         t.i64(6, chunk.size)
+         t.i64(7, chunk.size)
+         t.i64(9, chunk.offset)
+         t.endStruct()
+         t.stop()
+      }
+      t.i64(2, group.size)
+      t.i64(3, group.numRows)
+      t.stop()
+   }
+
+   t.str(6, "web-service MESA export")
+   t.stop()
+
+   footer := make([]byte, 4)
+   binary.LittleEndian.PutUint32(footer, uint32(len(t.buf)))
+
+   p.write(t.buf)
+   p.write(footer)
+   p.write([]byte(parquetMagic))
+
+   return p.err
+
+}
+
+
+// thrift compact protocol types
+const (
+   thriftI32 = 5
+   thriftI64 = 6
+   thriftBinary = 8
+   thriftList = 9
+   thriftStruct = 12
+)
+
+
+// encoder of the thrift compact protocol, used by parquet for its metadata. only what parquetWriter
+// needs is there
+type thriftWriter struct {
+   buf []byte
+   last int16
+   stack []int16
+}
+
+
+func (t *thriftWriter) varint (v uint64) {
+
+   for v >= 0x80 {
+      t.buf = append(t.buf, byte(v) | 0x80)
+      v >>= 7
+   }
+   t.buf = append(t.buf, byte(v))
+
+}
+
+
+func (t *thriftWriter) zigzag (v int64) {
+
+   t.varint(uint64((v << 1) ^ (v >> 63)))
+
+}
+
+
+func (t *thriftWriter) field (id int16, typ byte) {
+
+   if delta := id - t.last; delta > 0 && delta <= 15 {
+      t.buf = append(t.buf, byte(delta) << 4 | typ)
+   } else {
+      t.buf = append(t.buf, typ)
+      t.zigzag(int64(id))
+   }
+   t.last = id
+
+}
+
+
+func (t *thriftWriter) i32 (id int16, v int32) {
+
+   t.field(id, thriftI32)
+   t.zigzag(int64(v))
+
+}
+
+
+func (t *thriftWriter) i64 (id int16, v int64) {
+
+   t.field(id, thriftI64)
+   t.zigzag(v)
+
+}
+
+
+func (t *thriftWriter) str (id int16, s string) {
+
+   t.field(id, thriftBinary)
+   t.listStr(s)
+
+}
+
+
+// start of a struct, either as an element of a list or after its field header
+func (t *thriftWriter) begin () {
+
+   t.stack = append(t.stack, t.last)
+   t.last = 0
+
+}
+
+
+// end of a struct started with begin
+func (t *thriftWriter) stop () {
+
+   t.buf = append(t.buf, 0)
+   if n := len(t.stack); n > 0 {
+      t.last = t.stack[n-1]
+      t.stack = t.stack[:n-1]
+   }
+
+}
+
+
+func (t *thriftWriter) beginStruct (id int16) {
+
+   t.field(id, thriftStruct)
+   t.begin()
+
+}
+
+
+func (t *thriftWriter) endStruct () {
+
+   t.stop()
+
+}
+
+
+// header of a list field, its elements must follow
+func (t *thriftWriter) list (id int16, elemType byte, n int) {
+
+   t.field(id, thriftList)
+   if n < 15 {
+      t.buf = append(t.buf, byte(n) << 4 | elemType)
+   } else {
+      t.buf = append(t.buf, 0xf0 | elemType)
+      t.varint(uint64(n))
+   }
+
+}
+
+
+func (t *thriftWriter) listI32 (v int32) {
+
+   t.zigzag(int64(v))
+
+}
+
+
+func (t *thriftWriter) listStr (s string) {
+
+   t.varint(uint64(len(s)))
+   t.buf = append(t.buf, s...)
+
+}
@@ -0,0 +1,326 @@
+package mesa
+
+import (
+   "bytes"
+   "encoding/binary"
+   "fmt"
+   "math"
+   "strings"
+   "testing"
+)
+
+
+// decoder of the thrift compact protocol, enough to read back what parquetWriter writes. structs are
+// maps of field id to value: int64 for integers, string for binary, []interface{} for lists and
+// map[int16]interface{} for structs
+type thriftReader struct {
+   buf []byte
+   pos int
+}
+
+
+func (r *thriftReader) byte () byte {
+
+   if r.pos >= len(r.buf) {
+      panic("thrift: unexpected end of data")
+   }
+   b := r.buf[r.pos]
+   r.pos++
+
+   return b
+
+}
+
+
+func (r *thriftReader) varint () uint64 {
+
+   var v uint64
+   for shift := uint(0); ; shift += 7 {
+      b := r.byte()
+      v |= uint64(b & 0x7f) << shift
+      if b < 0x80 {
+         return v
+      }
+   }
+
+}
+
+
+func (r *thriftReader) zigzag () int64 {
+
+   v := r.varint()
+
+   return int64(v >> 1) ^ -int64(v & 1)
+
+}
+
+
+func (r *thriftReader) value (typ byte) interface{} {
+
+   switch typ {
+   case 1, 2:
+      return typ == 1
+   case 3:
+      return int64(int8(r.byte()))
+   case 4, 5, 6:
+      return r.zigzag()
+   case 7:
+      v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+      r.pos += 8
+      return v
+   case thriftBinary:
+      n := int(r.varint())
+      s := string(r.buf[r.pos : r.pos+n])
+      r.pos += n
+      return s
+   case thriftList:
+      header := r.byte()
+      n := int(header >> 4)
+      if n == 15 {
+         n = int(r.varint())
+      }
+      list := make([]interface{}, n)
+      for k := range list {
+         list[k] = r.value(header & 0x0f)
+      }
+      return list
+   case thriftStruct:
+      return r.readStruct()
+   }
+
+   panic(fmt.Sprintf("thrift: unexpected type %d", typ))
+
+}
+
+
+func (r *thriftReader) readStruct () map[int16]interface{} {
+
+   fields := make(map[int16]interface{})
+   var last int16
+   for {
+      header := r.byte()
+      if header == 0 {
+         return fields
+      }
+      id := last + int16(header >> 4)
+      if header >> 4 == 0 {
+         id = int16(r.zigzag())
+      }
+      fields[id] = r.value(header & 0x0f)
+      last = id
+   }
+
+}
+
+
+// parquet file metadata of a file, checking both magic numbers
+func readParquetFooter (t *testing.T, file []byte) map[int16]interface{} {
+
+   t.Helper()
+
+   if len(file) < 12 || string(file[:4]) != parquetMagic || string(file[len(file)-4:]) != parquetMagic {
+      t.Fatalf("no %s magic at both ends of the file", parquetMagic)
+   }
+   size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+   start := len(file) - 8 - size
+   if start < 4 {
+      t.Fatalf("footer of %d bytes does not fit in a file of %d", size, len(file))
+   }
+
+   r := &thriftReader{buf: file[start : len(file)-8]}
+   meta := r.readStruct()
+   if r.pos != size {
+      t.Fatalf("footer has %d bytes, %d were read", size, r.pos)
+   }
+
+   return meta
+
+}
+
+
+// read back every column of a parquet file written by parquetWriter, following its metadata
+func readParquet (t *testing.T, file []byte) ([]string, [][]float64, int) {
+
+   t.Helper()
+
+   meta := readParquetFooter(t, file)
+
+   if meta[1] != int64(1) {
+      t.Errorf("version %v, want 1", meta[1])
+   }
+
+   schema := meta[2].([]interface{})
+   root := schema[0].(map[int16]interface{})
+   if root[5] != int64(len(schema) - 1) {
+      t.Errorf("schema root has %v children, want %d", root[5], len(schema) - 1)
+   }
+   var columns []string
+   for _, element := range schema[1:] {
+      e := element.(map[int16]interface{})
+      if e[1] != int64(parquetTypeDouble) || e[3] != int64(parquetRequired) {
+         t.Errorf("column %v of type %v & repetition %v, want required double", e[4], e[1], e[3])
+      }
+      columns = append(columns, e[4].(string))
+   }
+
+   data := make([][]float64, len(columns))
+   groups := meta[4].([]interface{})
+   var rows int64
+   for _, g := range groups {
+      group := g.(map[int16]interface{})
+      chunks := group[1].([]interface{})
+      if len(chunks) != len(columns) {
+         t.Fatalf("row group with %d column chunks, want %d", len(chunks), len(columns))
+      }
+      var groupSize int64
+      for k, c := range chunks {
+         chunk := c.(map[int16]interface{})
+         cm := chunk[3].(map[int16]interface{})
+         if path := cm[3].([]interface{}); len(path) != 1 || path[0] != columns[k] {
+            t.Errorf("chunk %d of column %v, want %s", k, path, columns[k])
+         }
+         if cm[1] != int64(parquetTypeDouble) || cm[4] != int64(parquetCodecUncompressed) {
+            t.Errorf("chunk of %s of type %v & codec %v", columns[k], cm[1], cm[4])
+         }
+         if chunk[2] != cm[9] {
+            t.Errorf("chunk of %s at %v, its data page at %v", columns[k], chunk[2], cm[9])
+         }
+
+         // page header, then the plain encoded values
+         offset := cm[9].(int64)
+         r := &thriftReader{buf: file[offset:]}
+         header := r.readStruct()
+         page := header[5].(map[int16]interface{})
+         if header[1] != int64(parquetDataPage) || page[1] != cm[5] || page[2] != int64(parquetEncodingPlain) {
+            t.Errorf("page of %s: %v", columns[k], header)
+         }
+         size := int(header[3].(int64))
+         if int64(r.pos + size) != cm[6].(int64) || cm[6] != cm[7] {
+            t.Errorf("chunk of %s of %v bytes, page header & data take %d", columns[k], cm[6], r.pos + size)
+         }
+         values := file[int(offset) + r.pos : int(offset) + r.pos + size]
+         for i := 0; i < len(values); i += 8 {
+            data[k] = append(data[k], math.Float64frombits(binary.LittleEndian.Uint64(values[i:])))
+         }
+         if int64(len(values) / 8) != cm[5] {
+            t.Errorf("chunk of %s has %d values, metadata says %v", columns[k], len(values) / 8, cm[5])
+         }
+         groupSize += cm[6].(int64)
+      }
+      if group[2] != groupSize {
+         t.Errorf("row group of %v bytes, its chunks take %d", group[2], groupSize)
+      }
+      rows += group[3].(int64)
+   }
+   if meta[3] != rows {
+      t.Errorf("file has %v rows, its row groups %d", meta[3], rows)
+   }
+
+   return columns, data, len(groups)
+
+}
+
+
+func TestParquetRoundTrip (t *testing.T) {
+
+   columns := []string{"model_number", "star_age", "log_L"}
+   rows := [][]float64{
+      {1, 0, -0.5},
+      {2, 1e3, math.NaN()},
+      {3, 2.5e6, math.Inf(1)},
+      {4, 1e7, 1.25},
+      {5, 3.3e7, -99},
+      {6, 5e7, 2},
+      {7, 1e8, 2.5},
+   }
+
+   for _, groupRows := range []int{0, 3, 1} {
+      t.Run(fmt.Sprintf("rows per group %d", groupRows), func(t *testing.T) {
+
+         var buf bytes.Buffer
+         p := newParquetWriter(&buf, columns)
+         if groupRows > 0 {
+            p.groupRows = groupRows
+         }
+         for _, row := range rows {
+            if err := p.WriteRow(row); err != nil {
+               t.Fatal(err)
+            }
+         }
+         if err := p.Close(); err != nil {
+            t.Fatal(err)
+         }
+
+         gotColumns, data, groups := readParquet(t, buf.Bytes())
+         if strings.Join(gotColumns, ",") != strings.Join(columns, ",") {
+            t.Errorf("got columns %v, want %v", gotColumns, columns)
+         }
+         if want := (len(rows) + p.groupRows - 1) / p.groupRows; groups != want {
+            t.Errorf("got %d row groups, want %d", groups, want)
+         }
+         for k := range columns {
+            if len(data[k]) != len(rows) {
+               t.Fatalf("column %s has %d values, want %d", columns[k], len(data[k]), len(rows))
+            }
+            for i, row := range rows {
+               if math.Float64bits(data[k][i]) != math.Float64bits(row[k]) {
+                  t.Errorf("%s of row %d is %g, want %g", columns[k], i, data[k][i], row[k])
+               }
+            }
+         }
+
+      })
+   }
+
+}
+
+
+// a history exported to parquet has the columns & rows asked for
+func TestExportParquet (t *testing.T) {
+
+   dir := t.TempDir()
+   filename := writeHistory(t, dir, "history.data", []string{"model_number", "star_age", "star_mass"}, [][]float64{
+      {1, 0, 10},
+      {2, 1e5, 9.9},
+      {3, 2e5, 9.8},
+      {4, 3e5, 9.7},
+   })
+
+   // same file from the history & out of the cache
+   for _, cache := range []*HistoryCache{nil, newTestCache(t)} {
+
+      var buf bytes.Buffer
+      err := cache.Export(filename, &buf, FormatParquet, &ExportOptions{Columns: []string{"star_mass", "model_number"}, FirstRow: 1, LastRow: 3})
+      if err != nil {
+         t.Fatal(err)
+      }
+
+      columns, data, _ := readParquet(t, buf.Bytes())
+      if got := fmt.Sprint(columns, data); got != "[star_mass model_number] [[9.9 9.8] [2 3]]" {
+         t.Errorf("cached %t: got %s", cache != nil, got)
+      }
+
+      if err := cache.Export(filename, &buf, FormatCSV, &ExportOptions{Columns: []string{"log_L"}}); err == nil {
+         t.Errorf("cached %t: export of an unknown column did not fail", cache != nil)
+      }
+
+   }
+
+}
+
+
+func TestParseExportFormat (t *testing.T) {
+
+   for name, want := range map[string]ExportFormat{"csv": FormatCSV, ".jsonl": FormatJSONLines, "json": FormatJSONLines, "Parquet": FormatParquet, "pq": FormatParquet} {
+      if got, err := ParseExportFormat(name); err != nil || got != want {
+         t.Errorf("ParseExportFormat(%q) = %v, %v, want %v", name, got, err, want)
+      }
+   }
+
+   for _, name := range []string{"arrow", "feather", "xlsx"} {
+      if _, err := ParseExportFormat(name); err == nil {
+         t.Errorf("ParseExportFormat(%q) did not fail", name)
+      }
+   }
+
+}
@@ -0,0 +1,217 @@
+package mesa
+
+import (
+   "bufio"
+   "fmt"
+   "os"
+   "path/filepath"
+   "sort"
+   "strconv"
+   "strings"
+   "time"
+)
+
+
+// folder of a run where MESA saves photos, i.e. checkpoints a run can be restarted from
+var PhotosDirectory = "photos"
+
+// binary runs save a photo of the binary & one of each star, with these prefixes. ./re takes the name
+// without prefix
+var photoPrefixes = []string{"b_", "1_", "2_"}
+
+// saved models, written with save_model_when_terminate & such
+var modelSuffix = ".mod"
+
+// lines of a saved model searched for its model number
+const modelHeaderLines = 100
+
+
+// kinds of checkpoints
+const (
+   CheckpointPhoto = "photo"
+   CheckpointModel = "model"
+)
+
+
+// a checkpoint of a run: a photo (maybe split in several files) or a saved model
+type Photo struct {
+   Name string
+   // bin2dco stage whose folder has the photo, empty for photos of the run itself
+   Stage string
+   Kind string
+   Files []string
+   ModelNumber int
+   ModTime time.Time
+   Size int64
+   Restartable bool
+}
+
+
+// size of a checkpoint in human units
+func (p Photo) SizeString () string {
+
+   size := float64(p.Size)
+   for _, unit := range []string{"B", "kB", "MB", "GB"} {
+      if size < 1024 || unit == "GB" {
+         return fmt.Sprintf("%.1f %s", size, unit)
+      }
+      size /= 1024
+   }
+
+   return ""
+
+}
+
+
+// files of a photo: photos/<name> or, for binaries, photos/b_<name>, photos/1_<name> & photos/2_<name>
+func PhotoFiles (rootDir, name string) []string {
+
+   if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+      return nil
+   }
+
+   var files []string
+   for _, prefix := range append([]string{""}, photoPrefixes...) {
+      filename := filepath.Join(rootDir, PhotosDirectory, prefix + name)
+      if info, err := os.Stat(filename); err == nil && info.Mode().IsRegular() {
+         files = append(files, filename)
+      }
+   }
+
+   return files
+
+}
+
+
+// photos & saved models of a run, newest first. models are the model numbers in its history, used
+// to find out the model of photos, whose names only have its last digits
+func ListPhotos (rootDir string, models []int) ([]Photo, error) {
+
+   photos := make(map[string]*Photo)
+
+   entries, err := os.ReadDir(filepath.Join(rootDir, PhotosDirectory))
+   if err != nil && !os.IsNotExist(err) {
+      return nil, err
+   }
+   for _, entry := range entries {
+      if entry.IsDir() {
+         continue
+      }
+      info, err := entry.Info()
+      if err != nil {
+         continue
+      }
+
+      name := entry.Name()
+      for _, prefix := range photoPrefixes {
+         if strings.HasPrefix(name, prefix) {
+            name = strings.TrimPrefix(name, prefix)
+            break
+         }
+      }
+
+      p, ok := photos[name]
+      if !ok {
+         p = &Photo{Name: name, Kind: CheckpointPhoto, ModelNumber: photoModelNumber(name, models), Restartable: true}
+         photos[name] = p
+      }
+      p.Files = append(p.Files, filepath.Join(rootDir, PhotosDirectory, entry.Name()))
+      p.Size += info.Size()
+      if info.ModTime().After(p.ModTime) {
+         p.ModTime = info.ModTime()
+      }
+   }
+
+   list := make([]Photo, 0, len(photos))
+   for _, p := range photos {
+      list = append(list, *p)
+   }
+
+   entries, err = os.ReadDir(rootDir)
+   if err != nil {
+      return nil, err
+   }
+   for _, entry := range entries {
+      if entry.IsDir() || !strings.HasSuffix(entry.Name(), modelSuffix) {
+         continue
+      }
+      info, err := entry.Info()
+      if err != nil {
+         continue
+      }
+      filename := filepath.Join(rootDir, entry.Name())
+      list = append(list, Photo{
+         Name: entry.Name(),
+         Kind: CheckpointModel,
+         Files: []string{filename},
+         ModelNumber: savedModelNumber(filename),
+         ModTime: info.ModTime(),
+         Size: info.Size(),
+      })
+   }
+
+   sort.SliceStable(list, func(i, j int) bool {
+      if !list[i].ModTime.Equal(list[j].ModTime) {
+         return list[i].ModTime.After(list[j].ModTime)
+      }
+      return list[i].Name < list[j].Name
+   })
+
+   return list, nil
+
+}
+
+
+// model number of a photo named x<digits>, which are the last digits of it (photo_digits). a photo
+// with the same name is overwritten each time, so it is the last model in history ending in those
+// digits. -1 if unknown
+func photoModelNumber (name string, models []int) int {
+
+   digits := strings.TrimLeft(name, "x")
+   n, err := strconv.Atoi(digits)
+   if err != nil || n < 0 || len(digits) == 0 {
+      return -1
+   }
+
+   mod := 1
+   for k := 0; k < len(digits); k++ {
+      mod *= 10
+   }
+
+   found := -1
+   for _, model := range models {
+      if model % mod == n && model > found {
+         found = model
+      }
+   }
+
+   return found
+
+}
+
+
+// model number found in the header of a saved model, -1 if not there
+func savedModelNumber (filename string) int {
+
+   f, err := os.Open(filename)
+   if err != nil {
+      return -1
+   }
+   defer f.Close()
+
+   scanner := bufio.NewScanner(f)
+   for k := 0; k < modelHeaderLines && scanner.Scan(); k++ {
+      fields := strings.Fields(scanner.Text())
+      if len(fields) >= 2 && fields[0] == "model_number" {
+         if n, err := strconv.Atoi(fields[1]); err == nil {
+            return n
+         }
+         if v, err := ParseValue(fields[1]); err == nil {
+            return int(v)
+         }
+      }
+   }
+
+   return -1
+
+}
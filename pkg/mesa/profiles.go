@@ -0,0 +1,168 @@
+package mesa
+
+import (
+   "bufio"
+   "fmt"
+   "os"
+   "path/filepath"
+   "strconv"
+   "strings"
+
+   "web-service/pkg/io"
+)
+
+var profilesIndexName = "profiles.index"
+var profilePrefix = "profile"
+var profileSuffix = ".data"
+
+// profile columns loaded when none are asked for
+var DefaultProfileColumns = []string{
+   "mass", "logT", "logRho", "h1", "he4", "c12", "n14", "o16", "ne20", "mg24",
+}
+
+
+// one entry of profiles.index
+type MESAprofileEntry struct {
+   ModelNumber int
+   Priority int
+   ProfileNumber int
+   Filename string
+}
+
+
+// data of a single MESA profile, stored column by column
+type MESAprofile struct {
+   MESAprofileEntry
+   HeaderNames []string
+   HeaderValues []string
+   Columns []string
+   Data map[string][]float64
+}
+
+
+// list profiles available in a LOGS directory by reading its profiles.index
+func ListProfiles (logDir string) ([]MESAprofileEntry, error) {
+
+   io.LogInfo("MESA - profiles.go - ListProfiles", "searching for profiles in " + logDir)
+
+   indexName := filepath.Join(logDir, profilesIndexName)
+   f, err := os.Open(indexName)
+   if err != nil {
+      return nil, &ParseError{File: indexName, Err: err}
+   }
+   defer f.Close()
+
+   var profiles []MESAprofileEntry
+   scanner := bufio.NewScanner(f)
+   lineCount := 0
+
+   for scanner.Scan() {
+
+      lineCount++
+
+      // first line just tells how many models are there & what each column is
+      if lineCount == 1 {
+         continue
+      }
+
+      fields := strings.Fields(scanner.Text())
+      if len(fields) == 0 {
+         continue
+      }
+      if len(fields) < 3 {
+         return profiles, &ParseError{File: indexName, Line: lineCount, Err: ErrShortRow}
+      }
+
+      var values [3]int
+      for k := 0; k < 3; k++ {
+         values[k], err = strconv.Atoi(fields[k])
+         if err != nil {
+            return profiles, &ParseError{File: indexName, Line: lineCount, Err: err}
+         }
+      }
+
+      profiles = append(profiles, MESAprofileEntry{
+         ModelNumber: values[0],
+         Priority: values[1],
+         ProfileNumber: values[2],
+         Filename: filepath.Join(logDir, fmt.Sprintf("%s%d%s", profilePrefix, values[2], profileSuffix)),
+      })
+
+   }
+
+   if err := scanner.Err(); err != nil {
+      return profiles, &ParseError{File: indexName, Err: err}
+   }
+
+   return profiles, nil
+
+}
+
+
+// load columns of a profile. with no columns asked, DefaultProfileColumns present in file are
+// loaded. columns not found in the file are just left out of Data
+func LoadProfile (entry MESAprofileEntry, columns []string) (*MESAprofile, error) {
+
+   d, err := OpenDataFile(entry.Filename)
+   if err != nil {
+      return nil, err
+   }
+
+   if len(columns) == 0 {
+      columns = DefaultProfileColumns
+   }
+
+   p := &MESAprofile{
+      MESAprofileEntry: entry,
+      HeaderNames: d.HeaderNames,
+      HeaderValues: d.HeaderValues,
+      Data: make(map[string][]float64),
+   }
+
+   // position of each column asked that is present in the file
+   var index []int
+   for _, name := range columns {
+      k := d.ColumnIndex(name)
+      if k < 0 {
+         continue
+      }
+      p.Columns = append(p.Columns, name)
+      index = append(index, k)
+   }
+
+   err = d.Rows(func(line int, fields []string) error {
+      for k, name := range p.Columns {
+         f, err := ParseValue(fields[index[k]])
+         if err != nil {
+            return &ParseError{File: d.Name, Line: line, Err: err}
+         }
+         p.Data[name] = append(p.Data[name], f)
+      }
+      return nil
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   return p, nil
+
+}
+
+
+// directory holding LOGS of star 1 or star 2 of a run, empty if not available
+func (m *MESAInfo) StarLogDir (star int) string {
+
+   switch star {
+   case 1:
+      if m.Star1Filename != "" {
+         return filepath.Dir(m.Star1Filename)
+      }
+   case 2:
+      if m.Star2Filename != "" {
+         return filepath.Dir(m.Star2Filename)
+      }
+   }
+
+   return ""
+
+}
@@ -0,0 +1,308 @@
+package mesa
+
+import (
+   "fmt"
+   "math"
+   "strconv"
+   "strings"
+)
+
+
+// phase of evolution of a star
+type EvolStage int
+
+const (
+   StageUnknown EvolStage = iota
+   StagePreMS
+   StageMS
+   StageTAMS
+   StageHG
+   StageRGB
+   StageCHeB
+   StageStrippedHe
+   StageHeDepleted
+   StageStrippedHeDepleted
+   StageAGB
+   StageCoreCBurning
+   StageCoreNeBurning
+   StageCoreOBurning
+   StageCoreCollapse
+   StageWD
+   StageNS
+   StageBH
+)
+
+var stageNames = map[EvolStage]string{
+   StageUnknown: "unknown",
+   StagePreMS: "pre-MS star",
+   StageMS: "MS star",
+   StageTAMS: "TAMS star",
+   StageHG: "HG star",
+   StageRGB: "RGB star",
+   StageCHeB: "CHeB star",
+   StageStrippedHe: "WR / stripped He star",
+   StageHeDepleted: "He depleted star",
+   StageStrippedHeDepleted: "He depleted stripped star",
+   StageAGB: "AGB star",
+   StageCoreCBurning: "core C burning star",
+   StageCoreNeBurning: "core Ne burning star",
+   StageCoreOBurning: "core O burning star",
+   StageCoreCollapse: "core collapse",
+   StageWD: "WD",
+   StageNS: "NS",
+   StageBH: "BH",
+}
+
+func (s EvolStage) String() string {
+   if name, ok := stageNames[s]; ok {
+      return name
+   }
+   return "stage " + strconv.Itoa(int(s))
+}
+
+// stages are written by name in JSON
+func (s EvolStage) MarshalText() ([]byte, error) {
+   return []byte(s.String()), nil
+}
+
+// and read back from it, e.g. when stored
+func (s *EvolStage) UnmarshalText(text []byte) error {
+   for stage, name := range stageNames {
+      if name == string(text) {
+         *s = stage
+         return nil
+      }
+   }
+   if n, err := strconv.Atoi(strings.TrimPrefix(string(text), "stage ")); err == nil {
+      *s = EvolStage(n)
+      return nil
+   }
+   return fmt.Errorf("unknown evolutionary stage %q", text)
+}
+
+// whether the star is still a core H burning one (pre-MS, MS or at TAMS)
+func (s EvolStage) IsHBurning() bool {
+   return s == StagePreMS || s == StageMS || s == StageTAMS
+}
+
+// whether the star has depleted He in its core. stripped stars still burning He in their core are
+// not, the ones past it are
+func (s EvolStage) IsPostHe() bool {
+   return s >= StageHeDepleted
+}
+
+// whether this is the end point of evolution
+func (s EvolStage) IsCompact() bool {
+   return s == StageWD || s == StageNS || s == StageBH
+}
+
+
+// thresholds used to tell apart phases of evolution
+type StageThresholds struct {
+   // central mass fractions below which an element is depleted
+   H1Depleted, He4Depleted, C12Depleted, Ne20Depleted float64
+   // central H1 below which the star is said to be at TAMS
+   TAMSCenterH1 float64
+   // fraction of luminosity from H burning below which the star is still contracting to ZAMS
+   PreMSNuclearFraction float64
+   // log10 of central temperature for ignition of each element & for core collapse
+   LogTHeIgnition, LogTCIgnition, LogTNeIgnition, LogTOIgnition, LogTCoreCollapse float64
+   // log10 of luminosity (Lsun) above which a burning region is considered active
+   LogLBurning float64
+   // log10 of effective temperature below which a star is on the giant branches
+   LogTeffGiant float64
+   // surface H1 or He core to total mass fraction for a star to be considered stripped
+   SurfaceH1Stripped, StrippedCoreFraction float64
+   // largest masses (Msun) of WDs & NSs
+   ChandraMass, MaxNSMass float64
+}
+
+// thresholds used when none are given
+var DefaultStageThresholds = StageThresholds{
+   H1Depleted: 1e-5,
+   He4Depleted: 1e-4,
+   C12Depleted: 1e-4,
+   Ne20Depleted: 1e-4,
+   TAMSCenterH1: 1e-3,
+   PreMSNuclearFraction: 0.9,
+   LogTHeIgnition: 7.8,
+   LogTCIgnition: 8.8,
+   LogTNeIgnition: 9.1,
+   LogTOIgnition: 9.3,
+   LogTCoreCollapse: 9.9,
+   LogLBurning: -1,
+   LogTeffGiant: 3.7,
+   SurfaceH1Stripped: 0.1,
+   StrippedCoreFraction: 0.95,
+   ChandraMass: 1.4,
+   MaxNSMass: 2.5,
+}
+
+
+// values of a star used to define its phase of evolution. columns not present in history are NaN
+type StageInput struct {
+   Mass float64 `column:"star_mass"`
+   CenterH1 float64 `column:"center_h1"`
+   CenterHe4 float64 `column:"center_he4"`
+   CenterC12 float64 `column:"center_c12"`
+   CenterNe20 float64 `column:"center_ne20"`
+   LogTcntr float64 `column:"log_center_T"`
+   LogTeff float64 `column:"log_Teff"`
+   LogL float64 `column:"log_L"`
+   LogLH float64 `column:"log_LH"`
+   LogLHe float64 `column:"log_LHe"`
+   SurfaceH1 float64 `column:"surface_h1"`
+   HeCoreMass float64 `column:"he_core_mass"`
+}
+
+
+// input with every value unknown
+func NewStageInput () StageInput {
+
+   nan := math.NaN()
+   return StageInput{nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan}
+
+}
+
+
+// stage input from a row of a history file
+func stageInputFromRow (names, values []string) StageInput {
+
+   in := NewStageInput()
+
+   // values that fail to parse just stay unknown
+   _ = assignFields(&in, columnTag, names, values)
+
+   return in
+
+}
+
+
+func isKnown (v float64) bool {
+   return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func formatValue (v float64) string {
+   return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+
+// define phase of evolution of a star, also returning the reason for it. a nil t uses
+// DefaultStageThresholds
+func ClassifyStage (in StageInput, t *StageThresholds) (EvolStage, string) {
+
+   if t == nil {
+      t = &DefaultStageThresholds
+   }
+
+   if isKnown(in.LogTcntr) && in.LogTcntr >= t.LogTCoreCollapse {
+      return StageCoreCollapse, "log_center_T = " + formatValue(in.LogTcntr) + " >= " + formatValue(t.LogTCoreCollapse)
+   }
+
+   if !isKnown(in.CenterH1) {
+      return StageUnknown, "center_h1 not available"
+   }
+
+   // core H burning
+   if in.CenterH1 > t.H1Depleted {
+
+      if isKnown(in.LogLH) && isKnown(in.LogL) && in.LogLH < in.LogL + math.Log10(t.PreMSNuclearFraction) {
+         return StagePreMS, "log_LH = " + formatValue(in.LogLH) + " well below log_L = " + formatValue(in.LogL)
+      }
+
+      if in.CenterH1 < t.TAMSCenterH1 {
+         return StageTAMS, "center_h1 = " + formatValue(in.CenterH1) + " < " + formatValue(t.TAMSCenterH1)
+      }
+
+      return StageMS, "center_h1 = " + formatValue(in.CenterH1) + " > " + formatValue(t.H1Depleted)
+   }
+
+   // most of the star being a He core or with almost no H on its surface
+   stripped := isKnown(in.SurfaceH1) && in.SurfaceH1 < t.SurfaceH1Stripped
+   if isKnown(in.HeCoreMass) && isKnown(in.Mass) && in.Mass > 0 && in.HeCoreMass / in.Mass >= t.StrippedCoreFraction {
+      stripped = true
+   }
+
+   cool := isKnown(in.LogTeff) && in.LogTeff < t.LogTeffGiant
+
+   // H depleted, He still in core
+   if !isKnown(in.CenterHe4) {
+      return StageUnknown, "center_he4 not available"
+   }
+   if in.CenterHe4 > t.He4Depleted {
+
+      // rely on central temperature for He ignition, He luminosity otherwise
+      heBurning := false
+      if isKnown(in.LogTcntr) {
+         heBurning = in.LogTcntr >= t.LogTHeIgnition
+      } else if isKnown(in.LogLHe) {
+         heBurning = in.LogLHe > t.LogLBurning
+      }
+
+      if heBurning {
+         if stripped {
+            return StageStrippedHe, "core He burning with surface_h1 = " + formatValue(in.SurfaceH1)
+         }
+         return StageCHeB, "center_he4 = " + formatValue(in.CenterHe4) + " with He ignited"
+      }
+
+      if cool {
+         return StageRGB, "H depleted, He not ignited and log_Teff = " + formatValue(in.LogTeff) + " < " + formatValue(t.LogTeffGiant)
+      }
+
+      return StageHG, "H depleted, He not ignited"
+   }
+
+   // past core He depletion, look for advanced burning stages
+   if isKnown(in.LogTcntr) {
+      if in.LogTcntr >= t.LogTOIgnition && (!isKnown(in.CenterNe20) || in.CenterNe20 < t.Ne20Depleted) {
+         return StageCoreOBurning, "log_center_T = " + formatValue(in.LogTcntr) + " >= " + formatValue(t.LogTOIgnition)
+      }
+      if in.LogTcntr >= t.LogTNeIgnition && (!isKnown(in.CenterC12) || in.CenterC12 < t.C12Depleted) {
+         return StageCoreNeBurning, "log_center_T = " + formatValue(in.LogTcntr) + " >= " + formatValue(t.LogTNeIgnition)
+      }
+      if in.LogTcntr >= t.LogTCIgnition {
+         return StageCoreCBurning, "log_center_T = " + formatValue(in.LogTcntr) + " >= " + formatValue(t.LogTCIgnition)
+      }
+   }
+
+   if stripped && isKnown(in.Mass) && in.Mass >= t.ChandraMass {
+      return StageStrippedHeDepleted, "He depleted with surface_h1 = " + formatValue(in.SurfaceH1)
+   }
+
+   // chandra mass separates between WD & stars that might go on burning
+   if isKnown(in.Mass) && in.Mass < t.ChandraMass {
+      shellBurning := (isKnown(in.LogLH) && in.LogLH > t.LogLBurning) || (isKnown(in.LogLHe) && in.LogLHe > t.LogLBurning)
+      if shellBurning && cool {
+         return StageAGB, "He depleted with shell burning and log_Teff = " + formatValue(in.LogTeff)
+      }
+      return StageWD, "He depleted and mass = " + formatValue(in.Mass) + " < " + formatValue(t.ChandraMass)
+   }
+
+   if cool {
+      return StageAGB, "He depleted and log_Teff = " + formatValue(in.LogTeff) + " < " + formatValue(t.LogTeffGiant)
+   }
+
+   return StageHeDepleted, "center_he4 = " + formatValue(in.CenterHe4) + " < " + formatValue(t.He4Depleted)
+
+}
+
+
+// define the kind of compact object of a point mass. a nil t uses DefaultStageThresholds
+func ClassifyPointMass (mass float64, t *StageThresholds) (EvolStage, string) {
+
+   if t == nil {
+      t = &DefaultStageThresholds
+   }
+
+   if mass < t.ChandraMass {
+      return StageWD, "point mass of " + formatValue(mass) + " < " + formatValue(t.ChandraMass) + " Msun"
+   }
+
+   if mass <= t.MaxNSMass {
+      return StageNS, "point mass of " + formatValue(mass) + " <= " + formatValue(t.MaxNSMass) + " Msun"
+   }
+
+   return StageBH, "point mass of " + formatValue(mass) + " > " + formatValue(t.MaxNSMass) + " Msun"
+
+}
@@ -0,0 +1,117 @@
+package mesa
+
+import (
+   "math"
+   "testing"
+)
+
+
+// stages found on each side of the default thresholds
+func TestClassifyStage (t *testing.T) {
+
+   // H depleted star burning He in its core, & one past core He depletion
+   heBurning := func(in *StageInput) {
+      in.CenterH1, in.CenterHe4, in.LogTcntr, in.SurfaceH1, in.Mass, in.LogTeff = 0, 0.5, 8, 0.7, 10, 4
+   }
+   heDepleted := func(in *StageInput) {
+      heBurning(in)
+      in.CenterHe4, in.LogTcntr = 1e-4, 8.5
+   }
+
+   cases := []struct {
+      name string
+      base func(*StageInput)
+      set func(*StageInput)
+      want EvolStage
+   }{
+      {"core collapse", nil, func(in *StageInput) { in.LogTcntr = 9.9 }, StageCoreCollapse},
+      {"below core collapse without center_h1", nil, func(in *StageInput) { in.LogTcntr = 9.89 }, StageUnknown},
+
+      {"MS", nil, func(in *StageInput) { in.CenterH1 = 0.5 }, StageMS},
+      {"MS at TAMSCenterH1", nil, func(in *StageInput) { in.CenterH1 = 1e-3 }, StageMS},
+      {"TAMS below TAMSCenterH1", nil, func(in *StageInput) { in.CenterH1 = 9.9e-4 }, StageTAMS},
+      {"pre-MS", nil, func(in *StageInput) { in.CenterH1, in.LogL, in.LogLH = 0.7, 1, 1 + math.Log10(0.9) - 0.01 }, StagePreMS},
+      {"MS at PreMSNuclearFraction", nil, func(in *StageInput) { in.CenterH1, in.LogL, in.LogLH = 0.7, 1, 1 + math.Log10(0.9) }, StageMS},
+      {"H depleted at H1Depleted", heBurning, func(in *StageInput) { in.CenterH1 = 1e-5 }, StageCHeB},
+
+      {"CHeB at LogTHeIgnition", heBurning, func(in *StageInput) { in.LogTcntr = 7.8 }, StageCHeB},
+      {"HG below LogTHeIgnition", heBurning, func(in *StageInput) { in.LogTcntr = 7.79 }, StageHG},
+      {"HG at LogTeffGiant", heBurning, func(in *StageInput) { in.LogTcntr, in.LogTeff = 7.79, 3.7 }, StageHG},
+      {"RGB below LogTeffGiant", heBurning, func(in *StageInput) { in.LogTcntr, in.LogTeff = 7.79, 3.69 }, StageRGB},
+      {"CHeB from log_LHe", heBurning, func(in *StageInput) { in.LogTcntr, in.LogLHe = math.NaN(), -0.99 }, StageCHeB},
+      {"HG at LogLBurning", heBurning, func(in *StageInput) { in.LogTcntr, in.LogLHe = math.NaN(), -1 }, StageHG},
+      {"without center_he4", heBurning, func(in *StageInput) { in.CenterHe4 = math.NaN() }, StageUnknown},
+
+      {"stripped below SurfaceH1Stripped", heBurning, func(in *StageInput) { in.SurfaceH1 = 0.099 }, StageStrippedHe},
+      {"CHeB at SurfaceH1Stripped", heBurning, func(in *StageInput) { in.SurfaceH1 = 0.1 }, StageCHeB},
+      {"stripped at StrippedCoreFraction", heBurning, func(in *StageInput) { in.HeCoreMass = 9.5 }, StageStrippedHe},
+      {"CHeB below StrippedCoreFraction", heBurning, func(in *StageInput) { in.HeCoreMass = 9.49 }, StageCHeB},
+
+      {"He depleted at He4Depleted", heDepleted, nil, StageHeDepleted},
+      {"CHeB above He4Depleted", heDepleted, func(in *StageInput) { in.CenterHe4 = 1.01e-4 }, StageCHeB},
+      {"core C burning at LogTCIgnition", heDepleted, func(in *StageInput) { in.LogTcntr = 8.8 }, StageCoreCBurning},
+      {"He depleted below LogTCIgnition", heDepleted, func(in *StageInput) { in.LogTcntr = 8.79 }, StageHeDepleted},
+      {"core Ne burning at LogTNeIgnition", heDepleted, func(in *StageInput) { in.LogTcntr = 9.1 }, StageCoreNeBurning},
+      {"core C burning at C12Depleted", heDepleted, func(in *StageInput) { in.LogTcntr, in.CenterC12 = 9.1, 1e-4 }, StageCoreCBurning},
+      {"core Ne burning below C12Depleted", heDepleted, func(in *StageInput) { in.LogTcntr, in.CenterC12 = 9.1, 9.9e-5 }, StageCoreNeBurning},
+      {"core O burning at LogTOIgnition", heDepleted, func(in *StageInput) { in.LogTcntr = 9.3 }, StageCoreOBurning},
+      {"core Ne burning at Ne20Depleted", heDepleted, func(in *StageInput) { in.LogTcntr, in.CenterNe20 = 9.3, 1e-4 }, StageCoreNeBurning},
+
+      {"stripped at ChandraMass", heDepleted, func(in *StageInput) { in.SurfaceH1, in.Mass = 0.01, 1.4 }, StageStrippedHeDepleted},
+      {"WD below ChandraMass", heDepleted, func(in *StageInput) { in.SurfaceH1, in.Mass = 0.01, 1.39 }, StageWD},
+      {"He depleted at ChandraMass", heDepleted, func(in *StageInput) { in.Mass = 1.4 }, StageHeDepleted},
+      {"AGB below ChandraMass", heDepleted, func(in *StageInput) { in.Mass, in.LogLHe, in.LogTeff = 1, 0, 3.6 }, StageAGB},
+      {"AGB below LogTeffGiant", heDepleted, func(in *StageInput) { in.LogTeff = 3.69 }, StageAGB},
+   }
+
+   for _, c := range cases {
+      in := NewStageInput()
+      if c.base != nil {
+         c.base(&in)
+      }
+      if c.set != nil {
+         c.set(&in)
+      }
+      got, reason := ClassifyStage(in, nil)
+      if got != c.want {
+         t.Errorf("%s: got %s (%s), want %s", c.name, got, reason, c.want)
+      }
+      if reason == "" {
+         t.Errorf("%s: no reason given", c.name)
+      }
+   }
+
+}
+
+
+func TestClassifyPointMass (t *testing.T) {
+
+   cases := []struct {
+      mass float64
+      want EvolStage
+   }{
+      {0.6, StageWD},
+      {1.39, StageWD},
+      {1.4, StageNS},
+      {2.5, StageNS},
+      {2.51, StageBH},
+      {30, StageBH},
+   }
+
+   for _, c := range cases {
+      if got, reason := ClassifyPointMass(c.mass, nil); got != c.want {
+         t.Errorf("mass %g: got %s (%s), want %s", c.mass, got, reason, c.want)
+      }
+   }
+
+   // other thresholds
+   th := DefaultStageThresholds
+   th.ChandraMass, th.MaxNSMass = 1.2, 3
+   if got, _ := ClassifyPointMass(1.3, &th); got != StageNS {
+      t.Errorf("got %s with ChandraMass 1.2", got)
+   }
+   if got, _ := ClassifyPointMass(2.9, &th); got != StageNS {
+      t.Errorf("got %s with MaxNSMass 3", got)
+   }
+
+}
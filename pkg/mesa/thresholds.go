@@ -0,0 +1,58 @@
+package mesa
+
+import (
+   "encoding/json"
+   "fmt"
+   "os"
+)
+
+
+// thresholds of the stage & MT classifiers, as set in a config file
+type Thresholds struct {
+   Stage StageThresholds
+   MT MTThresholds
+}
+
+
+// thresholds from a JSON file such as {"Stage": {"ChandraMass": 1.38}, "MT": {"CELogMdot": -1.5}}.
+// those not in the file keep their default value
+func LoadThresholds (filename string) (*Thresholds, error) {
+
+   t := &Thresholds{Stage: DefaultStageThresholds, MT: DefaultMTThresholds}
+
+   data, err := os.ReadFile(filename)
+   if err != nil {
+      return nil, err
+   }
+
+   if err := json.Unmarshal(data, t); err != nil {
+      return nil, fmt.Errorf("bad thresholds in %s: %w", filename, err)
+   }
+
+   return t, nil
+
+}
+
+
+// stage thresholds, nil (i.e. the defaults) for a nil t
+func (t *Thresholds) ForStage () *StageThresholds {
+
+   if t == nil {
+      return nil
+   }
+
+   return &t.Stage
+
+}
+
+
+// MT thresholds, nil (i.e. the defaults) for a nil t
+func (t *Thresholds) ForMT () *MTThresholds {
+
+   if t == nil {
+      return nil
+   }
+
+   return &t.MT
+
+}
@@ -0,0 +1,190 @@
+package mesa
+
+import (
+   "math"
+   "strconv"
+
+   "web-service/pkg/io"
+)
+
+
+// kind of event found along a binary history
+type EventKind string
+
+const (
+   EventRLOFStart EventKind = "RLOF start"
+   EventRLOFEnd EventKind = "RLOF end"
+   EventMTCase EventKind = "MT case"
+   EventContact EventKind = "contact"
+   EventCommonEnvelope EventKind = "common envelope"
+   EventPeriodMin EventKind = "period minimum"
+   EventPeriodMax EventKind = "period maximum"
+   EventMassRatioInversion EventKind = "mass ratio inversion"
+   EventDonorSwap EventKind = "donor swap"
+   EventPointMass EventKind = "point mass formation"
+)
+
+
+// a single event in the evolution of a binary
+type Event struct {
+   Kind EventKind
+   ModelNumber int
+   Age float64
+   Star int
+   Description string
+}
+
+
+// events of a whole binary history plus the MT state at its end
+type Timeline struct {
+   Events []Event
+   FinalMT MTState
+}
+
+
+// values of a binary history row needed for the timeline, besides those in MTInput
+type timelineInput struct {
+   Period float64 `column:"period_days"`
+   Star1Mass float64 `column:"star_1_mass"`
+   Star2Mass float64 `column:"star_2_mass"`
+   PointMassIndex float64 `column:"point_mass_index"`
+}
+
+
+// scan the full binary history (and stars histories, for their phase of evolution) to find
+// onset & end of RLOF of each star, MT case transitions, contact & common envelope phases,
+// period extremes, mass ratio inversions, donor swaps and formation of point masses. histories are
+// read out of cache when not nil
+func BuildTimeline (binaryFile, star1File, star2File string, t *Thresholds, cache *HistoryCache) (*Timeline, error) {
+
+   io.LogInfo("MESA - timeline.go - BuildTimeline", "building timeline from " + binaryFile)
+
+   timeline := new(Timeline)
+
+   var prev MTInput
+   var prevState MTState
+   var prevExtra timelineInput
+   first := true
+
+   // period extremes are only known once the whole history is read
+   minPeriod, maxPeriod := Event{Kind: EventPeriodMin}, Event{Kind: EventPeriodMax}
+   minPeriodValue, maxPeriodValue := math.Inf(1), math.Inf(-1)
+   var firstModel, lastModel int
+
+   add := func(kind EventKind, in MTInput, star int, description string) {
+      timeline.Events = append(timeline.Events, Event{
+         Kind: kind,
+         ModelNumber: int(in.ModelNumber),
+         Age: in.Age,
+         Star: star,
+         Description: description,
+      })
+   }
+
+   columns := tagNames(&timelineInput{}, columnTag)
+   err := ScanMTHistory(binaryFile, star1File, star2File, t, cache, columns, func(names []string, values []float64, in MTInput, state MTState) error {
+
+      extra := timelineInput{math.NaN(), math.NaN(), math.NaN(), math.NaN()}
+      assignValues(&extra, columnTag, names, values)
+
+      model := int(in.ModelNumber)
+      lastModel = model
+
+      if isKnown(extra.Period) {
+         if extra.Period < minPeriodValue {
+            minPeriodValue = extra.Period
+            minPeriod.ModelNumber, minPeriod.Age = model, in.Age
+         }
+         if extra.Period > maxPeriodValue {
+            maxPeriodValue = extra.Period
+            maxPeriod.ModelNumber, maxPeriod.Age = model, in.Age
+         }
+      }
+
+      if first {
+         first = false
+         firstModel = model
+         prev, prevState, prevExtra = in, state, extra
+         if state.Case != MTNone {
+            add(EventMTCase, in, state.Donor, state.String() + " from the start")
+         }
+         return nil
+      }
+
+      // RLOF of each star
+      for star, pair := range [][2]float64{{prev.RelRLOF1, in.RelRLOF1}, {prev.RelRLOF2, in.RelRLOF2}} {
+         was := isKnown(pair[0]) && pair[0] > 0
+         is := isKnown(pair[1]) && pair[1] > 0
+         if !was && is {
+            add(EventRLOFStart, in, star+1, "star " + strconv.Itoa(star+1) + " overflows its Roche lobe")
+         }
+         if was && !is {
+            add(EventRLOFEnd, in, star+1, "star " + strconv.Itoa(star+1) + " detaches from its Roche lobe")
+         }
+      }
+
+      // changes of MT phase
+      if state.Case != prevState.Case && state.Case != MTNone {
+         add(EventMTCase, in, state.Donor, state.String() + ": " + state.Reason)
+      }
+      if state.Contact && !prevState.Contact {
+         add(EventContact, in, 0, "both stars overflow their Roche lobes")
+      }
+      if state.CommonEnvelope && !prevState.CommonEnvelope {
+         add(EventCommonEnvelope, in, state.Donor, "onset of common envelope: " + state.Reason)
+      }
+
+      // mass ratio crossing unity
+      if isKnown(extra.Star1Mass) && isKnown(extra.Star2Mass) && isKnown(prevExtra.Star1Mass) && isKnown(prevExtra.Star2Mass) {
+         if (prevExtra.Star1Mass - prevExtra.Star2Mass) * (extra.Star1Mass - extra.Star2Mass) < 0 {
+            add(EventMassRatioInversion, in, 0, "star 1 mass = " + formatValue(extra.Star1Mass) + ", star 2 mass = " + formatValue(extra.Star2Mass))
+         }
+      }
+
+      if isKnown(in.DonorIndex) && isKnown(prev.DonorIndex) && in.DonorIndex != prev.DonorIndex {
+         add(EventDonorSwap, in, int(in.DonorIndex), "donor changes from star " + formatValue(prev.DonorIndex) + " to star " + formatValue(in.DonorIndex))
+      }
+
+      if isKnown(extra.PointMassIndex) && isKnown(prevExtra.PointMassIndex) && extra.PointMassIndex != prevExtra.PointMassIndex && extra.PointMassIndex > 0 {
+         add(EventPointMass, in, int(extra.PointMassIndex), "star " + formatValue(extra.PointMassIndex) + " becomes a point mass")
+      }
+
+      prev, prevState, prevExtra = in, state, extra
+
+      return nil
+
+   })
+   if err != nil {
+      return timeline, err
+   }
+
+   // extremes at either end of the history are not turning points
+   if !first {
+      timeline.FinalMT = prevState
+      for _, extreme := range []struct{ event Event; value float64 }{{minPeriod, minPeriodValue}, {maxPeriod, maxPeriodValue}} {
+         if math.IsInf(extreme.value, 0) || extreme.event.ModelNumber == firstModel || extreme.event.ModelNumber == lastModel {
+            continue
+         }
+         extreme.event.Description = "period = " + formatValue(extreme.value) + " days"
+         timeline.insert(extreme.event)
+      }
+   }
+
+   return timeline, nil
+
+}
+
+
+// add an event keeping events sorted by model number
+func (t *Timeline) insert (event Event) {
+
+   k := len(t.Events)
+   for k > 0 && t.Events[k-1].ModelNumber > event.ModelNumber {
+      k--
+   }
+
+   t.Events = append(t.Events, Event{})
+   copy(t.Events[k+1:], t.Events[k:])
+   t.Events[k] = event
+
+}
@@ -47,82 +47,18 @@ func IsBinary (path string) bool {
 
 
 // define phase of evolution for a star based on abundances and central temperature
+//
+// Deprecated: use ClassifyStage, which can take more history columns into account
 func SetEvolutionaryStage(mass float64, center_h1 float64, center_he4 float64, log_T_cntr float64) string {
 
-   // H threshold
-   h1_threshold := 1e-5
+   in := NewStageInput()
+   in.Mass = mass
+   in.CenterH1 = center_h1
+   in.CenterHe4 = center_he4
+   in.LogTcntr = log_T_cntr
 
-   // He$ threshold
-   he4_threshold := 1e-4
+   stage, _ := ClassifyStage(in, nil)
 
-   // log T for He ignition
-   log_he_temp := 7.8
-
-   // chandra mass
-   chandra_mass := 1.4
-
-   // Main sequence star
-   if (center_h1 > h1_threshold) {
-      return "MS star"
-   }
-
-   // Hertzsprung gap star or WD
-   if (log_T_cntr < log_he_temp) {
-
-      // depending on the center He4 value, either HG star of becoming WD or ECSN
-      if (center_he4 < he4_threshold) {
-
-         // chandra mass separates between WD & ECSN
-         if (mass < chandra_mass) {
-            return "WD"
-         } else {
-            return "He depleted star, possible EC SN"
-         }
-
-      } else {
-
-         // HG star
-         return "HG star"
-      }
-   }
-
-   // core He burning star
-   if (center_he4 > he4_threshold) {
-
-      return "CHeB star"
-
-   } else {
-
-      // already past core He depletion
-      // chandra mass separates between WD & ECSN
-      if (mass < chandra_mass) {
-         return "WD"
-      } else {
-         return "He depleted star"
-      }
-   }
-
-}
-
-
-// check for MT case in a binary
-func SetMTCase(rel_rlof float64, stage string) string {
-
-   // if no RLOF, no MT phase
-   if (rel_rlof < 0) {
-
-      return "No MT (R < RL)"
-
-   } else {
-
-      if (stage == "MS star") {return "Case A"}
-
-      if (stage == "HG star") {return "early Case B"}
-
-      if (stage == "CheB star") {return "Case B"}
-
-      return "Case C"
-
-   }
+   return stage.String()
 
 }
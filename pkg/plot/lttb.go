@@ -0,0 +1,130 @@
+package plot
+
+import (
+   "math"
+)
+
+
+// indexes of points kept when reducing a series to at most threshold points using the
+// Largest-Triangle-Three-Buckets algorithm (Steinarsson 2013). first & last points are kept unless
+// threshold is 1, which only keeps the first one; points with NaN or Inf in x or y are ignored
+func LTTB (x, y []float64, threshold int) []int {
+
+   // only finite points can be used to compute triangle areas
+   var valid []int
+   n := len(x)
+   if len(y) < n {
+      n = len(y)
+   }
+   for i := 0; i < n; i++ {
+      if isFinite(x[i]) && isFinite(y[i]) {
+         valid = append(valid, i)
+      }
+   }
+
+   if threshold <= 0 || threshold >= len(valid) {
+      return valid
+   }
+   if threshold == 1 {
+      return valid[:1]
+   }
+   if threshold == 2 {
+      return []int{valid[0], valid[len(valid)-1]}
+   }
+
+   kept := make([]int, 0, threshold)
+   kept = append(kept, valid[0])
+
+   // size of each bucket, leaving first & last points out
+   every := float64(len(valid) - 2) / float64(threshold - 2)
+   a := 0
+
+   for b := 0; b < threshold - 2; b++ {
+
+      // average point of next bucket
+      avgStart := int(math.Floor(float64(b + 1) * every)) + 1
+      avgEnd := int(math.Floor(float64(b + 2) * every)) + 1
+      if avgEnd > len(valid) {
+         avgEnd = len(valid)
+      }
+      avgX, avgY := 0.0, 0.0
+      for _, i := range valid[avgStart:avgEnd] {
+         avgX += x[i]
+         avgY += y[i]
+      }
+      count := float64(avgEnd - avgStart)
+      avgX /= count
+      avgY /= count
+
+      // point of current bucket making the largest triangle with last kept point & next average
+      start := int(math.Floor(float64(b) * every)) + 1
+      end := int(math.Floor(float64(b + 1) * every)) + 1
+      ax, ay := x[valid[a]], y[valid[a]]
+      maxArea := -1.0
+      next := start
+      for k := start; k < end; k++ {
+         i := valid[k]
+         area := math.Abs((ax - avgX) * (y[i] - ay) - (ax - x[i]) * (avgY - ay))
+         if area > maxArea {
+            maxArea = area
+            next = k
+         }
+      }
+
+      kept = append(kept, valid[next])
+      a = next
+
+   }
+
+   return append(kept, valid[len(valid)-1])
+
+}
+
+
+// values of series at the given indexes
+func Pick (values []float64, index []int) []float64 {
+
+   picked := make([]float64, len(index))
+   for k, i := range index {
+      picked[k] = values[i]
+   }
+
+   return picked
+
+}
+
+
+func isFinite (v float64) bool {
+   return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+
+// indexes of points kept when reducing a series to at most max points, measuring triangle areas
+// on log10 of values for log axes so the shape of the plotted curve is what gets preserved
+func Downsample (x, y []float64, logX, logY bool, max int) []int {
+
+   tx := &axis{log: logX}
+   ty := &axis{log: logY}
+
+   if logX {
+      x = transformAll(tx, x)
+   }
+   if logY {
+      y = transformAll(ty, y)
+   }
+
+   return LTTB(x, y, max)
+
+}
+
+
+func transformAll (a *axis, values []float64) []float64 {
+
+   t := make([]float64, len(values))
+   for k, v := range values {
+      t[k] = a.transform(v)
+   }
+
+   return t
+
+}
@@ -0,0 +1,131 @@
+package plot
+
+import (
+   "fmt"
+   "math"
+   "testing"
+)
+
+
+// series of n points with some noise, so that every bucket has a point standing out
+func wavySeries (n int) ([]float64, []float64) {
+
+   x := make([]float64, n)
+   y := make([]float64, n)
+   for i := range x {
+      x[i] = float64(i)
+      y[i] = math.Sin(float64(i) / 7) + 0.1 * math.Sin(float64(i) * 1.3)
+   }
+
+   return x, y
+
+}
+
+
+// never more points than asked for, first & last kept, indexes increasing
+func TestLTTBPointCount (t *testing.T) {
+
+   x, y := wavySeries(100)
+
+   for _, threshold := range []int{1, 2, 3, 4, 10, 50, 99, 100, 150, 0, -1} {
+
+      kept := LTTB(x, y, threshold)
+
+      want := threshold
+      if threshold <= 0 || threshold > len(x) {
+         want = len(x)
+      }
+      if len(kept) != want {
+         t.Errorf("threshold %d: got %d points, want %d", threshold, len(kept), want)
+         continue
+      }
+      if kept[0] != 0 {
+         t.Errorf("threshold %d: first point not kept: %v", threshold, kept[:1])
+      }
+      if threshold != 1 && kept[len(kept)-1] != len(x) - 1 {
+         t.Errorf("threshold %d: last point not kept", threshold)
+      }
+      for k := 1; k < len(kept); k++ {
+         if kept[k] <= kept[k-1] {
+            t.Errorf("threshold %d: indexes not increasing: %v", threshold, kept)
+            break
+         }
+      }
+
+   }
+
+}
+
+
+// points with NaN or Inf are never kept, nor used for areas
+func TestLTTBDropsNaN (t *testing.T) {
+
+   x, y := wavySeries(50)
+   y[0] = math.NaN()
+   y[10] = math.Inf(1)
+   x[20] = math.NaN()
+   y[49] = math.NaN()
+
+   kept := LTTB(x, y, 10)
+   if len(kept) != 10 || kept[0] != 1 || kept[len(kept)-1] != 48 {
+      t.Errorf("got %v, want 10 points from 1 to 48", kept)
+   }
+   for _, i := range kept {
+      if !isFinite(x[i]) || !isFinite(y[i]) {
+         t.Errorf("kept point %d at (%g, %g)", i, x[i], y[i])
+      }
+   }
+
+   // nothing to reduce: every valid point
+   if got := fmt.Sprint(LTTB([]float64{0, 1, 2, 3}, []float64{1, math.NaN(), 2, 3}, 0)); got != "[0 2 3]" {
+      t.Errorf("got %s", got)
+   }
+   if got := LTTB([]float64{0, 1}, []float64{math.NaN(), math.NaN()}, 5); len(got) != 0 {
+      t.Errorf("got %v out of NaN points", got)
+   }
+
+}
+
+
+// peaks & troughs of a small series are the points kept
+func TestLTTBKnownSeries (t *testing.T) {
+
+   x := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+   y := []float64{0, 0, 0, 10, 0, 0, -10, 0, 0, 0}
+
+   cases := map[int]string{
+      4: "[0 3 6 9]",
+      2: "[0 9]",
+      1: "[0]",
+      10: "[0 1 2 3 4 5 6 7 8 9]",
+   }
+   for threshold, want := range cases {
+      if got := fmt.Sprint(LTTB(x, y, threshold)); got != want {
+         t.Errorf("threshold %d: got %s, want %s", threshold, got, want)
+      }
+   }
+
+   if got := fmt.Sprint(Pick(y, LTTB(x, y, 4))); got != "[0 10 -10 0]" {
+      t.Errorf("got values %s", got)
+   }
+
+}
+
+
+// on log axes areas are measured on log10 of values
+func TestDownsampleLog (t *testing.T) {
+
+   x := make([]float64, 40)
+   y := make([]float64, 40)
+   for i := range x {
+      x[i] = math.Pow(10, float64(i) / 4)
+      y[i] = 1
+   }
+   y[5] = 1e3
+
+   kept := Downsample(x, y, true, true, 4)
+   if len(kept) != 4 || kept[1] != 5 {
+      t.Errorf("got %v, want the spike at 5 kept", kept)
+   }
+
+}
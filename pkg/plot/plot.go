@@ -0,0 +1,164 @@
+// Package plot provides server-side rendering of simple line plots as SVG
+package plot
+
+import (
+   "math"
+   "strconv"
+)
+
+
+// default size of plots, in pixels
+const DefaultWidth = 640
+const DefaultHeight = 440
+
+// margins around the plotting area, in pixels
+const marginLeft = 75
+const marginRight = 20
+const marginTop = 35
+const marginBottom = 50
+
+// colors used for each series, in order
+var palette = []string{
+   "#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f",
+}
+
+
+// a single set of points to draw, joined by lines or as separate markers
+type Series struct {
+   Label string
+   X, Y []float64
+   Color string
+   Markers bool
+}
+
+
+// plot with its axes options & series
+type Plot struct {
+   Title string
+   XLabel, YLabel string
+   LogX, LogY bool
+   InvertX, InvertY bool
+   Width, Height int
+   Series []Series
+}
+
+
+// axis range & mapping from data to pixels
+type axis struct {
+   min, max float64
+   log bool
+   invert bool
+   from, to float64
+}
+
+
+// value as plotted on axis (log10 for log axes), NaN if it cannot be shown
+func (a *axis) transform (v float64) float64 {
+
+   if a.log {
+      if v <= 0 {
+         return math.NaN()
+      }
+      return math.Log10(v)
+   }
+
+   return v
+
+}
+
+
+// pixel position of an already transformed value
+func (a *axis) pixel (v float64) float64 {
+
+   frac := (v - a.min) / (a.max - a.min)
+   if a.invert {
+      frac = 1 - frac
+   }
+
+   return a.from + frac * (a.to - a.from)
+
+}
+
+
+// set range of axis from all transformed values in values, padded by a small fraction
+func (a *axis) fit (values ...[]float64) bool {
+
+   a.min = math.Inf(1)
+   a.max = math.Inf(-1)
+
+   for _, vals := range values {
+      for _, v := range vals {
+         t := a.transform(v)
+         if math.IsNaN(t) || math.IsInf(t, 0) {
+            continue
+         }
+         a.min = math.Min(a.min, t)
+         a.max = math.Max(a.max, t)
+      }
+   }
+
+   if math.IsInf(a.min, 0) || math.IsInf(a.max, 0) {
+      a.min, a.max = 0, 1
+      return false
+   }
+
+   if a.max == a.min {
+      delta := math.Max(math.Abs(a.min) * 0.05, 0.5)
+      a.min -= delta
+      a.max += delta
+   } else {
+      pad := 0.03 * (a.max - a.min)
+      a.min -= pad
+      a.max += pad
+   }
+
+   return true
+
+}
+
+
+// tick positions between min & max with steps of 1, 2 or 5 times a power of ten
+func niceTicks (min, max float64, n int) []float64 {
+
+   if n < 2 || max <= min {
+      return nil
+   }
+
+   raw := (max - min) / float64(n)
+   magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+
+   step := magnitude
+   for _, m := range []float64{1, 2, 5, 10} {
+      step = m * magnitude
+      if step >= raw {
+         break
+      }
+   }
+
+   var ticks []float64
+   for t := math.Ceil(min / step) * step; t <= max + step * 1e-9; t += step {
+      // avoid printing -0 or 1e-17 instead of 0
+      if math.Abs(t) < step * 1e-9 {
+         t = 0
+      }
+      ticks = append(ticks, t)
+   }
+
+   return ticks
+
+}
+
+
+// label for a tick value
+func tickLabel (v float64, log bool) string {
+
+   if log {
+      if v == math.Trunc(v) {
+         return "1e" + strconv.FormatFloat(v, 'f', 0, 64)
+      }
+      return strconv.FormatFloat(math.Pow(10, v), 'g', 3, 64)
+   }
+
+   return strconv.FormatFloat(v, 'g', 4, 64)
+
+}
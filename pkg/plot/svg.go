@@ -0,0 +1,159 @@
+package plot
+
+import (
+   "bufio"
+   "fmt"
+   "html"
+   "io"
+   "math"
+)
+
+
+// radius of markers, in pixels
+const markerRadius = 4.0
+
+
+// render plot as an SVG document into w
+func (p *Plot) WriteSVG (w io.Writer) error {
+
+   width, height := p.Width, p.Height
+   if width <= 0 {
+      width = DefaultWidth
+   }
+   if height <= 0 {
+      height = DefaultHeight
+   }
+
+   xaxis := &axis{log: p.LogX, invert: p.InvertX, from: marginLeft, to: float64(width - marginRight)}
+   yaxis := &axis{log: p.LogY, invert: p.InvertY, from: float64(height - marginBottom), to: marginTop}
+
+   var xs, ys [][]float64
+   for _, s := range p.Series {
+      xs = append(xs, s.X)
+      ys = append(ys, s.Y)
+   }
+   xaxis.fit(xs...)
+   yaxis.fit(ys...)
+
+   out := bufio.NewWriter(w)
+
+   fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+   fmt.Fprintf(out, `<rect x="0" y="0" width="%d" height="%d" fill="white"/>`+"\n", width, height)
+
+   // title & axis labels
+   if p.Title != "" {
+      fmt.Fprintf(out, `<text x="%d" y="20" text-anchor="middle" font-size="14">%s</text>`+"\n", width/2, html.EscapeString(p.Title))
+   }
+   fmt.Fprintf(out, `<text x="%g" y="%d" text-anchor="middle">%s</text>`+"\n", (xaxis.from+xaxis.to)/2, height-10, html.EscapeString(p.XLabel))
+   fmt.Fprintf(out, `<text x="15" y="%g" text-anchor="middle" transform="rotate(-90 15 %g)">%s</text>`+"\n", (yaxis.from+yaxis.to)/2, (yaxis.from+yaxis.to)/2, html.EscapeString(p.YLabel))
+
+   // frame & ticks
+   fmt.Fprintf(out, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="black"/>`+"\n", marginLeft, marginTop, width-marginLeft-marginRight, height-marginTop-marginBottom)
+   for _, t := range niceTicks(xaxis.min, xaxis.max, 6) {
+      px := xaxis.pixel(t)
+      fmt.Fprintf(out, `<line x1="%.1f" y1="%g" x2="%.1f" y2="%g" stroke="black"/>`+"\n", px, yaxis.from, px, yaxis.from-5)
+      fmt.Fprintf(out, `<text x="%.1f" y="%g" text-anchor="middle">%s</text>`+"\n", px, yaxis.from+16, tickLabel(t, xaxis.log))
+   }
+   for _, t := range niceTicks(yaxis.min, yaxis.max, 6) {
+      py := yaxis.pixel(t)
+      fmt.Fprintf(out, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="black"/>`+"\n", xaxis.from, py, xaxis.from+5, py)
+      fmt.Fprintf(out, `<text x="%g" y="%.1f" text-anchor="end">%s</text>`+"\n", xaxis.from-4, py+4, tickLabel(t, yaxis.log))
+   }
+
+   // series, clipped to the plotting area
+   fmt.Fprintf(out, `<clipPath id="area"><rect x="%d" y="%d" width="%d" height="%d"/></clipPath>`+"\n", marginLeft, marginTop, width-marginLeft-marginRight, height-marginTop-marginBottom)
+   for k, s := range p.Series {
+      color := s.Color
+      if color == "" {
+         color = palette[k%len(palette)]
+      }
+      if s.Markers {
+         writeMarkers(out, xaxis, yaxis, s, color)
+      } else {
+         writePolylines(out, xaxis, yaxis, s, color)
+      }
+
+      // legend entry
+      if s.Label != "" {
+         y := marginTop + 15 + 16*k
+         if s.Markers {
+            fmt.Fprintf(out, `<circle cx="%d" cy="%d" r="%g" fill="%s"/>`+"\n", width-marginRight-110, y-4, markerRadius, color)
+         } else {
+            fmt.Fprintf(out, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"/>`+"\n", width-marginRight-120, y-4, width-marginRight-100, y-4, color)
+         }
+         fmt.Fprintf(out, `<text x="%d" y="%d">%s</text>`+"\n", width-marginRight-95, y, html.EscapeString(s.Label))
+      }
+   }
+
+   fmt.Fprintln(out, `</svg>`)
+
+   return out.Flush()
+
+}
+
+
+// draw a series as polylines, starting a new one at every point that cannot be shown. points
+// falling on the same pixel as the previous one are dropped, which keeps long histories light
+func writePolylines (out *bufio.Writer, xaxis, yaxis *axis, s Series, color string) {
+
+   n := len(s.X)
+   if len(s.Y) < n {
+      n = len(s.Y)
+   }
+
+   open := false
+   lastX, lastY := math.NaN(), math.NaN()
+
+   for i := 0; i < n; i++ {
+
+      tx, ty := xaxis.transform(s.X[i]), yaxis.transform(s.Y[i])
+      if math.IsNaN(tx) || math.IsNaN(ty) || math.IsInf(tx, 0) || math.IsInf(ty, 0) {
+         if open {
+            fmt.Fprintln(out, `"/>`)
+            open = false
+         }
+         continue
+      }
+
+      px := math.Round(xaxis.pixel(tx) * 10) / 10
+      py := math.Round(yaxis.pixel(ty) * 10) / 10
+      if open && px == lastX && py == lastY {
+         continue
+      }
+
+      if !open {
+         fmt.Fprintf(out, `<polyline clip-path="url(#area)" fill="none" stroke="%s" stroke-width="1.5" points="`, color)
+         open = true
+      }
+      fmt.Fprintf(out, "%g,%g ", px, py)
+      lastX, lastY = px, py
+
+   }
+
+   if open {
+      fmt.Fprintln(out, `"/>`)
+   }
+
+}
+
+
+// draw a series as a circle on each point, skipping points that cannot be shown
+func writeMarkers (out *bufio.Writer, xaxis, yaxis *axis, s Series, color string) {
+
+   n := len(s.X)
+   if len(s.Y) < n {
+      n = len(s.Y)
+   }
+
+   for i := 0; i < n; i++ {
+
+      tx, ty := xaxis.transform(s.X[i]), yaxis.transform(s.Y[i])
+      if math.IsNaN(tx) || math.IsNaN(ty) || math.IsInf(tx, 0) || math.IsInf(ty, 0) {
+         continue
+      }
+
+      fmt.Fprintf(out, `<circle clip-path="url(#area)" cx="%.1f" cy="%.1f" r="%g" fill="%s" fill-opacity="0.8"/>`+"\n", xaxis.pixel(tx), yaxis.pixel(ty), markerRadius, color)
+
+   }
+
+}
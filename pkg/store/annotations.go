@@ -0,0 +1,137 @@
+package store
+
+import (
+   "encoding/json"
+   "sort"
+   "strings"
+   "time"
+
+   bolt "go.etcd.io/bbolt"
+)
+
+
+// what users tell about a run: notes, tags, whether it is starred & who it belongs to
+type Annotation struct {
+   RunID string
+   RootDir string
+   Notes string
+   Tags []string
+   Starred bool
+   Owner string
+   UpdatedAt time.Time
+   UpdatedBy string
+}
+
+
+// whether the annotation has a tag, ignoring case
+func (a *Annotation) HasTag (tag string) bool {
+
+   for _, t := range a.Tags {
+      if strings.EqualFold(t, tag) {
+         return true
+      }
+   }
+
+   return false
+
+}
+
+
+// tags without spaces around, empty ones or repeated ones, sorted
+func CleanTags (tags []string) []string {
+
+   seen := make(map[string]bool)
+   clean := []string{}
+   for _, tag := range tags {
+      tag = strings.TrimSpace(tag)
+      if tag == "" || seen[strings.ToLower(tag)] {
+         continue
+      }
+      seen[strings.ToLower(tag)] = true
+      clean = append(clean, tag)
+   }
+   sort.Strings(clean)
+
+   return clean
+
+}
+
+
+// annotation of a run, nil if it has none
+func (s *Store) Annotation (runID string) (*Annotation, error) {
+
+   var a *Annotation
+   err := s.db.View(func(tx *bolt.Tx) error {
+      var found Annotation
+      ok, err := get(tx, annotationsBucket, []byte(runID), &found)
+      if ok {
+         a = &found
+      }
+      return err
+   })
+
+   return a, err
+
+}
+
+
+// annotations of every run, by run ID
+func (s *Store) Annotations () (map[string]*Annotation, error) {
+
+   annotations := make(map[string]*Annotation)
+   err := s.db.View(func(tx *bolt.Tx) error {
+      return tx.Bucket(annotationsBucket).ForEach(func(k, v []byte) error {
+         a := new(Annotation)
+         if err := json.Unmarshal(v, a); err != nil {
+            return err
+         }
+         annotations[string(k)] = a
+         return nil
+      })
+   })
+
+   return annotations, err
+
+}
+
+
+// change the annotation of a run with fn, starting from an empty one if it has none. it is read and
+// saved in a single transaction, so that concurrent updates of the same run are not lost
+func (s *Store) UpdateAnnotation (runID string, fn func(a *Annotation)) (*Annotation, error) {
+
+   a := &Annotation{RunID: runID}
+   err := s.db.Update(func(tx *bolt.Tx) error {
+      if _, err := get(tx, annotationsBucket, []byte(runID), a); err != nil {
+         return err
+      }
+      fn(a)
+      a.RunID = runID
+      a.Tags = CleanTags(a.Tags)
+      a.UpdatedAt = time.Now()
+      return put(tx, annotationsBucket, []byte(runID), a)
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   return a, nil
+
+}
+
+
+// every tag used, sorted
+func (s *Store) Tags () ([]string, error) {
+
+   annotations, err := s.Annotations()
+   if err != nil {
+      return nil, err
+   }
+
+   var tags []string
+   for _, a := range annotations {
+      tags = append(tags, a.Tags...)
+   }
+
+   return CleanTags(tags), nil
+
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+   "fmt"
+   "path/filepath"
+   "strings"
+   "sync"
+   "testing"
+)
+
+
+// store in a temporary directory, closed at the end of the test
+func openTestStore (t *testing.T) *Store {
+
+   t.Helper()
+
+   s, err := Open(filepath.Join(t.TempDir(), "service.db"))
+   if err != nil {
+      t.Fatal(err)
+   }
+   t.Cleanup(func() { s.Close() })
+
+   return s
+
+}
+
+
+func TestUpdateAnnotation (t *testing.T) {
+
+   s := openTestStore(t)
+
+   a, err := s.UpdateAnnotation("run1", func(a *Annotation) {
+      a.Notes = "first try"
+      a.Tags = []string{" grid ", "Grid", "", "bh"}
+   })
+   if err != nil {
+      t.Fatal(err)
+   }
+   if a.RunID != "run1" || a.UpdatedAt.IsZero() || strings.Join(a.Tags, ",") != "bh,grid" {
+      t.Errorf("got %+v", a)
+   }
+
+   // fn starts from what was saved, and cannot move it to another run
+   a, err = s.UpdateAnnotation("run1", func(a *Annotation) {
+      a.Starred = true
+      a.RunID = "run2"
+   })
+   if err != nil {
+      t.Fatal(err)
+   }
+   saved, err := s.Annotation("run1")
+   if err != nil || saved == nil {
+      t.Fatalf("got %+v, %v", saved, err)
+   }
+   if !saved.Starred || saved.Notes != "first try" || !saved.HasTag("BH") || a.RunID != "run1" {
+      t.Errorf("got %+v", saved)
+   }
+   if other, _ := s.Annotation("run2"); other != nil {
+      t.Errorf("annotation saved under another run: %+v", other)
+   }
+
+}
+
+
+// updates done at the same time on a run are all kept
+func TestUpdateAnnotationConcurrent (t *testing.T) {
+
+   s := openTestStore(t)
+
+   const updates = 20
+   var wg sync.WaitGroup
+   for k := 0; k < updates; k++ {
+      wg.Add(1)
+      go func(k int) {
+         defer wg.Done()
+         _, err := s.UpdateAnnotation("run1", func(a *Annotation) {
+            a.Tags = append(a.Tags, fmt.Sprintf("tag%02d", k))
+         })
+         if err != nil {
+            t.Error(err)
+         }
+      }(k)
+   }
+   wg.Wait()
+
+   a, err := s.Annotation("run1")
+   if err != nil {
+      t.Fatal(err)
+   }
+   if len(a.Tags) != updates {
+      t.Errorf("got %d tags, want %d: %v", len(a.Tags), updates, a.Tags)
+   }
+
+}
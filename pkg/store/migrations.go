@@ -0,0 +1,107 @@
+package store
+
+import (
+   "encoding/binary"
+   "fmt"
+
+   "web-service/pkg/io"
+
+   bolt "go.etcd.io/bbolt"
+)
+
+
+// key of the meta bucket with the version of the schema of the database
+var schemaVersionKey = []byte("schema_version")
+
+
+// a change to the schema of the database. migrations are applied in order, each in its own
+// transaction, and are never edited once released: changes go in a new one appended to the list
+type migration struct {
+   Name string
+   Apply func(tx *bolt.Tx) error
+}
+
+
+// every migration, version N of the schema being the one after applying the first N
+var migrations = []migration{
+   {"annotations of runs", func(tx *bolt.Tx) error {
+      _, err := tx.CreateBucketIfNotExists(annotationsBucket)
+      return err
+   }},
+   {"records of runs", func(tx *bolt.Tx) error {
+      _, err := tx.CreateBucketIfNotExists(runsBucket)
+      return err
+   }},
+}
+
+
+// version of the schema the database is in, 0 for new ones (or those from before migrations, which
+// only had annotations & are brought up to date by running all of them)
+func schemaVersion (tx *bolt.Tx) int {
+
+   meta := tx.Bucket(metaBucket)
+   if meta == nil {
+      return 0
+   }
+
+   raw := meta.Get(schemaVersionKey)
+   if len(raw) != 8 {
+      return 0
+   }
+
+   return int(binary.BigEndian.Uint64(raw))
+
+}
+
+
+// apply the migrations the database is missing. a database from a newer service is not touched
+func migrate (db *bolt.DB) error {
+
+   var version int
+   if err := db.View(func(tx *bolt.Tx) error {
+      version = schemaVersion(tx)
+      return nil
+   }); err != nil {
+      return err
+   }
+
+   if version > len(migrations) {
+      return fmt.Errorf("database has schema version %d, newer than the %d known", version, len(migrations))
+   }
+
+   for k := version; k < len(migrations); k++ {
+      err := db.Update(func(tx *bolt.Tx) error {
+         if err := migrations[k].Apply(tx); err != nil {
+            return err
+         }
+         meta, err := tx.CreateBucketIfNotExists(metaBucket)
+         if err != nil {
+            return err
+         }
+         raw := make([]byte, 8)
+         binary.BigEndian.PutUint64(raw, uint64(k + 1))
+         return meta.Put(schemaVersionKey, raw)
+      })
+      if err != nil {
+         return fmt.Errorf("migration %d (%s): %w", k + 1, migrations[k].Name, err)
+      }
+      io.LogInfo("STORE - migrations.go - migrate", fmt.Sprintf("database migrated to schema version %d: %s", k + 1, migrations[k].Name))
+   }
+
+   return nil
+
+}
+
+
+// version of the schema of the database
+func (s *Store) SchemaVersion () int {
+
+   version := 0
+   _ = s.db.View(func(tx *bolt.Tx) error {
+      version = schemaVersion(tx)
+      return nil
+   })
+
+   return version
+
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+   "encoding/binary"
+   "path/filepath"
+   "testing"
+   "time"
+
+   bolt "go.etcd.io/bbolt"
+)
+
+
+// databases from before migrations only had annotations, without meta bucket. they are brought up
+// to the last schema keeping those
+func TestMigratePreMigrationDatabase (t *testing.T) {
+
+   path := filepath.Join(t.TempDir(), "service.db")
+
+   db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+   if err != nil {
+      t.Fatal(err)
+   }
+   err = db.Update(func(tx *bolt.Tx) error {
+      if _, err := tx.CreateBucket(annotationsBucket); err != nil {
+         return err
+      }
+      return put(tx, annotationsBucket, []byte("run1"), &Annotation{RunID: "run1", Notes: "kept", Tags: []string{"grid"}, Starred: true})
+   })
+   if err != nil {
+      t.Fatal(err)
+   }
+   if err := db.Close(); err != nil {
+      t.Fatal(err)
+   }
+
+   s, err := Open(path)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if got := s.SchemaVersion(); got != len(migrations) {
+      t.Errorf("schema version %d, want %d", got, len(migrations))
+   }
+   a, err := s.Annotation("run1")
+   if err != nil || a == nil || a.Notes != "kept" || !a.Starred || !a.HasTag("grid") {
+      t.Errorf("got annotation %+v, %v", a, err)
+   }
+   if err := s.SaveRun(&RunRecord{ID: "run1", RootDir: "/work/run1/"}); err != nil {
+      t.Errorf("runs bucket not created: %v", err)
+   }
+   if err := s.Close(); err != nil {
+      t.Fatal(err)
+   }
+
+   // opening again applies nothing & keeps everything
+   s, err = Open(path)
+   if err != nil {
+      t.Fatal(err)
+   }
+   defer s.Close()
+   if got := s.SchemaVersion(); got != len(migrations) {
+      t.Errorf("schema version %d once opened again, want %d", got, len(migrations))
+   }
+   if r, err := s.Run("run1"); err != nil || r == nil || r.RootDir != "/work/run1/" {
+      t.Errorf("got run %+v, %v", r, err)
+   }
+   if a, err := s.Annotation("run1"); err != nil || a == nil || a.Notes != "kept" {
+      t.Errorf("got annotation %+v, %v once opened again", a, err)
+   }
+
+}
+
+
+// a database written by a newer service is refused & left untouched
+func TestMigrateNewerDatabase (t *testing.T) {
+
+   path := filepath.Join(t.TempDir(), "service.db")
+
+   db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+   if err != nil {
+      t.Fatal(err)
+   }
+   err = db.Update(func(tx *bolt.Tx) error {
+      meta, err := tx.CreateBucket(metaBucket)
+      if err != nil {
+         return err
+      }
+      raw := make([]byte, 8)
+      binary.BigEndian.PutUint64(raw, uint64(len(migrations) + 1))
+      return meta.Put(schemaVersionKey, raw)
+   })
+   if err != nil {
+      t.Fatal(err)
+   }
+   if err := db.Close(); err != nil {
+      t.Fatal(err)
+   }
+
+   if s, err := Open(path); err == nil {
+      s.Close()
+      t.Fatal("database with a newer schema opened")
+   }
+
+   db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+   if err != nil {
+      t.Fatal(err)
+   }
+   defer db.Close()
+   _ = db.View(func(tx *bolt.Tx) error {
+      if tx.Bucket(annotationsBucket) != nil || schemaVersion(tx) != len(migrations) + 1 {
+         t.Error("database with a newer schema was migrated")
+      }
+      return nil
+   })
+
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+   "encoding/json"
+   "math"
+   "reflect"
+   "sort"
+   "strings"
+   "time"
+
+   "web-service/pkg/mesa"
+
+   bolt "go.etcd.io/bbolt"
+)
+
+
+// a process that ran a run, & when it was seen
+type PidRecord struct {
+   Pid int
+   FirstSeen time.Time
+   LastSeen time.Time
+}
+
+
+// what the service knows about a run, kept across restarts
+type RunRecord struct {
+   ID string
+   RootDir string
+   FirstSeen time.Time
+   LastSeen time.Time
+   StartedAt time.Time
+   EndedAt time.Time
+   Running bool
+   Status string
+   Pids []PidRecord
+   IsBinary bool
+   InitialDonorMass float64
+   InitialAccretorMass float64
+   InitialPeriod float64
+   Star1 *mesa.MESAstarInfo
+   Star2 *mesa.MESAstarInfo
+   Binary *mesa.MESAbinaryInfo
+   Outcome string
+   Events []mesa.Event
+   HistoryModTime time.Time
+   UpdatedAt time.Time
+}
+
+
+// record that the run was seen at a time, running with a PID or not (pid <= 0). a run is started
+// when first seen running & ends when seen not running after that
+func (r *RunRecord) Seen (at time.Time, pid int) {
+
+   if r.FirstSeen.IsZero() {
+      r.FirstSeen = at
+   }
+   r.LastSeen = at
+
+   if pid <= 0 {
+      if r.Running {
+         r.EndedAt = at
+      }
+      r.Running = false
+      return
+   }
+
+   if !r.Running {
+      r.StartedAt = at
+      r.EndedAt = time.Time{}
+   }
+   r.Running = true
+
+   if n := len(r.Pids); n > 0 && r.Pids[n-1].Pid == pid {
+      r.Pids[n-1].LastSeen = at
+      return
+   }
+   r.Pids = append(r.Pids, PidRecord{Pid: pid, FirstSeen: at, LastSeen: at})
+
+}
+
+
+// record of a run, nil if it was never seen
+func (s *Store) Run (id string) (*RunRecord, error) {
+
+   var r *RunRecord
+   err := s.db.View(func(tx *bolt.Tx) error {
+      var found RunRecord
+      ok, err := get(tx, runsBucket, []byte(id), &found)
+      if ok {
+         r = &found
+      }
+      return err
+   })
+
+   return r, err
+
+}
+
+
+// save the record of a run, replacing the one it had. NaN & infinite values, which JSON cannot
+// hold, are saved as 0
+func (s *Store) SaveRun (r *RunRecord) error {
+
+   r.UpdatedAt = time.Now()
+   finite(reflect.ValueOf(r))
+
+   return s.db.Update(func(tx *bolt.Tx) error {
+      return put(tx, runsBucket, []byte(r.ID), r)
+   })
+
+}
+
+
+// set NaN & infinite floats reachable from v to 0
+func finite (v reflect.Value) {
+
+   switch v.Kind() {
+   case reflect.Ptr:
+      if !v.IsNil() {
+         finite(v.Elem())
+      }
+   case reflect.Struct:
+      for k := 0; k < v.NumField(); k++ {
+         if v.Field(k).CanSet() {
+            finite(v.Field(k))
+         }
+      }
+   case reflect.Slice:
+      for k := 0; k < v.Len(); k++ {
+         finite(v.Index(k))
+      }
+   case reflect.Float64, reflect.Float32:
+      if f := v.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+         v.SetFloat(0)
+      }
+   }
+
+}
+
+
+// filters of the records of runs. zero values match everything
+type RunQuery struct {
+   Dir string
+   Outcome string
+   Status string
+   Running *bool
+   Binary *bool
+   Since time.Time
+   Until time.Time
+   Limit int
+   Offset int
+}
+
+
+// whether a record matches a query. Since & Until select runs seen in between
+func (q *RunQuery) match (r *RunRecord) bool {
+
+   switch {
+   case q.Dir != "" && !strings.Contains(strings.ToLower(r.RootDir), strings.ToLower(q.Dir)):
+      return false
+   case q.Outcome != "" && !strings.EqualFold(r.Outcome, q.Outcome):
+      return false
+   case q.Status != "" && !strings.EqualFold(r.Status, q.Status):
+      return false
+   case q.Running != nil && r.Running != *q.Running:
+      return false
+   case q.Binary != nil && r.IsBinary != *q.Binary:
+      return false
+   case !q.Since.IsZero() && r.LastSeen.Before(q.Since):
+      return false
+   case !q.Until.IsZero() && r.FirstSeen.After(q.Until):
+      return false
+   }
+
+   return true
+
+}
+
+
+// records of runs matching a query, last seen first, plus how many matched in total
+func (s *Store) QueryRuns (q RunQuery) ([]RunRecord, int, error) {
+
+   var records []RunRecord
+   err := s.db.View(func(tx *bolt.Tx) error {
+      return tx.Bucket(runsBucket).ForEach(func(k, v []byte) error {
+         var r RunRecord
+         if err := json.Unmarshal(v, &r); err != nil {
+            return err
+         }
+         if q.match(&r) {
+            records = append(records, r)
+         }
+         return nil
+      })
+   })
+   if err != nil {
+      return nil, 0, err
+   }
+
+   sort.SliceStable(records, func(i, j int) bool {
+      if !records[i].LastSeen.Equal(records[j].LastSeen) {
+         return records[i].LastSeen.After(records[j].LastSeen)
+      }
+      return records[i].RootDir < records[j].RootDir
+   })
+
+   total := len(records)
+   if q.Offset > 0 {
+      if q.Offset >= len(records) {
+         return []RunRecord{}, total, nil
+      }
+      records = records[q.Offset:]
+   }
+   if q.Limit > 0 && q.Limit < len(records) {
+      records = records[:q.Limit]
+   }
+   if records == nil {
+      records = []RunRecord{}
+   }
+
+   return records, total, nil
+
+}
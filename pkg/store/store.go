@@ -0,0 +1,78 @@
+// Package store keeps what the service knows about runs in an embedded bbolt database
+package store
+
+import (
+   "encoding/json"
+   "time"
+
+   bolt "go.etcd.io/bbolt"
+)
+
+
+// buckets of the database
+var (
+   metaBucket = []byte("meta")
+   annotationsBucket = []byte("annotations")
+   runsBucket = []byte("runs")
+)
+
+// time waited for the lock of the database file, held by another service using it
+const openTimeout = 5 * time.Second
+
+
+// database of the service, safe for concurrent use
+type Store struct {
+   Path string
+   db *bolt.DB
+}
+
+
+// open (or create) the database in a file, bringing it up to the last schema
+func Open (path string) (*Store, error) {
+
+   db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+   if err != nil {
+      return nil, err
+   }
+
+   if err := migrate(db); err != nil {
+      db.Close()
+      return nil, err
+   }
+
+   return &Store{Path: path, db: db}, nil
+
+}
+
+
+func (s *Store) Close () error {
+
+   return s.db.Close()
+
+}
+
+
+// value of a key as JSON into v. false if the key is not there
+func get (tx *bolt.Tx, bucket, key []byte, v interface{}) (bool, error) {
+
+   raw := tx.Bucket(bucket).Get(key)
+   if raw == nil {
+      return false, nil
+   }
+
+   return true, json.Unmarshal(raw, v)
+
+}
+
+
+// store v as JSON under a key
+func put (tx *bolt.Tx, bucket, key []byte, v interface{}) error {
+
+   raw, err := json.Marshal(v)
+   if err != nil {
+      return err
+   }
+
+   return tx.Bucket(bucket).Put(key, raw)
+
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+   "errors"
+   "fmt"
+   "os"
+   "path/filepath"
+   "strconv"
+   "syscall"
+)
+
+
+// actions that can be done on a MESA process & the signal each one sends
+var ProcessActions = map[string]syscall.Signal{
+   "pause": syscall.SIGSTOP,
+   "resume": syscall.SIGCONT,
+   "terminate": syscall.SIGTERM,
+   "kill": syscall.SIGKILL,
+}
+
+
+// errors returned when a process cannot be signalled
+var (
+   ErrUnknownAction = errors.New("unknown action")
+   ErrNotOwner = errors.New("process is not owned by the user running the service")
+   ErrOtherProcfs = errors.New("processes are read from another procfs than the one of the service, PIDs might not be the same")
+)
+
+
+// user id owning a process, from the proc filesystem at root
+func ProcessOwner (root string, pid int) (int, error) {
+
+   info, err := os.Stat(filepath.Join(root, strconv.Itoa(pid)))
+   if err != nil {
+      return -1, err
+   }
+
+   stat, ok := info.Sys().(*syscall.Stat_t)
+   if !ok {
+      return -1, fmt.Errorf("cannot find owner of process %d", pid)
+   }
+
+   return int(stat.Uid), nil
+
+}
+
+
+// send the signal of an action to a process, only if it belongs to the user running the service.
+// PIDs found under a procfs other than /proc (e.g. of the host, mounted in a container) may not be
+// those of the service, so processes are not signalled then
+func SignalProcess (pid int, action string) (syscall.Signal, error) {
+
+   return signalProcess(DefaultProcessScanner().Root, pid, action)
+
+}
+
+
+// send the signal of an action to a process found in the procfs at root
+func signalProcess (root string, pid int, action string) (syscall.Signal, error) {
+
+   sig, ok := ProcessActions[action]
+   if !ok {
+      return 0, fmt.Errorf("%w %q", ErrUnknownAction, action)
+   }
+   if pid <= 0 {
+      return sig, fmt.Errorf("bad PID %d", pid)
+   }
+
+   if filepath.Clean(root) != procRoot {
+      return sig, ErrOtherProcfs
+   }
+
+   owner, err := ProcessOwner(root, pid)
+   if err != nil {
+      return sig, err
+   }
+   if owner != os.Getuid() {
+      return sig, ErrNotOwner
+   }
+
+   return sig, syscall.Kill(pid, sig)
+
+}
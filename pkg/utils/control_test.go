@@ -0,0 +1,47 @@
+package utils
+
+import (
+   "errors"
+   "os/exec"
+   "syscall"
+   "testing"
+)
+
+
+func TestSignalProcess (t *testing.T) {
+
+   cmd := exec.Command("sleep", "30")
+   if err := cmd.Start(); err != nil {
+      t.Skip("cannot start sleep: " + err.Error())
+   }
+   defer func() {
+      cmd.Process.Kill()
+      cmd.Wait()
+   }()
+   pid := cmd.Process.Pid
+
+   if _, err := signalProcess(procRoot, pid, "explode"); !errors.Is(err, ErrUnknownAction) {
+      t.Errorf("got %v for an unknown action", err)
+   }
+   if _, err := signalProcess(procRoot, 0, "terminate"); err == nil {
+      t.Error("PID 0 signalled")
+   }
+
+   // PIDs read from another procfs are never signalled
+   root := t.TempDir()
+   writeFakeProcs(t, root, fakeProc{pid: pid, name: "star"})
+   if _, err := signalProcess(root, pid, "terminate"); !errors.Is(err, ErrOtherProcfs) {
+      t.Errorf("got %v with procfs at %s", err, root)
+   }
+
+   sig, err := signalProcess(procRoot + "/", pid, "terminate")
+   if err != nil || sig != syscall.SIGTERM {
+      t.Fatalf("got %v, %v", sig, err)
+   }
+   err = cmd.Wait()
+   status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+   if !ok || !status.Signaled() || status.Signal() != syscall.SIGTERM {
+      t.Errorf("process not terminated: %v", err)
+   }
+
+}
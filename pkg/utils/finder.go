@@ -0,0 +1,300 @@
+package utils
+
+import (
+   "errors"
+   "fmt"
+   "io/ioutil"
+   "os"
+   "path/filepath"
+   "sort"
+   "strconv"
+   "strings"
+   "syscall"
+
+   "web-service/pkg/io"
+
+   "github.com/shirou/gopsutil/process"
+)
+
+
+// names of process discovery backends, as set in MESA_PROCESS_BACKEND
+const (
+   BackendProcfs = "procfs"
+   BackendGopsutil = "gopsutil"
+   BackendPidfile = "pidfile"
+)
+
+// file written by job scripts in the run directory with the PID of MESA
+var pidfileName = "run.pid"
+
+
+// finds MESA processes running, sorted by PID. every process returned has its Id & Loc (run
+// directory, ending with a slash) set, and ExecName & Detail when they could be read
+type ProcessFinder interface {
+   Name () string
+   FindProcesses () ([]MESAprocess, error)
+}
+
+
+// backend selected by env variable MESA_PROCESS_BACKEND (procfs by default). runDirs gives the
+// directories searched for pidfiles; MESA_PID_FILE changes the name of those files
+func NewProcessFinder (runDirs func() []string) (ProcessFinder, error) {
+
+   backend := strings.TrimSpace(os.Getenv("MESA_PROCESS_BACKEND"))
+
+   switch backend {
+   case "", BackendProcfs:
+      return &ProcfsFinder{Scanner: DefaultProcessScanner()}, nil
+   case BackendGopsutil:
+      matcher, err := newProcessMatcher(processPatterns())
+      if err != nil {
+         return nil, err
+      }
+      return &GopsutilFinder{processMatcher: matcher}, nil
+   case BackendPidfile:
+      name := pidfileName
+      if env := os.Getenv("MESA_PID_FILE"); env != "" {
+         name = env
+      }
+      return &PidfileFinder{Filename: name, RunDirs: runDirs, Scanner: DefaultProcessScanner()}, nil
+   }
+
+   return nil, fmt.Errorf("unknown process discovery backend %q", backend)
+
+}
+
+
+// finds processes by reading procfs directly
+type ProcfsFinder struct {
+   Scanner *ProcessScanner
+}
+
+func (f *ProcfsFinder) Name () string {
+
+   return BackendProcfs
+
+}
+
+func (f *ProcfsFinder) FindProcesses () ([]MESAprocess, error) {
+
+   var procs []MESAprocess
+   for _, found := range f.Scanner.Scan() {
+      proc := found
+      proc.GetAbsPath(f.Scanner.Root)
+      procs = append(procs, proc)
+   }
+
+   return procs, nil
+
+}
+
+
+// finds processes through gopsutil, which also honours HOST_PROC for containers with the host
+// procfs mounted somewhere else
+type GopsutilFinder struct {
+   processMatcher
+}
+
+func (f *GopsutilFinder) Name () string {
+
+   return BackendGopsutil
+
+}
+
+func (f *GopsutilFinder) FindProcesses () ([]MESAprocess, error) {
+
+   all, err := process.Processes()
+   if err != nil {
+      return nil, err
+   }
+
+   var procs []MESAprocess
+   for _, p := range all {
+
+      name, err := p.Name()
+      if err != nil {
+         continue
+      }
+      exe, _ := p.Exe()
+      cmdline, _ := p.CmdlineSlice()
+
+      candidates := []string{name, filepath.Base(exe)}
+      if len(cmdline) > 0 {
+         candidates = append(candidates, filepath.Base(cmdline[0]))
+      }
+      matched := ""
+      for _, candidate := range candidates {
+         if candidate != "" && candidate != "." && f.matchName(candidate) {
+            matched = candidate
+            break
+         }
+      }
+      if matched == "" {
+         continue
+      }
+
+      detail := &ProcessDetail{Pid: int(p.Pid), Name: matched, Exe: exe, Cmdline: cmdline, Env: make(map[string]string)}
+      detail.Cwd, _ = p.Cwd()
+      if environ, err := p.Environ(); err == nil {
+         detail.setEnv(environ)
+      }
+
+      proc := MESAprocess{ExecName: matched, Id: int(p.Pid), Detail: detail}
+      proc.setLoc()
+      procs = append(procs, proc)
+
+   }
+   sort.Slice(procs, func(i, j int) bool { return procs[i].Id < procs[j].Id })
+
+   return procs, nil
+
+}
+
+
+// finds processes through pidfiles written in run directories. a process is alive when its PID is in
+// the procfs of Scanner, so that PIDs of another namespace are checked where they belong. as a PID
+// may have been reused since the pidfile was written, a process is only reported if it matches the
+// names of Scanner and works (or has its executable) in the run directory, both read from that same
+// procfs. when the procfs cannot be read (e.g. not Linux) the pidfile is trusted as long as a
+// process with that PID exists here, and the process is reported without ExecName or Detail
+type PidfileFinder struct {
+   Filename string
+   RunDirs func() []string
+   Scanner *ProcessScanner
+}
+
+func (f *PidfileFinder) Name () string {
+
+   return BackendPidfile
+
+}
+
+func (f *PidfileFinder) FindProcesses () ([]MESAprocess, error) {
+
+   var procs []MESAprocess
+   procfs := procfsReadable(f.Scanner.Root)
+
+   for _, dir := range f.RunDirs() {
+
+      pid, err := readPidfile(filepath.Join(dir, f.Filename))
+      if err != nil {
+         if !os.IsNotExist(err) {
+            io.LogError("UTILS - finder.go - FindProcesses", "problem reading pidfile of " + dir + ": " + err.Error())
+         }
+         continue
+      }
+      if !procfs {
+         if pidAlive(pid) {
+            procs = append(procs, MESAprocess{Id: pid, Loc: strings.TrimSuffix(dir, "/") + "/"})
+         }
+         continue
+      }
+      if _, err := os.Stat(filepath.Join(f.Scanner.Root, strconv.Itoa(pid))); err != nil {
+         continue
+      }
+
+      name, ok := f.Scanner.match(pid)
+      if !ok {
+         io.LogInfo("UTILS - finder.go - FindProcesses", "stale pidfile in " + dir + ": process " + strconv.Itoa(pid) + " is not MESA")
+         continue
+      }
+      proc := MESAprocess{ExecName: name, Id: pid}
+      detail, err := proc.Inspect(f.Scanner.Root)
+      inDir := err == nil && (sameDir(detail.Cwd, dir) || detail.Exe != "" && sameDir(filepath.Dir(detail.Exe), dir))
+      if !inDir {
+         io.LogInfo("UTILS - finder.go - FindProcesses", "stale pidfile in " + dir + ": process " + strconv.Itoa(pid) + " runs somewhere else")
+         continue
+      }
+
+      // reported under the directory it was found in, which might be a symlink to its cwd
+      proc.Loc = strings.TrimSuffix(dir, "/") + "/"
+      procs = append(procs, proc)
+
+   }
+   sort.Slice(procs, func(i, j int) bool { return procs[i].Id < procs[j].Id })
+
+   return procs, nil
+
+}
+
+
+// PID written in the first line of a pidfile
+func readPidfile (filename string) (int, error) {
+
+   raw, err := ioutil.ReadFile(filename)
+   if err != nil {
+      return 0, err
+   }
+
+   fields := strings.Fields(string(raw))
+   if len(fields) == 0 {
+      return 0, errors.New("empty pidfile")
+   }
+
+   return strconv.Atoi(fields[0])
+
+}
+
+
+// whether two paths are the same directory, following symlinks
+func sameDir (a, b string) bool {
+
+   if a == "" || b == "" {
+      return false
+   }
+   if filepath.Clean(a) == filepath.Clean(b) {
+      return true
+   }
+   realA, errA := filepath.EvalSymlinks(a)
+   realB, errB := filepath.EvalSymlinks(b)
+
+   return errA == nil && errB == nil && realA == realB
+
+}
+
+
+// whether root is a procfs that can be read
+func procfsReadable (root string) bool {
+
+   f, err := os.Open(root)
+   if err != nil {
+      return false
+   }
+   defer f.Close()
+   info, err := f.Stat()
+
+   return err == nil && info.IsDir()
+
+}
+
+
+// whether a process exists. a permission error means it does, but belongs to someone else
+func pidAlive (pid int) bool {
+
+   if pid <= 0 {
+      return false
+   }
+   err := syscall.Kill(pid, 0)
+
+   return err == nil || err == syscall.EPERM
+
+}
+
+
+// finder returning a fixed list of processes, for tests & demos
+type FakeFinder struct {
+   Processes []MESAprocess
+   Err error
+}
+
+func (f *FakeFinder) Name () string {
+
+   return "fake"
+
+}
+
+func (f *FakeFinder) FindProcesses () ([]MESAprocess, error) {
+
+   return f.Processes, f.Err
+
+}
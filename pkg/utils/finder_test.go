@@ -0,0 +1,202 @@
+package utils
+
+import (
+   "errors"
+   "os"
+   "os/exec"
+   "path/filepath"
+   "strconv"
+   "testing"
+   "time"
+)
+
+
+// a pidfile is only trusted when its process is MESA and runs in the directory of the pidfile, as
+// read from a fake procfs. the PID written is that of the test unless a case sets its own, so that
+// it is alive when the procfs cannot be read
+func TestPidfileFinder (t *testing.T) {
+
+   cases := []struct {
+      name string
+      pid int
+      pidfile string
+      proc *fakeProc
+      symlink bool
+      noProcfs bool
+      want bool
+   }{
+      {name: "working in the run directory", proc: &fakeProc{name: "star", cwd: "RUN"}, want: true},
+      {name: "executable in the run directory", proc: &fakeProc{name: "binary", exe: "RUN/binary"}, want: true},
+      {name: "run directory through a symlink", proc: &fakeProc{name: "star", cwd: "RUN"}, symlink: true, want: true},
+      {name: "PID reused by another program", proc: &fakeProc{name: "bash", cmdline: []string{"bash"}, cwd: "RUN"}},
+      {name: "PID reused in another directory", proc: &fakeProc{name: "star", cwd: "/somewhere/else", exe: "/somewhere/else/star"}},
+      {name: "PID not in procfs", proc: nil},
+      {name: "dead PID", pidfile: "99999999", proc: &fakeProc{name: "star", cwd: "RUN"}},
+      {name: "bad pidfile", pidfile: "star", proc: &fakeProc{name: "star", cwd: "RUN"}},
+      {name: "PID only in the procfs of the scanner", pid: 4194300, proc: &fakeProc{name: "star", cwd: "RUN"}, want: true},
+      {name: "procfs not readable", noProcfs: true, want: true},
+      {name: "procfs not readable & dead PID", pidfile: "99999999", noProcfs: true},
+   }
+
+   for _, c := range cases {
+      t.Run(c.name, func(t *testing.T) {
+
+         root, work := t.TempDir(), t.TempDir()
+         run := filepath.Join(work, "run")
+         if err := os.MkdirAll(run, 0755); err != nil {
+            t.Fatal(err)
+         }
+
+         pid := c.pid
+         if pid == 0 {
+            pid = os.Getpid()
+         }
+         content := c.pidfile
+         if content == "" {
+            content = strconv.Itoa(pid)
+         }
+         if err := os.WriteFile(filepath.Join(run, pidfileName), []byte(content + "\n"), 0644); err != nil {
+            t.Fatal(err)
+         }
+
+         if c.proc != nil {
+            proc := *c.proc
+            proc.pid = pid
+            if proc.cwd == "RUN" {
+               proc.cwd = run
+            }
+            if proc.exe == "RUN/binary" {
+               proc.exe = filepath.Join(run, "binary")
+            }
+            writeFakeProcs(t, root, proc)
+         }
+
+         dir := run
+         if c.symlink {
+            dir = filepath.Join(work, "link")
+            if err := os.Symlink(run, dir); err != nil {
+               t.Fatal(err)
+            }
+         }
+
+         if c.noProcfs {
+            root = filepath.Join(root, "missing")
+         }
+         scanner, err := NewProcessScanner(root, execNames, time.Minute)
+         if err != nil {
+            t.Fatal(err)
+         }
+         f := &PidfileFinder{Filename: pidfileName, RunDirs: func() []string { return []string{dir, filepath.Join(work, "no-pidfile")} }, Scanner: scanner}
+
+         procs, err := f.FindProcesses()
+         if err != nil {
+            t.Fatal(err)
+         }
+         if !c.want {
+            if len(procs) > 0 {
+               t.Errorf("got %+v, want no process", procs)
+            }
+            return
+         }
+         if len(procs) != 1 {
+            t.Fatalf("got %d processes, want 1", len(procs))
+         }
+         if procs[0].Id != pid || procs[0].Loc != dir + "/" {
+            t.Errorf("got %+v", procs[0])
+         }
+         if c.noProcfs {
+            if procs[0].ExecName != "" || procs[0].Detail != nil {
+               t.Errorf("got %+v without procfs", procs[0])
+            }
+         } else if procs[0].ExecName != c.proc.name || procs[0].Detail == nil {
+            t.Errorf("got %+v", procs[0])
+         }
+
+      })
+   }
+
+}
+
+
+// every backend is a ProcessFinder, the fake one returns what it is given
+func TestFakeFinder (t *testing.T) {
+
+   procs := []MESAprocess{{ExecName: "star", Id: 100, Loc: "/work/run1/"}, {ExecName: "binary", Id: 200}}
+   errFind := errors.New("cannot list processes")
+
+   var f ProcessFinder = &FakeFinder{Processes: procs, Err: errFind}
+   got, err := f.FindProcesses()
+   if len(got) != 2 || got[0].Loc != "/work/run1/" || got[1].Id != 200 || err != errFind {
+      t.Errorf("got %+v, %v", got, err)
+   }
+   if f.Name() != "fake" {
+      t.Errorf("got name %q", f.Name())
+   }
+
+   for _, finder := range []ProcessFinder{&ProcfsFinder{}, &GopsutilFinder{}, &PidfileFinder{}} {
+      if finder.Name() == "" || finder.Name() == f.Name() {
+         t.Errorf("backend %T named %q", finder, finder.Name())
+      }
+   }
+
+}
+
+
+func TestNewProcessFinder (t *testing.T) {
+
+   for backend, want := range map[string]string{"": BackendProcfs, "procfs": BackendProcfs, "gopsutil": BackendGopsutil, "pidfile": BackendPidfile} {
+      t.Setenv("MESA_PROCESS_BACKEND", backend)
+      f, err := NewProcessFinder(func() []string { return nil })
+      if err != nil || f.Name() != want {
+         t.Errorf("backend %q: got %v, %v, want %s", backend, f, err, want)
+      }
+   }
+
+   t.Setenv("MESA_PROCESS_BACKEND", "ps")
+   if _, err := NewProcessFinder(nil); err == nil {
+      t.Error("unknown backend accepted")
+   }
+
+}
+
+
+// processes found by gopsutil come sorted by PID, as those of the procfs scanner
+func TestGopsutilFinderSorted (t *testing.T) {
+
+   matcher, err := newProcessMatcher([]string{"sleep"})
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   var started []int
+   for k := 0; k < 3; k++ {
+      cmd := exec.Command("sleep", "30")
+      if err := cmd.Start(); err != nil {
+         t.Skip("cannot start sleep: " + err.Error())
+      }
+      defer func() {
+         cmd.Process.Kill()
+         cmd.Wait()
+      }()
+      started = append(started, cmd.Process.Pid)
+   }
+
+   procs, err := (&GopsutilFinder{processMatcher: matcher}).FindProcesses()
+   if err != nil {
+      t.Fatal(err)
+   }
+
+   found := make(map[int]bool)
+   for k, proc := range procs {
+      if k > 0 && proc.Id <= procs[k-1].Id {
+         t.Errorf("processes not sorted by PID: %d after %d", proc.Id, procs[k-1].Id)
+      }
+      found[proc.Id] = true
+   }
+   for _, pid := range started {
+      if !found[pid] {
+         t.Errorf("process %d not found", pid)
+      }
+   }
+
+}
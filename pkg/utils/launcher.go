@@ -0,0 +1,315 @@
+package utils
+
+import (
+   "errors"
+   "fmt"
+   "os"
+   "os/exec"
+   "path/filepath"
+   "strconv"
+   "strings"
+   "sync"
+   "syscall"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+
+   "github.com/shirou/gopsutil/cpu"
+)
+
+
+// states of a run launched by the service
+const (
+   LaunchQueued = "queued"
+   LaunchRunning = "running"
+   LaunchExited = "exited"
+   LaunchFailed = "failed"
+   LaunchCancelled = "cancelled"
+)
+
+// scripts MESA runs are started & restarted with
+const startScript = "rn"
+const restartScript = "re"
+
+// file in the run directory where output of launched runs goes
+var launchLogName = "run.log"
+
+
+// errors returned when a run cannot be launched
+var (
+   ErrNoScript = errors.New("run directory has no executable script")
+   ErrBadPhoto = errors.New("photo not found")
+   ErrAlreadyLaunched = errors.New("run is already queued or running")
+)
+
+
+// what to launch: ./rn, or ./re with a photo, in a run directory
+type LaunchRequest struct {
+   Dir string
+   Photo string
+   Threads int
+}
+
+
+// a run launched by the service as a child process
+type ManagedRun struct {
+   ID int
+   Dir string
+   Command []string
+   Threads int
+   State string
+   Pid int
+   ExitCode int
+   Error string
+   LogFile string
+   QueuedAt time.Time
+   StartedAt time.Time
+   EndedAt time.Time
+   cmd *exec.Cmd
+}
+
+
+// launches runs & keeps them queued while there are not enough cores for them. each run takes as
+// many cores as its OpenMP threads; a run is always started when nothing else is running
+type Launcher struct {
+   Cores int
+   DefaultThreads int
+   mu sync.Mutex
+   runs []*ManagedRun
+   nextID int
+}
+
+
+// launcher using every core found with cpu.Info. threads of each run default to
+// MESA_OMP_NUM_THREADS, else OMP_NUM_THREADS of the service, else all cores
+func NewLauncher () *Launcher {
+
+   cores := 0
+   if stats, err := cpu.Info(); err == nil {
+      for _, stat := range stats {
+         cores += int(stat.Cores)
+      }
+   } else {
+      io.LogError("UTILS - launcher.go - NewLauncher", "problem getting CPU info: " + err.Error())
+   }
+   if cores < 1 {
+      cores = 1
+   }
+
+   threads := cores
+   for _, name := range []string{"MESA_OMP_NUM_THREADS", "OMP_NUM_THREADS"} {
+      if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+         threads = n
+         break
+      }
+   }
+
+   return &Launcher{Cores: cores, DefaultThreads: threads, nextID: 1}
+
+}
+
+
+// command for a request, checking the script & photo are there
+func launchCommand (req LaunchRequest) ([]string, error) {
+
+   script := startScript
+   if req.Photo != "" {
+      script = restartScript
+      if len(mesa.PhotoFiles(req.Dir, req.Photo)) == 0 {
+         return nil, ErrBadPhoto
+      }
+   }
+
+   info, err := os.Stat(filepath.Join(req.Dir, script))
+   if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+      return nil, fmt.Errorf("%w ./%s", ErrNoScript, script)
+   }
+
+   if req.Photo != "" {
+      return []string{"./" + script, req.Photo}, nil
+   }
+
+   return []string{"./" + script}, nil
+
+}
+
+
+// queue a run, starting it right away if there are cores free for it
+func (l *Launcher) Submit (req LaunchRequest) (ManagedRun, error) {
+
+   command, err := launchCommand(req)
+   if err != nil {
+      return ManagedRun{}, err
+   }
+   if req.Threads <= 0 {
+      req.Threads = l.DefaultThreads
+   }
+
+   l.mu.Lock()
+   defer l.mu.Unlock()
+
+   for _, r := range l.runs {
+      if r.Dir == req.Dir && (r.State == LaunchQueued || r.State == LaunchRunning) {
+         return *r, ErrAlreadyLaunched
+      }
+   }
+
+   r := &ManagedRun{
+      ID: l.nextID,
+      Dir: req.Dir,
+      Command: command,
+      Threads: req.Threads,
+      State: LaunchQueued,
+      LogFile: filepath.Join(req.Dir, launchLogName),
+      QueuedAt: time.Now(),
+   }
+   l.nextID++
+   l.runs = append(l.runs, r)
+
+   l.startQueued()
+
+   return *r, nil
+
+}
+
+
+// start queued runs, in order, while there are cores for them. l.mu must be held
+func (l *Launcher) startQueued () {
+
+   used := 0
+   for _, r := range l.runs {
+      if r.State == LaunchRunning {
+         used += r.Threads
+      }
+   }
+
+   for _, r := range l.runs {
+      if r.State != LaunchQueued {
+         continue
+      }
+      if used > 0 && used + r.Threads > l.Cores {
+         return
+      }
+      l.start(r)
+      if r.State == LaunchRunning {
+         used += r.Threads
+      }
+   }
+
+}
+
+
+// start a run as a child process writing into its log. l.mu must be held
+func (l *Launcher) start (r *ManagedRun) {
+
+   r.StartedAt = time.Now()
+
+   logFile, err := os.OpenFile(r.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+   if err != nil {
+      r.State, r.Error, r.EndedAt = LaunchFailed, err.Error(), time.Now()
+      return
+   }
+   fmt.Fprintf(logFile, "\n==> %s: %s with OMP_NUM_THREADS=%d\n", r.StartedAt.Format(time.RFC3339), strings.Join(r.Command, " "), r.Threads)
+
+   cmd := exec.Command(r.Command[0], r.Command[1:]...)
+   cmd.Dir = r.Dir
+   cmd.Env = append(os.Environ(), "OMP_NUM_THREADS=" + strconv.Itoa(r.Threads))
+   cmd.Stdout = logFile
+   cmd.Stderr = logFile
+   // own process group, so that runs are not killed along with the service by a ctrl-c
+   cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+   if err := cmd.Start(); err != nil {
+      logFile.Close()
+      r.State, r.Error, r.EndedAt = LaunchFailed, err.Error(), time.Now()
+      return
+   }
+
+   r.cmd = cmd
+   r.Pid = cmd.Process.Pid
+   r.State = LaunchRunning
+   io.LogInfo("UTILS - launcher.go - start", "started " + strings.Join(r.Command, " ") + " in " + r.Dir + " with PID " + strconv.Itoa(r.Pid))
+
+   go l.wait(r, logFile)
+
+}
+
+
+// wait for a run to end, then start whatever is queued
+func (l *Launcher) wait (r *ManagedRun, logFile *os.File) {
+
+   err := r.cmd.Wait()
+   logFile.Close()
+
+   l.mu.Lock()
+   defer l.mu.Unlock()
+
+   r.EndedAt = time.Now()
+   r.ExitCode = r.cmd.ProcessState.ExitCode()
+   r.State = LaunchExited
+   if err != nil {
+      r.State = LaunchFailed
+      r.Error = err.Error()
+   }
+   io.LogInfo("UTILS - launcher.go - wait", "run in " + r.Dir + " ended with exit code " + strconv.Itoa(r.ExitCode))
+
+   l.startQueued()
+
+}
+
+
+// remove a run from the queue, only possible while it has not started
+func (l *Launcher) Cancel (id int) (ManagedRun, error) {
+
+   l.mu.Lock()
+   defer l.mu.Unlock()
+
+   for _, r := range l.runs {
+      if r.ID != id {
+         continue
+      }
+      if r.State != LaunchQueued {
+         return *r, fmt.Errorf("run %d is %s, only queued runs can be cancelled", id, r.State)
+      }
+      r.State, r.EndedAt = LaunchCancelled, time.Now()
+      return *r, nil
+   }
+
+   return ManagedRun{}, fmt.Errorf("unknown launched run %d", id)
+
+}
+
+
+// every run launched, in order of submission
+func (l *Launcher) Runs () []ManagedRun {
+
+   l.mu.Lock()
+   defer l.mu.Unlock()
+
+   runs := make([]ManagedRun, 0, len(l.runs))
+   for _, r := range l.runs {
+      runs = append(runs, *r)
+   }
+
+   return runs
+
+}
+
+
+// last run launched in a directory, nil if none
+func (l *Launcher) LastIn (dir string) *ManagedRun {
+
+   l.mu.Lock()
+   defer l.mu.Unlock()
+
+   for k := len(l.runs) - 1; k >= 0; k-- {
+      if l.runs[k].Dir == dir {
+         r := *l.runs[k]
+         return &r
+      }
+   }
+
+   return nil
+
+}
@@ -3,14 +3,12 @@ package utils
 
 import (
    "bytes"
-   "errors"
    "io/ioutil"
    "path/filepath"
    "strconv"
    "strings"
    "os"
-   "os/exec"
-   
+
    "web-service/pkg/io"
 )
 
@@ -19,112 +17,178 @@ import (
 var execNames = []string{"star", "binary", "bin2dco"}
 
 
+// root of the proc filesystem, unless another one is given (e.g. MESA_PROC_ROOT)
+var procRoot = "/proc"
+
+// environment variables of a MESA process worth showing. the whole environment is not kept, as it
+// might hold credentials
+var detailEnvVars = []string{"MESA_DIR", "MESASDK_ROOT", "OMP_NUM_THREADS", "MESA_CACHES_DIR", "MESA_TEMP_CACHES_DIR"}
+
+
 // Mp structure holds the info 
 type MESAprocess struct {
    ExecName string
    Id int
    Loc string
+   Detail *ProcessDetail
 }
 
 
-// wrapper function for searching MESA simulation process
-func (M *MESAprocess) WalkProc () {
+// what is known of a running MESA process, read from /proc/<pid>
+type ProcessDetail struct {
+   Pid int
+   Name string
+   Exe string
+   Cwd string
+   Cmdline []string
+   Env map[string]string
+   MESADir string
+   OMPNumThreads int
+   State string
+   Uid int
+}
 
-   for k, name := range execNames {
 
-      M.ExecName = name
+// whether the process is stopped, e.g. paused with SIGSTOP
+func (d *ProcessDetail) Stopped () bool {
 
-      io.LogInfo("UTILS - process.go - Walkproc", "doing filepath.Walk for name: " + name)
-      err := filepath.Walk("/proc", M.FindMESAProcess)
+   return strings.HasPrefix(d.State, "T")
 
-      if err != nil {
+}
 
-         io.LogDebug("UTILS - process.go - WalkProc", M.ExecName)
-         io.LogDebug("UTILS - process.go - WalkProc", strconv.Itoa(M.Id))
 
-         return
+// wrapper function for searching MESA simulation process. the first one found is kept
+func (M *MESAprocess) WalkProc () {
 
-      } else {
+   found := DefaultProcessScanner().Scan()
+   if len(found) == 0 {
+      io.LogInfo("UTILS - process.go - WalkProc", "could not find MESA process")
+      return
+   }
 
-         io.LogError("UTILS - process.go - WalkProc", "could not find MESA process for name: " + name)
+   M.ExecName = found[0].ExecName
+   M.Id = found[0].Id
 
-         if (k == len(execNames)) {
-            return
-         }
+   io.LogDebug("UTILS - process.go - WalkProc", M.ExecName)
+   io.LogDebug("UTILS - process.go - WalkProc", strconv.Itoa(M.Id))
 
-      }
+}
+
+
+// set Loc to the directory where the run is being done: the working directory of the process or,
+// if it cannot be read, the directory of its executable. Loc always ends with a slash. root is that
+// of the proc filesystem, as in ProcessScanner
+func (M *MESAprocess) GetAbsPath (root string) {
 
+   detail, err := M.Inspect(root)
+   if err != nil {
+      io.LogError("PROCESS - GetAbsPath", "problem inspecting process: " + err.Error())
    }
 
+   M.Detail = detail
+   M.setLoc()
+
+   io.LogDebug("PROCESS - GetAbsPath", "found AbsPath on " + M.Loc)
+
 }
 
 
-// search process with MESA simulation
-// idea from this post:
-// https://stackoverflow.com/questions/41060457/golang-kill-process-by-name
-func (M *MESAprocess) FindMESAProcess (path string, info os.FileInfo, err error) error {
+// set Loc out of Detail
+func (M *MESAprocess) setLoc () {
 
-   if err != nil {
-      return nil
+   switch {
+   case M.Detail == nil:
+      return
+   case M.Detail.Cwd != "":
+      M.Loc = M.Detail.Cwd
+   case M.Detail.Exe != "":
+      M.Loc = filepath.Dir(M.Detail.Exe)
+   }
+   if M.Loc != "" && !strings.HasSuffix(M.Loc, "/") {
+      M.Loc += "/"
    }
 
-   if strings.Count(path, "/") == 3 {
+}
 
-      if strings.Contains(path, "/status") {
 
-         pid, err := strconv.Atoi(path[6:strings.LastIndex(path, "/")])
-         if err != nil {
-            io.LogInfo("UTILS - process.go - FindMESAProcess", "problem converting Atoi")
-            return nil
-         }
+// read details of the process from the proc filesystem at root. only an unreadable cwd & exe is an
+// error, as cmdline and environ of processes of other users are often not readable
+func (M *MESAprocess) Inspect (root string) (*ProcessDetail, error) {
 
-         f, err := ioutil.ReadFile(path)
-         if err != nil {
-            io.LogInfo("UTILS - process.go - FindMESAProcess", "problem reading status file")
-            return nil
-         }
-
-         // Extract the process name from within the first line in the buffer
-         name := string(f[6:bytes.IndexByte(f, '\n')])
-         if name == M.ExecName {
+   procDir := filepath.Join(root, strconv.Itoa(M.Id))
+   detail := &ProcessDetail{Pid: M.Id, Name: M.ExecName, Env: make(map[string]string)}
 
-            io.LogInfo("UTILS - process.go - FindMESAProcess", "found MESA process")
-            io.LogInfo("UTILS - process.go - FindMESAProcess", strconv.Itoa(pid))
+   cwd, cwdErr := os.Readlink(filepath.Join(procDir, "cwd"))
+   exe, exeErr := os.Readlink(filepath.Join(procDir, "exe"))
+   detail.Cwd = cwd
+   detail.Exe = strings.TrimSuffix(exe, " (deleted)")
 
-            // asign PID and abs path of process
-            M.Id = pid
-            M.Loc = "/proc/" + strconv.Itoa(pid)
+   if raw, err := ioutil.ReadFile(filepath.Join(procDir, "cmdline")); err == nil {
+      detail.Cmdline = splitNul(raw)
+   }
 
-            // Let's return a fake error to abort the walk through the
-            // rest of the /proc directory tree
-            return errors.New("found MESA process")
+   // state & owner, as listed in status
+   if raw, err := ioutil.ReadFile(filepath.Join(procDir, "status")); err == nil {
+      for _, line := range strings.Split(string(raw), "\n") {
+         fields := strings.Fields(line)
+         if len(fields) < 2 {
+            continue
+         }
+         switch fields[0] {
+         case "State:":
+            detail.State = strings.Join(fields[1:], " ")
+         case "Uid:":
+            detail.Uid, _ = strconv.Atoi(fields[1])
          }
-
       }
    }
 
-   return nil
+   if raw, err := ioutil.ReadFile(filepath.Join(procDir, "environ")); err == nil {
+      detail.setEnv(splitNul(raw))
+   }
+
+   M.Detail = detail
+
+   if cwdErr != nil && exeErr != nil {
+      return detail, cwdErr
+   }
+
+   return detail, nil
 
 }
 
 
-func (M *MESAprocess) GetAbsPath () {
+// keep environment variables worth showing out of a list of "name=value"
+func (d *ProcessDetail) setEnv (environ []string) {
 
-   cmd := exec.Command("ls", "-l", "/proc/" + strconv.Itoa(M.Id) + "/exe")
-   out, err := cmd.CombinedOutput()
-   if err != nil {
-      io.LogError("PROCESS - GetAbsPath", "problem running cmd")
+   for _, kv := range environ {
+      k := strings.IndexByte(kv, '=')
+      if k < 0 {
+         continue
+      }
+      for _, name := range detailEnvVars {
+         if kv[:k] == name {
+            d.Env[name] = kv[k+1:]
+         }
+      }
+   }
+
+   d.MESADir = d.Env["MESA_DIR"]
+   if threads, err := strconv.Atoi(d.Env["OMP_NUM_THREADS"]); err == nil {
+      d.OMPNumThreads = threads
    }
 
-   // get only last element of slice
-   res1 := strings.Split(string(out), " ")
-   last := res1[len(res1)-1]
+}
 
-   // strip from newline char
-   last2 := strings.Replace(last, "\n", "", -1)
-   last2 = last2[:len(last2) - len(M.ExecName)]
-   M.Loc = last2
 
-   io.LogDebug("PROCESS - GetAbsPath", "found AbsPath on " + M.Loc)
+// split a /proc file made of NUL terminated strings (cmdline, environ)
+func splitNul (raw []byte) []string {
+
+   var list []string
+   for _, item := range bytes.Split(bytes.TrimRight(raw, "\x00"), []byte{0}) {
+      list = append(list, string(item))
+   }
+
+   return list
 
 }
@@ -0,0 +1,215 @@
+package utils
+
+import (
+   "bytes"
+   "io/ioutil"
+   "os"
+   "path/filepath"
+   "regexp"
+   "sort"
+   "strconv"
+   "strings"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+)
+
+
+// how long a scan of /proc is reused before looking again
+const processScanTTL = 5 * time.Second
+
+
+// finds MESA processes listing /proc once per scan. processes are matched by their name (as in
+// /proc/<pid>/status, truncated by the kernel to 15 chars), or the base name of their executable
+// or of the first argument of their command line, so that "./star" launched by rn is also found.
+// patterns are given as plain names or as regular expressions between slashes, e.g. "/^star_.*/"
+type ProcessScanner struct {
+   Root string
+   TTL time.Duration
+   processMatcher
+   mu sync.Mutex
+   found []MESAprocess
+   scannedAt time.Time
+}
+
+
+// scanner used by the service, set up from env variables on first use
+var (
+   defaultScannerOnce sync.Once
+   defaultScanner *ProcessScanner
+)
+
+
+// names & regular expressions a process name is checked against
+type processMatcher struct {
+   names map[string]bool
+   patterns []*regexp.Regexp
+}
+
+
+// matcher out of a list of names or /regexes/
+func newProcessMatcher (patterns []string) (processMatcher, error) {
+
+   m := processMatcher{names: make(map[string]bool)}
+
+   for _, pattern := range patterns {
+      if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+         re, err := regexp.Compile(pattern[1:len(pattern)-1])
+         if err != nil {
+            return m, err
+         }
+         m.patterns = append(m.patterns, re)
+      } else {
+         m.names[pattern] = true
+      }
+   }
+
+   return m, nil
+
+}
+
+
+// names to look for, from MESA_PROCESS_NAMES (comma separated) or the usual MESA executables
+func processPatterns () []string {
+
+   env := os.Getenv("MESA_PROCESS_NAMES")
+   if env == "" {
+      return execNames
+   }
+
+   var patterns []string
+   for _, name := range strings.Split(env, ",") {
+      if name = strings.TrimSpace(name); name != "" {
+         patterns = append(patterns, name)
+      }
+   }
+
+   return patterns
+
+}
+
+
+// scanner for a procfs mounted at root, matching a list of names or /regexes/
+func NewProcessScanner (root string, patterns []string, ttl time.Duration) (*ProcessScanner, error) {
+
+   matcher, err := newProcessMatcher(patterns)
+   if err != nil {
+      return nil, err
+   }
+
+   return &ProcessScanner{Root: root, TTL: ttl, processMatcher: matcher}, nil
+
+}
+
+
+// scanner used by the service. root of procfs is taken from MESA_PROC_ROOT and names to look for
+// from MESA_PROCESS_NAMES (comma separated), both falling back to the usual values
+func DefaultProcessScanner () *ProcessScanner {
+
+   defaultScannerOnce.Do(func() {
+
+      root := procRoot
+      if env := os.Getenv("MESA_PROC_ROOT"); env != "" {
+         root = env
+      }
+
+      var err error
+      defaultScanner, err = NewProcessScanner(root, processPatterns(), processScanTTL)
+      if err != nil {
+         io.LogError("UTILS - scanner.go - DefaultProcessScanner", "bad MESA_PROCESS_NAMES, using defaults: " + err.Error())
+         defaultScanner, _ = NewProcessScanner(root, execNames, processScanTTL)
+      }
+
+   })
+
+   return defaultScanner
+
+}
+
+
+// MESA processes running, sorted by PID. results of the last scan are reused for TTL
+func (s *ProcessScanner) Scan () []MESAprocess {
+
+   s.mu.Lock()
+   defer s.mu.Unlock()
+
+   if s.found != nil && time.Since(s.scannedAt) < s.TTL {
+      return s.found
+   }
+
+   entries, err := ioutil.ReadDir(s.Root)
+   if err != nil {
+      io.LogError("UTILS - scanner.go - Scan", "cannot list " + s.Root + ": " + err.Error())
+   }
+
+   found := []MESAprocess{}
+   for _, entry := range entries {
+      pid, err := strconv.Atoi(entry.Name())
+      if err != nil || !entry.IsDir() {
+         continue
+      }
+      if name, ok := s.match(pid); ok {
+         found = append(found, MESAprocess{ExecName: name, Id: pid})
+      }
+   }
+   sort.Slice(found, func(i, j int) bool { return found[i].Id < found[j].Id })
+
+   s.found = found
+   s.scannedAt = time.Now()
+
+   return found
+
+}
+
+
+// name under which a process matches, if it does. processes may be gone by the time they are read,
+// those are just skipped
+func (s *ProcessScanner) match (pid int) (string, bool) {
+
+   dir := filepath.Join(s.Root, strconv.Itoa(pid))
+
+   var candidates []string
+   if status, err := ioutil.ReadFile(filepath.Join(dir, "status")); err == nil {
+      line := status
+      if k := bytes.IndexByte(status, '\n'); k >= 0 {
+         line = status[:k]
+      }
+      if bytes.HasPrefix(line, []byte("Name:")) {
+         candidates = append(candidates, strings.TrimSpace(string(line[5:])))
+      }
+   }
+   if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+      candidates = append(candidates, filepath.Base(strings.TrimSuffix(exe, " (deleted)")))
+   }
+   if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+      if args := splitNul(cmdline); args[0] != "" {
+         candidates = append(candidates, filepath.Base(args[0]))
+      }
+   }
+
+   for _, name := range candidates {
+      if s.matchName(name) {
+         return name, true
+      }
+   }
+
+   return "", false
+
+}
+
+
+func (m processMatcher) matchName (name string) bool {
+
+   if m.names[name] {
+      return true
+   }
+   for _, re := range m.patterns {
+      if re.MatchString(name) {
+         return true
+      }
+   }
+
+   return false
+
+}
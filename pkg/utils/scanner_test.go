@@ -0,0 +1,226 @@
+package utils
+
+import (
+   "fmt"
+   "os"
+   "path/filepath"
+   "strconv"
+   "strings"
+   "testing"
+   "time"
+)
+
+
+// a process in a fake proc filesystem. empty fields are not written
+type fakeProc struct {
+   pid int
+   name string
+   state string
+   cmdline []string
+   exe string
+   cwd string
+   environ []string
+   cgroup string
+}
+
+
+// write the proc files of processes under root, as <root>/<pid>/{status,cmdline,exe,cwd,...}.
+// exe & cwd are symlinks, as in /proc
+func writeFakeProcs (t *testing.T, root string, procs ...fakeProc) {
+
+   t.Helper()
+
+   for _, p := range procs {
+
+      dir := filepath.Join(root, strconv.Itoa(p.pid))
+      if err := os.MkdirAll(dir, 0755); err != nil {
+         t.Fatal(err)
+      }
+
+      files := make(map[string]string)
+      if p.name != "" {
+         state := p.state
+         if state == "" {
+            state = "R (running)"
+         }
+         files["status"] = fmt.Sprintf("Name:\t%s\nState:\t%s\nPid:\t%d\nUid:\t%d\t%d\t%d\t%d\n", p.name, state, p.pid, os.Getuid(), os.Getuid(), os.Getuid(), os.Getuid())
+      }
+      if p.cmdline != nil {
+         files["cmdline"] = strings.Join(p.cmdline, "\x00") + "\x00"
+      }
+      if p.environ != nil {
+         files["environ"] = strings.Join(p.environ, "\x00") + "\x00"
+      }
+      if p.cgroup != "" {
+         files["cgroup"] = p.cgroup
+      }
+      for name, content := range files {
+         if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+            t.Fatal(err)
+         }
+      }
+
+      for name, target := range map[string]string{"exe": p.exe, "cwd": p.cwd} {
+         if target == "" {
+            continue
+         }
+         if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+            t.Fatal(err)
+         }
+      }
+
+   }
+
+}
+
+
+// processes are matched by status name, executable or first argument, in a procfs at Root
+func TestProcessScannerScan (t *testing.T) {
+
+   root := t.TempDir()
+   writeFakeProcs(t, root,
+      fakeProc{pid: 300, name: "bash", cmdline: []string{"./binary", "inlist"}},
+      fakeProc{pid: 100, name: "star"},
+      fakeProc{pid: 200, name: "a.out", exe: "/opt/mesa/bin2dco (deleted)"},
+      fakeProc{pid: 400, name: "python3", cmdline: []string{"python3", "star.py"}, exe: "/usr/bin/python3"},
+      fakeProc{pid: 500, name: "star_custom"},
+   )
+   // neither a process nor a directory
+   if err := os.MkdirAll(filepath.Join(root, "self"), 0755); err != nil {
+      t.Fatal(err)
+   }
+   if err := os.WriteFile(filepath.Join(root, "600"), nil, 0644); err != nil {
+      t.Fatal(err)
+   }
+
+   cases := []struct {
+      name string
+      patterns []string
+      want string
+   }{
+      {"usual names", execNames, "100 star, 200 bin2dco, 300 binary"},
+      {"regular expression", []string{"/^star_.*/"}, "500 star_custom"},
+      {"names & regular expressions", []string{"python3", "/^star/"}, "100 star, 400 python3, 500 star_custom"},
+      {"nothing matching", []string{"rn"}, ""},
+   }
+
+   for _, c := range cases {
+      t.Run(c.name, func(t *testing.T) {
+
+         s, err := NewProcessScanner(root, c.patterns, time.Minute)
+         if err != nil {
+            t.Fatal(err)
+         }
+
+         var got []string
+         for _, proc := range s.Scan() {
+            got = append(got, fmt.Sprintf("%d %s", proc.Id, proc.ExecName))
+         }
+         if strings.Join(got, ", ") != c.want {
+            t.Errorf("got %q, want %q", strings.Join(got, ", "), c.want)
+         }
+
+      })
+   }
+
+   if _, err := NewProcessScanner(root, []string{"/(/"}, time.Minute); err == nil {
+      t.Error("bad regular expression accepted")
+   }
+
+}
+
+
+// a scan is reused for TTL, then done again
+func TestProcessScannerTTL (t *testing.T) {
+
+   root := t.TempDir()
+   writeFakeProcs(t, root, fakeProc{pid: 100, name: "star"})
+
+   s, err := NewProcessScanner(root, execNames, time.Hour)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if got := len(s.Scan()); got != 1 {
+      t.Fatalf("found %d processes, want 1", got)
+   }
+
+   writeFakeProcs(t, root, fakeProc{pid: 200, name: "binary"})
+   if got := len(s.Scan()); got != 1 {
+      t.Errorf("found %d processes within TTL, want the 1 of the first scan", got)
+   }
+
+   s.scannedAt = time.Now().Add(-2 * time.Hour)
+   if got := len(s.Scan()); got != 2 {
+      t.Errorf("found %d processes after TTL, want 2", got)
+   }
+
+}
+
+
+// details, owner & slurm job of a process come from the procfs given, not /proc
+func TestInspectProcess (t *testing.T) {
+
+   root := t.TempDir()
+   writeFakeProcs(t, root,
+      fakeProc{
+         pid: 100,
+         name: "star",
+         state: "T (stopped)",
+         cmdline: []string{"./star", "inlist_project"},
+         exe: "/work/run1/star (deleted)",
+         cwd: "/work/run1",
+         environ: []string{"MESA_DIR=/opt/mesa", "OMP_NUM_THREADS=4", "AWS_SECRET_ACCESS_KEY=secret"},
+         cgroup: "0::/system.slice/slurmstepd.scope/job_1234/step_batch/user/task_0\n",
+      },
+      fakeProc{pid: 200, name: "binary", exe: "/work/run2/binary"},
+   )
+
+   proc := MESAprocess{ExecName: "star", Id: 100}
+   detail, err := proc.Inspect(root)
+   if err != nil {
+      t.Fatal(err)
+   }
+   if detail.Cwd != "/work/run1" || detail.Exe != "/work/run1/star" {
+      t.Errorf("got cwd %q & exe %q", detail.Cwd, detail.Exe)
+   }
+   if strings.Join(detail.Cmdline, " ") != "./star inlist_project" {
+      t.Errorf("got cmdline %q", detail.Cmdline)
+   }
+   if !detail.Stopped() || detail.Uid != os.Getuid() {
+      t.Errorf("got state %q & uid %d", detail.State, detail.Uid)
+   }
+   if detail.MESADir != "/opt/mesa" || detail.OMPNumThreads != 4 || len(detail.Env) != 2 {
+      t.Errorf("got environment %v", detail.Env)
+   }
+
+   proc.GetAbsPath(root)
+   if proc.Loc != "/work/run1/" {
+      t.Errorf("got Loc %q, want the working directory", proc.Loc)
+   }
+
+   // without cwd the run is where the executable is
+   other := MESAprocess{ExecName: "binary", Id: 200}
+   other.GetAbsPath(root)
+   if other.Loc != "/work/run2/" {
+      t.Errorf("got Loc %q, want the directory of the executable", other.Loc)
+   }
+
+   if _, err := (&MESAprocess{Id: 300}).Inspect(root); err == nil {
+      t.Error("inspecting a process not in procfs did not fail")
+   }
+
+   if owner, err := ProcessOwner(root, 100); err != nil || owner != os.Getuid() {
+      t.Errorf("got owner %d, %v, want %d", owner, err, os.Getuid())
+   }
+   if _, err := ProcessOwner(root, 300); err == nil {
+      t.Error("owner of a process not in procfs")
+   }
+
+   if job := slurmJobOfPid(root, 100); job != "1234" {
+      t.Errorf("got slurm job %q, want 1234", job)
+   }
+   if job := slurmJobOfPid(root, 200); job != "" {
+      t.Errorf("got slurm job %q for a process without cgroup", job)
+   }
+
+}
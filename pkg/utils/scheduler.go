@@ -0,0 +1,425 @@
+package utils
+
+import (
+   "bufio"
+   "bytes"
+   "context"
+   "fmt"
+   "io/ioutil"
+   "os"
+   "os/exec"
+   "path/filepath"
+   "regexp"
+   "strconv"
+   "strings"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+)
+
+
+// names of batch schedulers, as set in MESA_SCHEDULER
+const (
+   SchedulerNone = "none"
+   SchedulerSlurm = "slurm"
+   SchedulerPBS = "pbs"
+)
+
+// how long the list of jobs is reused before asking the scheduler again
+const schedulerTTL = 30 * time.Second
+
+// time allowed to scheduler commands
+const schedulerTimeout = 10 * time.Second
+
+// format asked to squeue & sacct: job id, partition, name, state, time limit, elapsed time & working
+// directory, separated by "|". commands set in MESA_SCHEDULER_QUEUE_CMD or MESA_SCHEDULER_ACCT_CMD
+// for slurm must print this same format
+var squeueCommand = []string{"squeue", "--noheader", "--format=%i|%P|%j|%T|%l|%M|%Z"}
+var sacctCommand = []string{"sacct", "--noheader", "--parsable2", "--allocations", "--starttime=now-7days", "--format=JobID,Partition,JobName,State,Timelimit,Elapsed,WorkDir"}
+
+// full info of every job, in blocks of "name = value" lines. commands set in
+// MESA_SCHEDULER_QUEUE_CMD for PBS must print this same format
+var qstatCommand = []string{"qstat", "-f"}
+
+// slurm puts processes of a job in a cgroup with the job id in its path
+var slurmCgroup = regexp.MustCompile(`/job_(\d+)(/|$)`)
+
+
+// a job of the batch scheduler
+type Job struct {
+   Scheduler string
+   ID string
+   Name string
+   Partition string
+   State string
+   WorkDir string
+   TimeLimit time.Duration
+   Elapsed time.Duration
+   TimeLeft time.Duration
+   KillAt time.Time
+   Active bool
+}
+
+
+// whether the job is running right now, as opposed to waiting in the queue or finished
+func (j *Job) Running () bool {
+
+   return j.State == "RUNNING" || j.State == "R"
+
+}
+
+
+// jobs of a batch scheduler, found by running its commands. the slurm job of a process is read from
+// its cgroup in the proc filesystem at ProcRoot
+type Scheduler struct {
+   Kind string
+   QueueCommand []string
+   AcctCommand []string
+   ProcRoot string
+   mu sync.Mutex
+   jobs []Job
+   err error
+   fetchedAt time.Time
+}
+
+
+// scheduler set in MESA_SCHEDULER (slurm, pbs or none). when not set, slurm or PBS are used if
+// squeue or qstat are found in PATH. commands may be replaced with MESA_SCHEDULER_QUEUE_CMD and
+// MESA_SCHEDULER_ACCT_CMD, e.g. with a script printing fake jobs
+func NewScheduler () *Scheduler {
+
+   kind := strings.ToLower(strings.TrimSpace(os.Getenv("MESA_SCHEDULER")))
+   if kind == "" {
+      kind = SchedulerNone
+      if _, err := exec.LookPath("squeue"); err == nil {
+         kind = SchedulerSlurm
+      } else if _, err := exec.LookPath("qstat"); err == nil {
+         kind = SchedulerPBS
+      }
+   }
+
+   s := &Scheduler{Kind: kind, ProcRoot: DefaultProcessScanner().Root}
+   switch kind {
+   case SchedulerSlurm:
+      s.QueueCommand = squeueCommand
+      s.AcctCommand = sacctCommand
+   case SchedulerPBS:
+      s.QueueCommand = qstatCommand
+   default:
+      s.Kind = SchedulerNone
+   }
+
+   if env := strings.Fields(os.Getenv("MESA_SCHEDULER_QUEUE_CMD")); len(env) > 0 {
+      s.QueueCommand = env
+   }
+   if env := strings.Fields(os.Getenv("MESA_SCHEDULER_ACCT_CMD")); len(env) > 0 {
+      s.AcctCommand = env
+   }
+
+   return s
+
+}
+
+
+// jobs active or recently finished, the former first. results are reused for schedulerTTL, and so
+// are errors, so that a scheduler that is down or slow is not asked again on every request
+func (s *Scheduler) Jobs () ([]Job, error) {
+
+   s.mu.Lock()
+   defer s.mu.Unlock()
+
+   if s.Kind == SchedulerNone {
+      return nil, nil
+   }
+   if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < schedulerTTL {
+      return s.jobs, s.err
+   }
+
+   s.jobs, s.err = s.fetchJobs()
+   s.fetchedAt = time.Now()
+
+   return s.jobs, s.err
+
+}
+
+
+// ask the scheduler for its jobs
+func (s *Scheduler) fetchJobs () ([]Job, error) {
+
+   out, err := runCommand(s.QueueCommand)
+   if err != nil {
+      return nil, err
+   }
+
+   var jobs []Job
+   if s.Kind == SchedulerPBS {
+      jobs = parseQstat(out)
+   } else {
+      jobs = parseSlurm(out, true)
+   }
+
+   // finished jobs tell how a run that is not running anymore ended
+   if s.Kind == SchedulerSlurm && len(s.AcctCommand) > 0 {
+      if out, err := runCommand(s.AcctCommand); err == nil {
+         seen := make(map[string]bool)
+         for _, job := range jobs {
+            seen[job.ID] = true
+         }
+         for _, job := range parseSlurm(out, false) {
+            if !seen[job.ID] {
+               jobs = append(jobs, job)
+            }
+         }
+      } else {
+         io.LogError("UTILS - scheduler.go - fetchJobs", "problem running sacct: " + err.Error())
+      }
+   }
+
+   for k := range jobs {
+      jobs[k].Scheduler = s.Kind
+      jobs[k].WorkDir = cleanDir(jobs[k].WorkDir)
+      if jobs[k].Running() && jobs[k].TimeLimit > 0 {
+         jobs[k].TimeLeft = jobs[k].TimeLimit - jobs[k].Elapsed
+         jobs[k].KillAt = time.Now().Add(jobs[k].TimeLeft)
+      }
+   }
+
+   return jobs, nil
+
+}
+
+
+// job running a run: the one of the process when slurm tells it in its cgroup, else the active job
+// started in the run directory, else the last one that was
+func (s *Scheduler) JobFor (rootDir string, pid int) *Job {
+
+   jobs, err := s.Jobs()
+   if err != nil {
+      io.LogError("UTILS - scheduler.go - JobFor", "problem getting jobs: " + err.Error())
+      return nil
+   }
+
+   if pid > 0 {
+      if id := slurmJobOfPid(s.ProcRoot, pid); id != "" {
+         for k := range jobs {
+            if jobs[k].ID == id {
+               return &jobs[k]
+            }
+         }
+      }
+   }
+
+   // finished jobs come in order of start time, keep the last one
+   var last *Job
+   dir := cleanDir(rootDir)
+   for k := range jobs {
+      if jobs[k].WorkDir != dir {
+         continue
+      }
+      if jobs[k].Active {
+         return &jobs[k]
+      }
+      last = &jobs[k]
+   }
+
+   return last
+
+}
+
+
+// id of the slurm job a process belongs to, read from its cgroup in the proc filesystem at root
+func slurmJobOfPid (root string, pid int) string {
+
+   raw, err := ioutil.ReadFile(filepath.Join(root, strconv.Itoa(pid), "cgroup"))
+   if err != nil {
+      return ""
+   }
+
+   if match := slurmCgroup.FindSubmatch(raw); match != nil {
+      return string(match[1])
+   }
+
+   return ""
+
+}
+
+
+func runCommand (command []string) ([]byte, error) {
+
+   if len(command) == 0 {
+      return nil, fmt.Errorf("no scheduler command set")
+   }
+
+   ctx, cancel := context.WithTimeout(context.Background(), schedulerTimeout)
+   defer cancel()
+
+   out, err := exec.CommandContext(ctx, command[0], command[1:]...).Output()
+   if err != nil {
+      return nil, fmt.Errorf("%s: %w", command[0], err)
+   }
+
+   return out, nil
+
+}
+
+
+// parse lines of "id|partition|name|state|limit|elapsed|workdir". active tells if those come from
+// the queue; jobs from accounting are active only if still running
+func parseSlurm (out []byte, active bool) []Job {
+
+   var jobs []Job
+
+   scanner := bufio.NewScanner(bytes.NewReader(out))
+   for scanner.Scan() {
+      fields := strings.Split(strings.TrimSpace(scanner.Text()), "|")
+      if len(fields) < 7 {
+         continue
+      }
+      job := Job{
+         ID: fields[0],
+         Partition: fields[1],
+         Name: fields[2],
+         State: fields[3],
+         TimeLimit: parseDuration(fields[4]),
+         Elapsed: parseDuration(fields[5]),
+         WorkDir: fields[6],
+      }
+      job.Active = active || job.State == "RUNNING" || job.State == "PENDING"
+      jobs = append(jobs, job)
+   }
+
+   return jobs
+
+}
+
+
+// parse the output of qstat -f: a "Job Id: <id>" line followed by indented "name = value" lines
+func parseQstat (out []byte) []Job {
+
+   var jobs []Job
+   var job *Job
+   var last string
+
+   scanner := bufio.NewScanner(bytes.NewReader(out))
+   scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+   for scanner.Scan() {
+
+      line := scanner.Text()
+      if strings.HasPrefix(line, "Job Id:") {
+         jobs = append(jobs, Job{ID: strings.TrimSpace(line[len("Job Id:"):]), Active: true})
+         job = &jobs[len(jobs)-1]
+         last = ""
+         continue
+      }
+      if job == nil {
+         continue
+      }
+
+      // long values continue on lines starting with a tab
+      if strings.HasPrefix(line, "\t") && last == "Variable_List" {
+         setQstatWorkDir(job, strings.TrimSpace(line))
+         continue
+      }
+
+      k := strings.Index(line, " = ")
+      if k < 0 {
+         continue
+      }
+      name, value := strings.TrimSpace(line[:k]), strings.TrimSpace(line[k+3:])
+      last = name
+
+      switch name {
+      case "Job_Name":
+         job.Name = value
+      case "queue":
+         job.Partition = value
+      case "job_state":
+         job.State = value
+         job.Active = value != "C" && value != "F" && value != "E"
+      case "Resource_List.walltime":
+         job.TimeLimit = parseDuration(value)
+      case "resources_used.walltime":
+         job.Elapsed = parseDuration(value)
+      case "Variable_List":
+         setQstatWorkDir(job, value)
+      }
+
+   }
+
+   return jobs
+
+}
+
+
+// PBS tells the directory a job was submitted from in its variable list
+func setQstatWorkDir (job *Job, variables string) {
+
+   for _, kv := range strings.Split(variables, ",") {
+      if strings.HasPrefix(kv, "PBS_O_WORKDIR=") {
+         job.WorkDir = strings.TrimPrefix(kv, "PBS_O_WORKDIR=")
+      }
+   }
+
+}
+
+
+// parse durations as written by schedulers: [days-]hours:minutes:seconds, minutes:seconds or
+// minutes. UNLIMITED & such are returned as 0
+func parseDuration (raw string) time.Duration {
+
+   raw = strings.TrimSpace(raw)
+
+   days := 0
+   if k := strings.Index(raw, "-"); k > 0 {
+      d, err := strconv.Atoi(raw[:k])
+      if err != nil {
+         return 0
+      }
+      days = d
+      raw = raw[k+1:]
+   }
+
+   parts := strings.Split(raw, ":")
+   values := make([]int, len(parts))
+   for k, part := range parts {
+      v, err := strconv.Atoi(part)
+      if err != nil {
+         return 0
+      }
+      values[k] = v
+   }
+
+   var h, m, s int
+   switch len(values) {
+   case 1:
+      m = values[0]
+      if days > 0 {
+         h, m = values[0], 0
+      }
+   case 2:
+      m, s = values[0], values[1]
+      if days > 0 {
+         h, m, s = values[0], values[1], 0
+      }
+   case 3:
+      h, m, s = values[0], values[1], values[2]
+   default:
+      return 0
+   }
+
+   return time.Duration(((days * 24 + h) * 60 + m) * 60 + s) * time.Second
+
+}
+
+
+// directory with a single trailing slash, as RootDir of runs
+func cleanDir (dir string) string {
+
+   if dir == "" {
+      return ""
+   }
+
+   return strings.TrimSuffix(filepath.Clean(dir), "/") + "/"
+
+}
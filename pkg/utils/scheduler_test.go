@@ -0,0 +1,97 @@
+package utils
+
+import (
+   "os"
+   "path/filepath"
+   "strings"
+   "testing"
+   "time"
+)
+
+
+// scheduler running a shell script that counts its calls in a file
+func countingScheduler (t *testing.T, script string) (*Scheduler, func() int) {
+
+   t.Helper()
+
+   calls := filepath.Join(t.TempDir(), "calls")
+   s := &Scheduler{Kind: SchedulerSlurm, QueueCommand: []string{"sh", "-c", "echo >> " + calls + "; " + script}}
+
+   count := func() int {
+      raw, err := os.ReadFile(calls)
+      if err != nil {
+         return 0
+      }
+      return strings.Count(string(raw), "\n")
+   }
+
+   return s, count
+
+}
+
+
+// jobs, no jobs & errors are all reused for the TTL, then asked for again
+func TestSchedulerJobsCache (t *testing.T) {
+
+   cases := []struct {
+      name string
+      script string
+      jobs int
+      fails bool
+   }{
+      {"jobs", "echo '1|normal|run1|RUNNING|1:00:00|10:00|/work/run1/'; echo '2|normal|run2|PENDING|1:00:00|0:00|/work/run2'", 2, false},
+      {"empty queue", "true", 0, false},
+      {"scheduler down", "exit 1", 0, true},
+   }
+
+   for _, c := range cases {
+      t.Run(c.name, func(t *testing.T) {
+
+         s, count := countingScheduler(t, c.script)
+
+         for k := 0; k < 3; k++ {
+            jobs, err := s.Jobs()
+            if len(jobs) != c.jobs || (err != nil) != c.fails {
+               t.Fatalf("call %d: got %d jobs & error %v", k, len(jobs), err)
+            }
+         }
+         if got := count(); got != 1 {
+            t.Errorf("scheduler asked %d times within the TTL, want 1", got)
+         }
+
+         s.fetchedAt = time.Now().Add(-2 * schedulerTTL)
+         if _, err := s.Jobs(); (err != nil) != c.fails {
+            t.Errorf("got error %v after the TTL", err)
+         }
+         if got := count(); got != 2 {
+            t.Errorf("scheduler asked %d times, want 2 once the TTL is over", got)
+         }
+
+      })
+   }
+
+}
+
+
+// slurm jobs get their scheduler, a clean work directory & the time they have left
+func TestSchedulerJobs (t *testing.T) {
+
+   s, _ := countingScheduler(t, "echo '1|normal|run1|RUNNING|1:00:00|10:00|/work/run1'")
+
+   jobs, err := s.Jobs()
+   if err != nil || len(jobs) != 1 {
+      t.Fatalf("got %+v, %v", jobs, err)
+   }
+   job := jobs[0]
+   if job.Scheduler != SchedulerSlurm || job.WorkDir != "/work/run1/" || !job.Active || !job.Running() {
+      t.Errorf("got %+v", job)
+   }
+   if job.TimeLimit != time.Hour || job.Elapsed != 10 * time.Minute || job.TimeLeft != 50 * time.Minute {
+      t.Errorf("got limit %v, elapsed %v & left %v", job.TimeLimit, job.Elapsed, job.TimeLeft)
+   }
+
+   if jobs, err := (&Scheduler{Kind: SchedulerNone}).Jobs(); jobs != nil || err != nil {
+      t.Errorf("got %+v, %v without scheduler", jobs, err)
+   }
+
+}
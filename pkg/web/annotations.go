@@ -0,0 +1,224 @@
+package web
+
+import (
+   "encoding/json"
+   "fmt"
+   "net/http"
+   "net/url"
+   "os"
+   "strings"
+
+   "web-service/pkg/io"
+   "web-service/pkg/store"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// database file of the service, changed with MESA_DB
+var storeName = "mesa.db"
+
+// database of the service, nil if it could not be opened
+var runStore *store.Store
+
+
+// open the database of the service. without it runs cannot be annotated
+func initStore () {
+
+   name := storeName
+   if env := strings.TrimSpace(os.Getenv("MESA_DB")); env != "" {
+      name = env
+   }
+
+   s, err := store.Open(name)
+   if err != nil {
+      io.LogError("WEB - annotations.go - initStore", "problem opening database " + name + ": " + err.Error())
+      return
+   }
+   runStore = s
+   io.LogInfo("WEB - annotations.go - initStore", "database in " + name)
+
+}
+
+
+// annotations of every run, by run ID. empty without database
+func runAnnotations () map[string]*store.Annotation {
+
+   if runStore == nil {
+      return nil
+   }
+
+   annotations, err := runStore.Annotations()
+   if err != nil {
+      io.LogError("WEB - annotations.go - runAnnotations", "problem reading annotations: " + err.Error())
+   }
+
+   return annotations
+
+}
+
+
+// runs matching the filters of a query: tag, owner, starred & q (text in directory, notes or tags)
+func filterRuns (runs []Run, query url.Values) []Run {
+
+   tag := strings.TrimSpace(query.Get("tag"))
+   owner := strings.TrimSpace(query.Get("owner"))
+   starred := query.Get("starred") != ""
+   text := strings.ToLower(strings.TrimSpace(query.Get("q")))
+
+   if tag == "" && owner == "" && !starred && text == "" {
+      return runs
+   }
+
+   filtered := []Run{}
+   for _, run := range runs {
+      a := run.Annotation
+      if a == nil {
+         a = &store.Annotation{}
+      }
+      if tag != "" && !a.HasTag(tag) {
+         continue
+      }
+      if owner != "" && !strings.EqualFold(a.Owner, owner) {
+         continue
+      }
+      if starred && !a.Starred {
+         continue
+      }
+      if text != "" {
+         haystack := strings.ToLower(run.ID + " " + run.RootDir + " " + a.Notes + " " + strings.Join(a.Tags, " "))
+         if !strings.Contains(haystack, text) {
+            continue
+         }
+      }
+      filtered = append(filtered, run)
+   }
+
+   return filtered
+
+}
+
+
+// changes to the annotation of a run. fields not sent are left as they were
+type AnnotationUpdate struct {
+   Notes *string
+   Tags *[]string
+   Starred *bool
+   Owner *string
+}
+
+
+// changes sent in a form: notes, tags (comma separated), owner & starred (a checkbox, so always set)
+func annotationFromForm (request *http.Request) AnnotationUpdate {
+
+   notes := request.FormValue("notes")
+   tags := strings.Split(request.FormValue("tags"), ",")
+   owner := request.FormValue("owner")
+   starred := request.FormValue("starred") != ""
+
+   return AnnotationUpdate{Notes: &notes, Tags: &tags, Starred: &starred, Owner: &owner}
+
+}
+
+
+// apply changes to the annotation of a run. returns the HTTP status, a message telling what
+// happened & the annotation saved
+func annotateRun (request *http.Request, id string, update AnnotationUpdate) (int, string, *store.Annotation) {
+
+   if status, result := actionAllowed(request); status != http.StatusOK {
+      return status, result, nil
+   }
+   if runStore == nil {
+      return http.StatusServiceUnavailable, "no database to keep annotations in", nil
+   }
+
+   run := findRun(id)
+   if run == nil {
+      return http.StatusNotFound, "unknown run " + id, nil
+   }
+
+   user, _, _ := request.BasicAuth()
+   a, err := runStore.UpdateAnnotation(run.ID, func(a *store.Annotation) {
+      a.RootDir = run.RootDir
+      a.UpdatedBy = user
+      if update.Notes != nil {
+         a.Notes = strings.TrimSpace(*update.Notes)
+      }
+      if update.Tags != nil {
+         a.Tags = *update.Tags
+      }
+      if update.Starred != nil {
+         a.Starred = *update.Starred
+      }
+      if update.Owner != nil {
+         a.Owner = strings.TrimSpace(*update.Owner)
+      }
+   })
+   if err != nil {
+      return http.StatusInternalServerError, err.Error(), nil
+   }
+
+   return http.StatusOK, fmt.Sprintf("annotations of run %s saved", run.ID), a
+
+}
+
+
+// annotation of a run: GET /api/runs/:id/annotation
+func AnnotationAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   run := findRun(params.ByName("id"))
+   if run == nil {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "unknown run " + params.ByName("id")})
+      return
+   }
+
+   a := run.Annotation
+   if a == nil {
+      a = &store.Annotation{RunID: run.ID, RootDir: run.RootDir, Tags: []string{}}
+   }
+
+   writeJSON(writer, http.StatusOK, a)
+
+}
+
+
+// change the annotation of a run: PUT /api/runs/:id/annotation with a JSON body with any of Notes,
+// Tags, Starred & Owner
+func AnnotationUpdateAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   var update AnnotationUpdate
+   if err := json.NewDecoder(request.Body).Decode(&update); err != nil {
+      writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "bad annotation: " + err.Error()})
+      return
+   }
+
+   status, result, a := annotateRun(request, params.ByName("id"), update)
+   if a == nil {
+      writeJSON(writer, status, map[string]string{"error": result})
+      return
+   }
+
+   writeJSON(writer, status, a)
+
+}
+
+
+// change the annotation of a run from the runs page, which is shown again with the result
+func AnnotationHTML (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   _, result, _ := annotateRun(request, params.ByName("id"), annotationFromForm(request))
+
+   http.Redirect(writer, request, "/runs?msg=" + url.QueryEscape(result), http.StatusSeeOther)
+
+}
+
+
+// star or unstar a run from the runs page, leaving the rest of its annotation as it was
+func StarHTML (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   starred := request.FormValue("starred") != ""
+   _, result, _ := annotateRun(request, params.ByName("id"), AnnotationUpdate{Starred: &starred})
+
+   http.Redirect(writer, request, "/runs?msg=" + url.QueryEscape(result), http.StatusSeeOther)
+
+}
@@ -0,0 +1,408 @@
+package web
+
+import (
+   "encoding/json"
+   "errors"
+   "html/template"
+   "math"
+   "net/http"
+   "strconv"
+   "strings"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/plot"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// struct with info to print in profile page
+type ProfilePageData struct {
+   Star int
+   RunID string
+   RootDir string
+   Profiles []mesa.MESAprofileEntry
+   Error string
+}
+
+
+// write v as a JSON response
+func writeJSON (writer http.ResponseWriter, status int, v interface{}) {
+
+   writer.Header().Set("Content-Type", "application/json")
+   writer.WriteHeader(status)
+
+   if err := json.NewEncoder(writer).Encode(v); err != nil {
+      io.LogError("WEB - api.go - writeJSON", "problem encoding JSON response: " + err.Error())
+   }
+
+}
+
+
+// write an error as a JSON response
+func writeJSONError (writer http.ResponseWriter, status int, err error) {
+
+   writeJSON(writer, status, map[string]string{"error": err.Error()})
+
+}
+
+
+// JSON cannot hold NaN nor Infinity, so send those as null
+func jsonSeries (values []float64) []*float64 {
+
+   series := make([]*float64, len(values))
+   for k := range values {
+      if !math.IsNaN(values[k]) && !math.IsInf(values[k], 0) {
+         series[k] = &values[k]
+      }
+   }
+
+   return series
+
+}
+
+
+// split a comma separated query parameter, empty if not present
+func queryList (request *http.Request, name string) []string {
+
+   var list []string
+   for _, value := range strings.Split(request.URL.Query().Get(name), ",") {
+      if value = strings.TrimSpace(value); value != "" {
+         list = append(list, value)
+      }
+   }
+
+   return list
+
+}
+
+
+// find the LOGS directory of the star asked in the :star parameter of the run asked for
+func starLogDir (request *http.Request, params httprouter.Params) (int, *mesa.MESAInfo, string) {
+
+   star, err := strconv.Atoi(params.ByName("star"))
+   if err != nil || (star != 1 && star != 2) {
+      return 0, nil, ""
+   }
+
+   mesaInfo := runFilesFromRequest(request)
+
+   return star, mesaInfo, mesaInfo.StarLogDir(star)
+
+}
+
+
+// list of profiles of a star: GET /api/profiles/:star?run=<id>
+func ProfilesAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   star, _, logDir := starLogDir(request, params)
+   if star == 0 || logDir == "" {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no LOGS found for star " + params.ByName("star")})
+      return
+   }
+
+   profiles, err := mesa.ListProfiles(logDir)
+   if err != nil {
+      writeJSONError(writer, http.StatusNotFound, err)
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, profiles)
+
+}
+
+
+// columns of a profile: GET /api/profiles/:star/:number?run=<id>&columns=logT,logRho
+func ProfileAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   timer := time.Now()
+
+   star, _, logDir := starLogDir(request, params)
+   if star == 0 || logDir == "" {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no LOGS found for star " + params.ByName("star")})
+      return
+   }
+
+   number, err := strconv.Atoi(params.ByName("number"))
+   if err != nil {
+      writeJSONError(writer, http.StatusBadRequest, err)
+      return
+   }
+
+   profiles, err := mesa.ListProfiles(logDir)
+   if err != nil {
+      writeJSONError(writer, http.StatusNotFound, err)
+      return
+   }
+
+   for _, entry := range profiles {
+      if entry.ProfileNumber != number {
+         continue
+      }
+
+      profile, err := mesa.LoadProfile(entry, queryList(request, "columns"))
+      if err != nil {
+         writeJSONError(writer, http.StatusInternalServerError, err)
+         return
+      }
+
+      data := make(map[string][]*float64, len(profile.Data))
+      for name, values := range profile.Data {
+         data[name] = jsonSeries(values)
+      }
+
+      writeJSON(writer, http.StatusOK, map[string]interface{}{
+         "ModelNumber": profile.ModelNumber,
+         "Priority": profile.Priority,
+         "ProfileNumber": profile.ProfileNumber,
+         "HeaderNames": profile.HeaderNames,
+         "HeaderValues": profile.HeaderValues,
+         "Columns": profile.Columns,
+         "Data": data,
+      })
+      io.LogInfo("WEB - api.go - ProfileAPI", "profile sent in "+time.Since(timer).String())
+      return
+   }
+
+   writeJSON(writer, http.StatusNotFound, map[string]string{"error": "profile " + params.ByName("number") + " not found"})
+
+}
+
+
+// profile.html serving func
+func ProfileHTML (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   // start counting time until serve files
+   timer := time.Now()
+
+   data := new(ProfilePageData)
+
+   star, mesaInfo, logDir := starLogDir(request, params)
+   data.Star = star
+   if mesaInfo != nil && mesaInfo.RootDir != "" {
+      data.RootDir = mesaInfo.RootDir
+      data.RunID = runID(mesaInfo.RootDir)
+   }
+
+   if logDir == "" {
+      data.Error = "no LOGS directory found for star " + params.ByName("star")
+   } else {
+      profiles, err := mesa.ListProfiles(logDir)
+      if err != nil {
+         data.Error = err.Error()
+      }
+      data.Profiles = profiles
+   }
+
+   tmpl := template.Must(template.ParseFiles("web/html/profile.html"))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - api.go - ProfileHTML", "page sent in "+time.Since(timer).String())
+
+}
+
+
+// downsampled values of a y column against x
+type seriesData struct {
+   Y string `json:"y"`
+   X []*float64 `json:"x"`
+   Values []*float64 `json:"values"`
+}
+
+
+// default & largest number of points per series returned by SeriesAPI
+const defaultSeriesPoints = 1000
+const maxSeriesPoints = 100000
+
+
+// history columns downsampled for plotting:
+// GET /api/series/:source?run=<id>&x=star_age&y=log_L,log_Teff&logx=1&logy=1&max=1000
+// with logx or logy, values are returned as log10 and downsampling is done in log space
+func SeriesAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   timer := time.Now()
+
+   source := params.ByName("source")
+   query := request.URL.Query()
+
+   x := query.Get("x")
+   ys := queryList(request, "y")
+   if x == "" || len(ys) == 0 {
+      writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "both x and y columns are needed"})
+      return
+   }
+
+   logX := query.Get("logx") != ""
+   logY := query.Get("logy") != ""
+
+   max := defaultSeriesPoints
+   if raw := query.Get("max"); raw != "" {
+      var err error
+      max, err = strconv.Atoi(raw)
+      if err != nil || max < 3 {
+         writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "max must be an integer >= 3"})
+         return
+      }
+      if max > maxSeriesPoints {
+         max = maxSeriesPoints
+      }
+   }
+
+   filename := historyFilename(runFilesFromRequest(request), source)
+   if filename == "" {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no history found for " + source})
+      return
+   }
+
+   data, err := readHistoryColumns(filename, append([]string{x}, ys...)...)
+   if err != nil {
+      status := http.StatusInternalServerError
+      if errors.Is(err, mesa.ErrUnknownColumn) {
+         status = http.StatusBadRequest
+      }
+      writeJSONError(writer, status, err)
+      return
+   }
+
+   xValues := data[x]
+   if logX {
+      xValues = log10All(xValues)
+   }
+
+   series := make([]seriesData, 0, len(ys))
+   for _, y := range ys {
+      index := plot.Downsample(data[x], data[y], logX, logY, max)
+      yValues := data[y]
+      if logY {
+         yValues = log10All(yValues)
+      }
+      series = append(series, seriesData{
+         Y: y,
+         X: jsonSeries(plot.Pick(xValues, index)),
+         Values: jsonSeries(plot.Pick(yValues, index)),
+      })
+   }
+
+   writeJSON(writer, http.StatusOK, map[string]interface{}{
+      "source": source,
+      "x": x,
+      "logx": logX,
+      "logy": logY,
+      "rows": len(data[x]),
+      "series": series,
+   })
+   io.LogInfo("WEB - api.go - SeriesAPI", "series sent in "+time.Since(timer).String())
+
+}
+
+
+// log10 of every value, NaN for non positive ones
+func log10All (values []float64) []float64 {
+
+   logs := make([]float64, len(values))
+   for k, v := range values {
+      if v > 0 {
+         logs[k] = math.Log10(v)
+      } else {
+         logs[k] = math.NaN()
+      }
+   }
+
+   return logs
+
+}
+
+
+// events along the binary history of a run: GET /api/timeline?run=<id>
+func TimelineAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   mesaInfo := runFromRequest(request)
+   if mesaInfo.RootDir == "" || !mesaInfo.IsBinaryEvolution {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no binary run found"})
+      return
+   }
+   if mesaInfo.Timeline == nil {
+      writeJSON(writer, http.StatusInternalServerError, map[string]string{"error": "cannot build timeline"})
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, mesaInfo.Timeline)
+
+}
+
+
+// stages & core collapses of a bin2dco run: GET /api/bin2dco?run=<id>
+func Bin2dcoAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   mesaInfo := runFilesFromRequest(request)
+   if mesaInfo.RootDir == "" || !mesaInfo.IsBin2dco || mesaInfo.Bin2dco == nil {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no bin2dco run found"})
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, mesaInfo.Bin2dco)
+
+}
+
+
+// history converted to csv, jsonl or parquet, streamed as it is read:
+// GET /api/export/:source?run=<id>&format=csv&columns=star_age,log_L&from=0&to=1000
+func ExportAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   timer := time.Now()
+
+   source := params.ByName("source")
+   query := request.URL.Query()
+
+   format := mesa.FormatCSV
+   if name := query.Get("format"); name != "" {
+      var err error
+      format, err = mesa.ParseExportFormat(name)
+      if err != nil {
+         writeJSONError(writer, http.StatusBadRequest, err)
+         return
+      }
+   }
+
+   opts := &mesa.ExportOptions{Columns: queryList(request, "columns")}
+   for name, row := range map[string]*int{"from": &opts.FirstRow, "to": &opts.LastRow} {
+      if raw := query.Get(name); raw != "" {
+         var err error
+         *row, err = strconv.Atoi(raw)
+         if err != nil || *row < 0 {
+            writeJSON(writer, http.StatusBadRequest, map[string]string{"error": name + " must be a row number >= 0"})
+            return
+         }
+      }
+   }
+
+   filename := historyFilename(runFilesFromRequest(request), source)
+   if filename == "" {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no history found for " + source})
+      return
+   }
+
+   d, err := mesa.OpenDataFile(filename)
+   if err != nil {
+      writeJSONError(writer, http.StatusInternalServerError, err)
+      return
+   }
+
+   // check columns before starting to stream, so that a bad request still gets a proper answer
+   for _, column := range opts.Columns {
+      if d.LookupColumn(column) < 0 {
+         writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "unknown column " + column})
+         return
+      }
+   }
+
+   writer.Header().Set("Content-Type", format.ContentType())
+   writer.Header().Set("Content-Disposition", `attachment; filename="` + source + "_history" + format.Extension() + `"`)
+   if err := historyCache.Export(filename, writer, format, opts); err != nil {
+      io.LogError("WEB - api.go - ExportAPI", "problem exporting " + filename + ": " + err.Error())
+      return
+   }
+   io.LogInfo("WEB - api.go - ExportAPI", "export sent in "+time.Since(timer).String())
+
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+   "os"
+   "strings"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+)
+
+
+// cache of parsed histories, nil when MESA_CACHE_DIR is not set. plots, series, timelines and
+// exports all read histories through it
+var historyCache *mesa.HistoryCache
+
+
+// set up the history cache in MESA_CACHE_DIR. histories already cached, and those of all runs found
+// in MESA_RUNS_ROOTS, are brought up to date in the background so that first queries are fast
+func initHistoryCache () {
+
+   dir := strings.TrimSpace(os.Getenv("MESA_CACHE_DIR"))
+   if dir == "" {
+      io.LogInfo("WEB - cache.go - initHistoryCache", "MESA_CACHE_DIR not set, histories will not be cached")
+      return
+   }
+
+   cache, err := mesa.NewHistoryCache(dir)
+   if err != nil {
+      io.LogError("WEB - cache.go - initHistoryCache", "problem creating history cache: " + err.Error())
+      return
+   }
+   paths, err := cache.Load()
+   if err != nil {
+      io.LogError("WEB - cache.go - initHistoryCache", "problem loading history cache: " + err.Error())
+   }
+   historyCache = cache
+
+   go warmHistoryCache(paths)
+
+}
+
+
+// update cached histories plus those of every known run
+func warmHistoryCache (paths []string) {
+
+   timer := time.Now()
+
+   for _, run := range listRuns() {
+      mesaInfo := &mesa.MESAInfo{RootDir: run.RootDir}
+      _ = mesaInfo.LoadMESAData()
+      for _, path := range []string{mesaInfo.BinaryFilename, mesaInfo.Star1Filename, mesaInfo.Star2Filename} {
+         if path != "" {
+            paths = append(paths, path)
+         }
+      }
+   }
+
+   seen := make(map[string]bool)
+   for _, path := range paths {
+      if seen[path] {
+         continue
+      }
+      seen[path] = true
+      if err := historyCache.Update(path); err != nil {
+         io.LogError("WEB - cache.go - warmHistoryCache", "problem caching " + path + ": " + err.Error())
+      }
+   }
+
+   io.LogInfo("WEB - cache.go - warmHistoryCache", "history cache ready in "+time.Since(timer).String())
+
+}
+
+
+// load full columns of a history, out of the cache when there is one
+func readHistoryColumns (filename string, columns ...string) (map[string][]float64, error) {
+
+   if historyCache == nil {
+      return mesa.ReadHistoryColumns(filename, columns...)
+   }
+
+   return historyCache.ReadColumns(filename, columns...)
+
+}
@@ -0,0 +1,331 @@
+package web
+
+import (
+   "errors"
+   "fmt"
+   "html/template"
+   "net/http"
+   "net/url"
+   "path/filepath"
+   "strings"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/plot"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// a quantity shown side by side for every run compared
+type CompareRow struct {
+   Label string
+   Values []string
+}
+
+
+// how each row of the comparison table is taken from a run
+var compareRows = []struct {
+   Label string
+   Value func(m *mesa.MESAInfo) string
+}{
+   {"star 1: model", func(m *mesa.MESAInfo) string { return fmt.Sprint(m.Star1Info.ModelNumber) }},
+   {"star 1: age [yr]", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.4g", m.Star1Info.Age) }},
+   {"star 1: mass [Msun]", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.4g", m.Star1Info.Mass) }},
+   {"star 1: log |Mdot| [Msun/yr]", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.3f", m.Star1Info.LogMdot) }},
+   {"star 1: center H1", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.4g", m.Star1Info.CenterH1) }},
+   {"star 1: center He4", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.4g", m.Star1Info.CenterHe4) }},
+   {"star 1: log center T [K]", func(m *mesa.MESAInfo) string { return fmt.Sprintf("%.3f", m.Star1Info.LogTcntr) }},
+   {"star 1: stage", func(m *mesa.MESAInfo) string { return m.Star1Info.EvolState }},
+   {"star 2: mass [Msun]", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.4g", m.Star2Info.Mass) }) }},
+   {"star 2: stage", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return m.Star2Info.EvolState }) }},
+   {"binary: model", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprint(m.BinaryInfo.ModelNumber) }) }},
+   {"binary: age [yr]", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.4g", m.BinaryInfo.Age) }) }},
+   {"binary: period [days]", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.4g", m.BinaryInfo.Period) }) }},
+   {"binary: separation [Rsun]", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.4g", m.BinaryInfo.Separation) }) }},
+   {"binary: eccentricity", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.3g", m.BinaryInfo.Eccentricity) }) }},
+   {"binary: mass ratio", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.3g", m.BinaryInfo.MassRatio) }) }},
+   {"binary: log MT rate [Msun/yr]", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return fmt.Sprintf("%.3f", m.BinaryInfo.LogMTRate) }) }},
+   {"binary: MT", func(m *mesa.MESAInfo) string { return compareBinary(m, func() string { return m.BinaryInfo.MTCase }) }},
+}
+
+
+// value of a binary quantity, empty for isolated stars
+func compareBinary (m *mesa.MESAInfo, value func() string) string {
+
+   if !m.IsBinaryEvolution {
+      return ""
+   }
+
+   return value()
+
+}
+
+
+// info on compare.html: runs overlaid & the plot shown
+type CompareData struct {
+   Runs []*mesa.MESAInfo
+   IDs []string
+   Labels []string
+   Rows []CompareRow
+   Source string
+   Preset string
+   X string
+   Y string
+   LogX, LogY bool
+   PlotQuery template.URL
+   Presets []PlotLink
+}
+
+
+// name of a run in legends, its directory
+func runLabel (rootDir string) string {
+
+   return filepath.Base(strings.TrimSuffix(rootDir, "/"))
+
+}
+
+
+// runs asked for in the "run" query parameters (at least two of them), with a summary of each
+func compareRuns (request *http.Request) ([]*mesa.MESAInfo, int, error) {
+
+   ids := request.URL.Query()["run"]
+   if len(ids) < 2 {
+      return nil, http.StatusBadRequest, fmt.Errorf("select at least two runs to compare")
+   }
+
+   var runs []*mesa.MESAInfo
+   for _, id := range ids {
+      run := findRun(id)
+      if run == nil {
+         return nil, http.StatusNotFound, fmt.Errorf("unknown run %s", id)
+      }
+      mesaInfo := &mesa.MESAInfo{ProcId: run.ProcId, RootDir: run.RootDir}
+      loadMESASummary(mesaInfo)
+      runs = append(runs, mesaInfo)
+   }
+
+   return runs, http.StatusOK, nil
+
+}
+
+
+// quantities of every run, side by side
+func compareTable (runs []*mesa.MESAInfo) []CompareRow {
+
+   rows := make([]CompareRow, 0, len(compareRows))
+   for _, r := range compareRows {
+      row := CompareRow{Label: r.Label}
+      for _, m := range runs {
+         row.Values = append(row.Values, r.Value(m))
+      }
+      rows = append(rows, row)
+   }
+
+   return rows
+
+}
+
+
+// what to overlay: a preset of the source (star1, star2 or binary) or custom columns x & y (comma
+// separated), as in /plots/:source/:name
+func comparePreset (request *http.Request) (string, plotPreset, error) {
+
+   query := request.URL.Query()
+
+   source := query.Get("source")
+   if source == "" {
+      source = "star1"
+   }
+   if source != "star1" && source != "star2" && source != "binary" {
+      return "", plotPreset{}, fmt.Errorf("unknown history %s", source)
+   }
+
+   if query.Get("x") != "" || query.Get("y") != "" {
+      preset := plotPreset{
+         X: query.Get("x"),
+         Y: queryList(request, "y"),
+         LogX: query.Get("logx") != "",
+         LogY: query.Get("logy") != "",
+      }
+      if preset.X == "" || len(preset.Y) == 0 {
+         return "", plotPreset{}, fmt.Errorf("both x and y columns are needed")
+      }
+      preset.Title = source + ": " + strings.Join(preset.Y, ", ") + " vs " + preset.X
+      preset.XLabel = preset.X
+      if len(preset.Y) == 1 {
+         preset.YLabel = preset.Y[0]
+      }
+      return source, preset, nil
+   }
+
+   name := query.Get("preset")
+   if name == "" {
+      name = "mass"
+   }
+   preset, ok := plotPresets(source)[name]
+   if !ok {
+      return "", plotPreset{}, fmt.Errorf("unknown plot %s", name)
+   }
+
+   return source, preset, nil
+
+}
+
+
+// plot with the columns of a preset overlaid for all runs. runs missing the history or its columns
+// are left out
+func buildComparePlot (runs []*mesa.MESAInfo, source string, preset plotPreset) (*plot.Plot, error) {
+
+   p := &plot.Plot{
+      Title: preset.Title,
+      XLabel: preset.XLabel,
+      YLabel: preset.YLabel,
+      LogX: preset.LogX,
+      LogY: preset.LogY,
+      InvertX: preset.InvertX,
+   }
+
+   var lastErr error
+   for _, m := range runs {
+      filename := historyFilename(m, source)
+      if filename == "" {
+         continue
+      }
+      data, err := readHistoryColumns(filename, append([]string{preset.X}, preset.Y...)...)
+      if err != nil {
+         io.LogError("WEB - compare.go - buildComparePlot", "problem reading " + filename + ": " + err.Error())
+         lastErr = err
+         continue
+      }
+      for _, y := range preset.Y {
+         label := runLabel(m.RootDir)
+         if len(preset.Y) > 1 {
+            label += ": " + y
+         }
+         index := plot.Downsample(data[preset.X], data[y], p.LogX, p.LogY, maxPlotPoints)
+         p.Series = append(p.Series, plot.Series{
+            Label: label,
+            X: plot.Pick(data[preset.X], index),
+            Y: plot.Pick(data[y], index),
+         })
+      }
+   }
+
+   if len(p.Series) == 0 && lastErr != nil {
+      return nil, lastErr
+   }
+
+   return p, nil
+
+}
+
+
+// overlaid histories of several runs as SVG: GET /compare/plot.svg?run=<id>&run=<id>...
+func ComparePlotSVG (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   timer := time.Now()
+
+   runs, status, err := compareRuns(request)
+   if err != nil {
+      http.Error(writer, err.Error(), status)
+      return
+   }
+
+   source, preset, err := comparePreset(request)
+   if err != nil {
+      http.Error(writer, err.Error(), http.StatusBadRequest)
+      return
+   }
+
+   p, err := buildComparePlot(runs, source, preset)
+   if err != nil {
+      status := http.StatusInternalServerError
+      if errors.Is(err, mesa.ErrUnknownColumn) {
+         status = http.StatusBadRequest
+      }
+      http.Error(writer, err.Error(), status)
+      return
+   }
+
+   writer.Header().Set("Content-Type", "image/svg+xml")
+   if err := p.WriteSVG(writer); err != nil {
+      io.LogError("WEB - compare.go - ComparePlotSVG", "problem writing plot: " + err.Error())
+      return
+   }
+   io.LogInfo("WEB - compare.go - ComparePlotSVG", "plot sent in "+time.Since(timer).String())
+
+}
+
+
+// current info of several runs, side by side: GET /api/compare?run=<id>&run=<id>...
+func CompareAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   runs, status, err := compareRuns(request)
+   if err != nil {
+      writeJSONError(writer, status, err)
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, struct {
+      Runs []*mesa.MESAInfo
+      Rows []CompareRow
+   }{runs, compareTable(runs)})
+
+}
+
+
+// compare.html serving func
+func CompareHTML (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   // start counting time until serve files
+   timer := time.Now()
+
+   runs, status, err := compareRuns(request)
+   if err != nil {
+      http.Error(writer, err.Error(), status)
+      return
+   }
+
+   query := request.URL.Query()
+   data := CompareData{
+      Runs: runs,
+      Rows: compareTable(runs),
+      Source: query.Get("source"),
+      Preset: query.Get("preset"),
+      X: query.Get("x"),
+      Y: query.Get("y"),
+      LogX: query.Get("logx") != "",
+      LogY: query.Get("logy") != "",
+      PlotQuery: template.URL(query.Encode()),
+   }
+   if data.Source == "" {
+      data.Source = "star1"
+   }
+
+   runsQuery := url.Values{"run": query["run"]}
+   for _, m := range runs {
+      data.IDs = append(data.IDs, runID(m.RootDir))
+      data.Labels = append(data.Labels, runLabel(m.RootDir))
+   }
+
+   // presets of each history, overlaid
+   for _, source := range []string{"star1", "star2", "binary"} {
+      order := starPlotOrder
+      if source == "binary" {
+         order = binaryPlotOrder
+      }
+      for _, name := range order {
+         data.Presets = append(data.Presets, PlotLink{
+            Title: source + ": " + plotPresets(source)[name].Title,
+            URL: "/compare?" + runsQuery.Encode() + "&source=" + source + "&preset=" + name,
+         })
+      }
+   }
+
+   tmpl := template.Must(template.ParseFiles("web/html/compare.html"))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - compare.go - CompareHTML", "page sent in "+time.Since(timer).String())
+
+}
@@ -0,0 +1,179 @@
+package web
+
+import (
+   "encoding/json"
+   "errors"
+   "fmt"
+   "net/http"
+   "net/url"
+   "os"
+   "strconv"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/utils"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// file where every action on a run is recorded, changed with MESA_AUDIT_LOG
+var auditLogName = "audit.log"
+
+
+// a line of the audit log
+type AuditEntry struct {
+   Time time.Time `json:"time"`
+   User string `json:"user"`
+   Remote string `json:"remote"`
+   RunID string `json:"run_id"`
+   RootDir string `json:"root_dir"`
+   Pid int `json:"pid"`
+   Action string `json:"action"`
+   Result string `json:"result"`
+}
+
+
+var auditSync sync.Mutex
+
+
+// append an entry to the audit log, as a JSON line
+func audit (entry AuditEntry) {
+
+   name := auditLogName
+   if env := os.Getenv("MESA_AUDIT_LOG"); env != "" {
+      name = env
+   }
+
+   io.LogInfo("WEB - control.go - audit", fmt.Sprintf("%s asked to %s run %s (PID %d): %s", entry.User, entry.Action, entry.RunID, entry.Pid, entry.Result))
+
+   raw, err := json.Marshal(entry)
+   if err != nil {
+      io.LogError("WEB - control.go - audit", "problem encoding audit entry: " + err.Error())
+      return
+   }
+
+   auditSync.Lock()
+   defer auditSync.Unlock()
+
+   f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+   if err != nil {
+      io.LogError("WEB - control.go - audit", "problem opening audit log: " + err.Error())
+      return
+   }
+   defer f.Close()
+
+   if _, err := f.Write(append(raw, '\n')); err != nil {
+      io.LogError("WEB - control.go - audit", "problem writing audit log: " + err.Error())
+   }
+
+}
+
+
+// whether a request changing things comes from a page of this same server. browsers send basic
+// auth credentials along with forms posted from anywhere, so Origin (or Referer) is checked;
+// requests without both are not from a browser form
+func sameOrigin (request *http.Request) bool {
+
+   for _, header := range []string{"Origin", "Referer"} {
+      if raw := request.Header.Get(header); raw != "" {
+         u, err := url.Parse(raw)
+         return err == nil && u.Host == request.Host
+      }
+   }
+
+   return true
+
+}
+
+
+// whether a request may act on runs: only with credentials set & from pages of this server
+func actionAllowed (request *http.Request) (int, string) {
+
+   if os.Getenv("SERVER_AUTH_USERNAME") == "" || os.Getenv("SERVER_AUTH_PASSWORD") == "" {
+      return http.StatusForbidden, "actions on runs need SERVER_AUTH_USERNAME and SERVER_AUTH_PASSWORD to be set"
+   }
+   if !sameOrigin(request) {
+      return http.StatusForbidden, "request does not come from this server"
+   }
+
+   return http.StatusOK, ""
+
+}
+
+
+// send the signal of an action to the process of a running run. the PID must be sent back as
+// confirmation, so that a process is only signalled if it is the one the user saw. returns the
+// HTTP status & a message telling what happened
+func controlRun (request *http.Request, id string) (int, string) {
+
+   action := request.FormValue("action")
+   user, _, _ := request.BasicAuth()
+   entry := AuditEntry{Time: time.Now(), User: user, Remote: request.RemoteAddr, RunID: id, Action: action}
+
+   status, result := func() (int, string) {
+
+      if status, result := actionAllowed(request); status != http.StatusOK {
+         return status, result
+      }
+      if _, ok := utils.ProcessActions[action]; !ok {
+         return http.StatusBadRequest, fmt.Sprintf("unknown action %q", action)
+      }
+
+      run := findRun(id)
+      if run == nil {
+         return http.StatusNotFound, "unknown run " + id
+      }
+      entry.RootDir = run.RootDir
+      entry.Pid = run.ProcId
+      if !run.Running {
+         return http.StatusConflict, "run is not running"
+      }
+      if request.FormValue("confirm") != strconv.Itoa(run.ProcId) {
+         return http.StatusBadRequest, fmt.Sprintf("confirm the action sending the PID of the run (%d) as confirm", run.ProcId)
+      }
+
+      sig, err := utils.SignalProcess(run.ProcId, action)
+      if err != nil {
+         if errors.Is(err, utils.ErrNotOwner) || errors.Is(err, utils.ErrOtherProcfs) {
+            return http.StatusForbidden, err.Error()
+         }
+         return http.StatusInternalServerError, err.Error()
+      }
+
+      return http.StatusOK, fmt.Sprintf("%s: sent signal %d (%s) to PID %d", action, int(sig), sig, run.ProcId)
+
+   }()
+
+   entry.Result = result
+   audit(entry)
+
+   return status, result
+
+}
+
+
+// action on a run: POST /api/runs/:id/control with action (pause, resume, terminate or kill) and
+// confirm (PID of the run)
+func RunControlAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   status, result := controlRun(request, params.ByName("id"))
+   if status != http.StatusOK {
+      writeJSON(writer, status, map[string]string{"error": result})
+      return
+   }
+
+   writeJSON(writer, status, map[string]string{"result": result})
+
+}
+
+
+// action on a run from the runs page, which is shown again with the result
+func RunControlHTML (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   _, result := controlRun(request, params.ByName("id"))
+
+   http.Redirect(writer, request, "/runs?msg=" + url.QueryEscape(result), http.StatusSeeOther)
+
+}
@@ -0,0 +1,400 @@
+package web
+
+import (
+   "html/template"
+   "net/http"
+   "os"
+   "sort"
+   "strings"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/plot"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// status of a run in the grid
+const (
+   gridRunning = "running"
+   gridQueued = "queued"
+   gridStopped = "stopped"
+   gridFinished = "finished"
+)
+
+
+// a run of a parameter grid, with its initial parameters & where it got to
+type GridRow struct {
+   Run
+   Status string
+   IsBinary bool
+   InitialDonorMass float64
+   InitialAccretorMass float64
+   InitialPeriod float64
+   Age float64
+   ModelNumber int
+   Star1Stage mesa.EvolStage
+   Star2Stage mesa.EvolStage
+   MT mesa.MTState
+   Outcome string
+}
+
+
+// info on grid.html
+type GridPageData struct {
+   Roots []string
+   Rows []GridRow
+   Outcomes []string
+   Sort string
+   Desc bool
+   Query string
+   MapQuery template.URL
+}
+
+
+// summaries of runs not running, kept as long as discovered runs. running ones are always loaded
+// again as they keep changing
+var (
+   gridSync sync.Mutex
+   gridCache = make(map[string]gridEntry)
+)
+
+type gridEntry struct {
+   row GridRow
+   at time.Time
+}
+
+
+// colors of outcomes in the grid map. outcomes not found here take one from the default palette
+var outcomeColors = map[string]string{
+   "common envelope": "#d62728",
+   "contact": "#ff7f0e",
+   "double compact object": "#000000",
+   "disrupted": "#7f7f7f",
+   "mass transfer": "#1f77b4",
+   "detached": "#2ca02c",
+}
+
+
+// summary of a run as shown in the grid, only reading the last rows of its histories
+func gridRow (run Run) GridRow {
+
+   gridSync.Lock()
+   entry, ok := gridCache[run.RootDir]
+   gridSync.Unlock()
+   // rows of runs that were running when cached are stale once they stop
+   if ok && !run.Running && !entry.row.Running && time.Since(entry.at) < runsDiscoveryTTL {
+      return entry.row
+   }
+
+   row := GridRow{Run: run}
+
+   mesaInfo := &mesa.MESAInfo{ProcId: run.ProcId, RootDir: run.RootDir}
+   loadMESASummary(mesaInfo)
+
+   row.IsBinary = mesaInfo.IsBinaryEvolution
+   row.Star1Stage = mesaInfo.Star1Info.EvolStage
+   row.Star2Stage = mesaInfo.Star2Info.EvolStage
+   row.Age = mesaInfo.Star1Info.Age
+   row.ModelNumber = mesaInfo.Star1Info.ModelNumber
+
+   if mesaInfo.IsBinaryEvolution {
+      bInfo := mesaInfo.BinaryInfo
+      row.MT = bInfo.MT
+      row.Age = bInfo.Age
+      row.ModelNumber = bInfo.ModelNumber
+
+      // bin2dco runs keep initial parameters in their first stage
+      initial := bInfo
+      if mesaInfo.IsBin2dco {
+         b, err := mesaInfo.LoadInitialBinaryData()
+         if err != nil {
+            io.LogError("WEB - grid.go - gridRow", "problem loading initial binary of " + run.RootDir + ": " + err.Error())
+         }
+         if b != nil {
+            initial = b
+         }
+      }
+      row.InitialDonorMass = initial.InitialDonorMass
+      row.InitialAccretorMass = initial.InitialAccretorMass
+      row.InitialPeriod = initial.InitialPeriod
+   } else {
+      row.InitialDonorMass = mesaInfo.Star1Info.Mass
+   }
+
+   row.Status = gridStatus(mesaInfo, row)
+   row.Outcome = gridOutcome(mesaInfo, row)
+
+   gridSync.Lock()
+   gridCache[run.RootDir] = gridEntry{row: row, at: time.Now()}
+   gridSync.Unlock()
+
+   return row
+
+}
+
+
+// status of a run: running, queued if it has not written any history yet, finished once its stars
+// cannot evolve any further and stopped otherwise
+func gridStatus (mesaInfo *mesa.MESAInfo, row GridRow) string {
+
+   if row.Running {
+      return gridRunning
+   }
+
+   if _, err := os.Stat(mesaInfo.Star1Filename); err != nil {
+      return gridQueued
+   }
+
+   ended := func(stage mesa.EvolStage) bool {
+      return stage.IsCompact() || stage == mesa.StageCoreCollapse
+   }
+   if ended(row.Star1Stage) && (!row.IsBinary || ended(row.Star2Stage)) {
+      return gridFinished
+   }
+   if row.MT.CommonEnvelope {
+      return gridFinished
+   }
+
+   return gridStopped
+
+}
+
+
+// what a run ended up as, used to color the grid map
+func gridOutcome (mesaInfo *mesa.MESAInfo, row GridRow) string {
+
+   if row.Status == gridQueued {
+      return gridQueued
+   }
+
+   if !row.IsBinary {
+      return row.Star1Stage.String()
+   }
+
+   if mesaInfo.Bin2dco != nil {
+      for _, cc := range mesaInfo.Bin2dco.CoreCollapses {
+         if cc.Disrupted {
+            return "disrupted"
+         }
+      }
+   }
+
+   switch {
+   case row.MT.CommonEnvelope:
+      return "common envelope"
+   case row.MT.Contact:
+      return "contact"
+   case row.Star1Stage.IsCompact() && row.Star2Stage.IsCompact():
+      return "double compact object"
+   case row.MT.Case != mesa.MTNone:
+      return "mass transfer"
+   }
+
+   return "detached"
+
+}
+
+
+// rows of all known runs, filtered & sorted as asked for in the query string:
+//   q: text found in directory, status, stages, MT case or outcome
+//   status, outcome: exact match
+//   sort: column name (dir, status, mdon, macc, period, age, model, star1, star2, mt, outcome)
+//   desc: reverse order
+func gridRows (request *http.Request) []GridRow {
+
+   query := request.URL.Query()
+   text := strings.ToLower(query.Get("q"))
+   status := query.Get("status")
+   outcome := query.Get("outcome")
+
+   rows := []GridRow{}
+   for _, run := range listRuns() {
+      row := gridRow(run)
+      if status != "" && row.Status != status {
+         continue
+      }
+      if outcome != "" && row.Outcome != outcome {
+         continue
+      }
+      if text != "" {
+         haystack := strings.ToLower(strings.Join([]string{row.RootDir, row.Status, row.Star1Stage.String(), row.Star2Stage.String(), row.MT.String(), row.Outcome}, " "))
+         if !strings.Contains(haystack, text) {
+            continue
+         }
+      }
+      rows = append(rows, row)
+   }
+
+   less := gridSortKey(query.Get("sort"))
+   desc := query.Get("desc") != ""
+   sort.SliceStable(rows, func(i, j int) bool {
+      if desc {
+         return less(rows[j], rows[i])
+      }
+      return less(rows[i], rows[j])
+   })
+
+   return rows
+
+}
+
+
+// ordering of grid rows by a column, by directory if unknown
+func gridSortKey (column string) func(a, b GridRow) bool {
+
+   switch column {
+   case "status":
+      return func(a, b GridRow) bool { return a.Status < b.Status }
+   case "mdon":
+      return func(a, b GridRow) bool { return a.InitialDonorMass < b.InitialDonorMass }
+   case "macc":
+      return func(a, b GridRow) bool { return a.InitialAccretorMass < b.InitialAccretorMass }
+   case "period":
+      return func(a, b GridRow) bool { return a.InitialPeriod < b.InitialPeriod }
+   case "age":
+      return func(a, b GridRow) bool { return a.Age < b.Age }
+   case "model":
+      return func(a, b GridRow) bool { return a.ModelNumber < b.ModelNumber }
+   case "star1":
+      return func(a, b GridRow) bool { return a.Star1Stage < b.Star1Stage }
+   case "star2":
+      return func(a, b GridRow) bool { return a.Star2Stage < b.Star2Stage }
+   case "mt":
+      return func(a, b GridRow) bool { return a.MT.Case < b.MT.Case }
+   case "outcome":
+      return func(a, b GridRow) bool { return a.Outcome < b.Outcome }
+   }
+
+   return func(a, b GridRow) bool { return a.RootDir < b.RootDir }
+
+}
+
+
+// outcomes found in rows, sorted
+func gridOutcomes (rows []GridRow) []string {
+
+   seen := make(map[string]bool)
+   var outcomes []string
+   for _, row := range rows {
+      if !seen[row.Outcome] {
+         seen[row.Outcome] = true
+         outcomes = append(outcomes, row.Outcome)
+      }
+   }
+   sort.Strings(outcomes)
+
+   return outcomes
+
+}
+
+
+// map of initial period vs initial donor mass, one series per outcome. the "y" query parameter
+// changes the mass plotted: donor (default), accretor or q (accretor over donor)
+func gridMap (rows []GridRow, y string) *plot.Plot {
+
+   p := &plot.Plot{Title: "parameter grid", XLabel: "initial period [days]", YLabel: "initial donor mass [Msun]", LogX: true}
+   switch y {
+   case "accretor":
+      p.YLabel = "initial accretor mass [Msun]"
+   case "q":
+      p.YLabel = "initial mass ratio (accretor / donor)"
+   }
+
+   series := make(map[string]*plot.Series)
+   for _, outcome := range gridOutcomes(rows) {
+      series[outcome] = &plot.Series{Label: outcome, Color: outcomeColors[outcome], Markers: true}
+   }
+
+   for _, row := range rows {
+      if !row.IsBinary {
+         continue
+      }
+      value := row.InitialDonorMass
+      switch y {
+      case "accretor":
+         value = row.InitialAccretorMass
+      case "q":
+         value = 0
+         if row.InitialDonorMass > 0 {
+            value = row.InitialAccretorMass / row.InitialDonorMass
+         }
+      }
+      s := series[row.Outcome]
+      s.X = append(s.X, row.InitialPeriod)
+      s.Y = append(s.Y, value)
+   }
+
+   for _, outcome := range gridOutcomes(rows) {
+      if s := series[outcome]; len(s.X) > 0 {
+         p.Series = append(p.Series, *s)
+      }
+   }
+
+   return p
+
+}
+
+
+// grid of runs: GET /api/grid
+func GridAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   writeJSON(writer, http.StatusOK, gridRows(request))
+
+}
+
+
+// grid map as SVG: GET /grid/map.svg
+func GridMapSVG (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   timer := time.Now()
+
+   p := gridMap(gridRows(request), request.URL.Query().Get("y"))
+
+   writer.Header().Set("Content-Type", "image/svg+xml")
+   if err := p.WriteSVG(writer); err != nil {
+      io.LogError("WEB - grid.go - GridMapSVG", "problem writing grid map: " + err.Error())
+      return
+   }
+   io.LogInfo("WEB - grid.go - GridMapSVG", "grid map sent in "+time.Since(timer).String())
+
+}
+
+
+// grid.html serving func
+func GridHTML (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   // start counting time until serve files
+   timer := time.Now()
+
+   query := request.URL.Query()
+   rows := gridRows(request)
+
+   data := GridPageData{
+      Roots: runsRoots(),
+      Rows: rows,
+      Outcomes: gridOutcomes(rows),
+      Sort: query.Get("sort"),
+      Desc: query.Get("desc") != "",
+      Query: query.Get("q"),
+      MapQuery: template.URL(query.Encode()),
+   }
+
+   tmpl := template.Must(template.New("grid.html").Funcs(template.FuncMap{
+      "sortLink": func(column string) template.URL {
+         q := request.URL.Query()
+         q.Set("sort", column)
+         q.Del("desc")
+         if data.Sort == column && !data.Desc {
+            q.Set("desc", "1")
+         }
+         return template.URL("?" + q.Encode())
+      },
+   }).ParseFiles("web/html/grid.html"))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - grid.go - GridHTML", "page sent in "+time.Since(timer).String())
+
+}
@@ -3,12 +3,14 @@ package web
 import (
 	"crypto/sha256"
 	"crypto/subtle"
-	// "fmt"
+	"fmt"
 	"html/template"
 	"net/http"
 	"os"
 	"os/user"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"web-service/pkg/io"
@@ -109,17 +111,17 @@ func BasicAuth(h httprouter.Handle) httprouter.Handle {
       username, password, hasAuth := request.BasicAuth()
 
       io.LogDebug("WEB - html.go - BasicAuth", "username: " + username)
-      io.LogDebug("WEB - html.go - BasicAuth", "password: " + password)
 
-      username = os.Getenv("SERVER_AUTH_USERNAME")
-      password = os.Getenv("SERVER_AUTH_PASSWORD")
+      expectedUsername := os.Getenv("SERVER_AUTH_USERNAME")
+      expectedPassword := os.Getenv("SERVER_AUTH_PASSWORD")
 
       if hasAuth {
 
+         // compare credentials sent against the expected ones
          usernameHash := sha256.Sum256([]byte(username))
          passwordHash := sha256.Sum256([]byte(password))
-         expectedUsernameHash := sha256.Sum256([]byte(username))
-         expectedPasswordHash := sha256.Sum256([]byte(password))
+         expectedUsernameHash := sha256.Sum256([]byte(expectedUsername))
+         expectedPasswordHash := sha256.Sum256([]byte(expectedPassword))
 
          usernameMatch := (subtle.ConstantTimeCompare(usernameHash[:], expectedUsernameHash[:]) == 1)
          passwordMatch := (subtle.ConstantTimeCompare(passwordHash[:], expectedPasswordHash[:]) == 1)
@@ -182,104 +184,258 @@ func Favicon (writer http.ResponseWriter, request *http.Request, _ httprouter.Pa
 }
 
 
+// templates making up mesa.html. sections are in their own files so mesa.html can place them with
+// {{template "plots" .}}, {{template "timeline" .}}, {{template "bin2dco" .}} and {{template "photos" .}}
+var mesaTemplates = []string{
+   "web/html/mesa.html",
+   "web/html/plots.html",
+   "web/html/timeline.html",
+   "web/html/bin2dco.html",
+   "web/html/photos.html",
+}
+
+
 // mesa.html serving func
 func MESAhtml (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
 
    // start counting time until serve files
    timer := time.Now()
 
-   // set struct which has tha ability to find the process running a MESA executable
-   mesaProc := new(utils.MESAprocess)
-   mesaProc.WalkProc()
-   
-   // get abs path where run is being done, in case there is no simulation, this is simply and
-   // string
-   if mesaProc.Id > 0 {
-      mesaProc.GetAbsPath()
+   mesaInfo := runFromRequest(request)
+
+   data := &MESAPageData{MESAInfo: mesaInfo}
+   if mesaInfo.RootDir != "" {
+      data.RunID = runID(mesaInfo.RootDir)
+      data.Plots = runPlotLinks(mesaInfo)
+      data.Job = batchScheduler().JobFor(mesaInfo.RootDir, mesaInfo.ProcId)
+      data.Launch = runLauncher().LastIn(mesaInfo.RootDir)
+      data.Photos = runPhotos(mesaInfo)
+      data.Message = request.URL.Query().Get("msg")
    }
 
-   // set struct with MESA info, which will later be connected to html file via Templates
-   mesaInfo := new(mesa.MESAInfo)
-   bInfo := new(mesa.MESAbinaryInfo)
-   star1Info := new(mesa.MESAstarInfo)
-   star2Info := new(mesa.MESAstarInfo)
+   // server html, with its sections in their own templates
+   tmpl := template.Must(template.ParseFiles(mesaTemplates...))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - html.go - MESAhtml", "page sent in "+time.Since(timer).String())
+
+}
+
+
+// thresholds used to classify stages & MT, nil for the defaults
+var thresholds *mesa.Thresholds
+
+
+// read thresholds of stage & MT classification from the JSON file in MESA_THRESHOLDS, if set
+func initThresholds () {
+
+   filename := strings.TrimSpace(os.Getenv("MESA_THRESHOLDS"))
+   if filename == "" {
+      return
+   }
+
+   t, err := mesa.LoadThresholds(filename)
+   if err != nil {
+      io.LogError("WEB - html.go - initThresholds", "problem reading thresholds, using defaults: " + err.Error())
+      return
+   }
+   thresholds = t
+   io.LogInfo("WEB - html.go - initThresholds", "thresholds read from " + filename)
+
+}
 
-   // set some defaults
-   mesaInfo.ProcId = mesaProc.Id
-   mesaInfo.RootDir = mesaProc.Loc
 
-   // load all the info on the binary run
-   if mesaProc.Id > 0 {
+// find the MESA run being done in this computer and load all its info
+func currentMESARun () *mesa.MESAInfo {
 
-      err := mesaInfo.LoadMESAData()
+   live := findLiveRun()
 
-      // if problems while loading stuff, just set the ProcId to a reserve value so that the html
-      // will warn about it
+   // this is to get the correct message in the html page
+   if live == nil {
+      return &mesa.MESAInfo{ProcId: -99}
+   }
+
+   return loadRun(live)
+
+}
+
+
+// load summary of binary & stars of a MESA run located in mesaInfo.RootDir, together with the
+// timeline of its whole binary history
+func loadMESAInfo (mesaInfo *mesa.MESAInfo) {
+
+   loadMESASummary(mesaInfo)
+
+   bInfo := mesaInfo.BinaryInfo
+
+   // also. after having info on (possibly) both stars, check for a MT phase. the whole history is
+   // needed to know about previous MT episodes. a timeline that could not be read to the end does not
+   // know the current MT phase, the one from the last rows is kept then
+   if mesaInfo.IsBinaryEvolution {
+      var err error
+      mesaInfo.Timeline, err = runTimeline(mesaInfo)
       if err != nil {
-         io.LogError("WEB - html.go - MESAhtml", "problem loading MESA data")
-         mesaInfo.ProcId = -98
+         io.LogError("WEB - html.go - loadMESAInfo", "problem building binary timeline: " + err.Error())
       }
+      if err == nil && mesaInfo.Timeline != nil {
+         bInfo.MT = mesaInfo.Timeline.FinalMT
+         bInfo.MTCase = bInfo.MT.String()
+      }
+   }
 
-      // some defaults for MESAbinary search
-      bInfo.HistoryName = mesaInfo.BinaryFilename
-      bInfo.MTCase = "none"
+}
+
+
+// timelines built, by binary history, with the stamp of the histories they were built from
+var (
+   timelineSync sync.Mutex
+   timelineCache = make(map[string]timelineEntry)
+)
+
+type timelineEntry struct {
+   stamp string
+   timeline *mesa.Timeline
+}
 
-      // load MESAbinary info
+
+// size & modification time of files, changing whenever MESA appends to them
+func filesStamp (names ...string) string {
+
+   var stamp strings.Builder
+   for _, name := range names {
+      if info, err := os.Stat(name); name != "" && err == nil {
+         fmt.Fprintf(&stamp, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+      } else {
+         fmt.Fprintf(&stamp, "%s;", name)
+      }
+   }
+
+   return stamp.String()
+
+}
+
+
+// timeline of a binary run, only built again when any of its histories changed. timelines with
+// errors are not kept, so that they are tried again
+func runTimeline (mesaInfo *mesa.MESAInfo) (*mesa.Timeline, error) {
+
+   stamp := filesStamp(mesaInfo.BinaryFilename, mesaInfo.Star1Filename, mesaInfo.Star2Filename)
+
+   timelineSync.Lock()
+   entry, ok := timelineCache[mesaInfo.BinaryFilename]
+   timelineSync.Unlock()
+   if ok && entry.stamp == stamp {
+      return entry.timeline, nil
+   }
+
+   timeline, err := mesa.BuildTimeline(mesaInfo.BinaryFilename, mesaInfo.Star1Filename, mesaInfo.Star2Filename, thresholds, historyCache)
+   if err != nil {
+      return timeline, err
+   }
+
+   timelineSync.Lock()
+   timelineCache[mesaInfo.BinaryFilename] = timelineEntry{stamp: stamp, timeline: timeline}
+   timelineSync.Unlock()
+
+   return timeline, nil
+
+}
+
+
+// load summary of binary & stars of a MESA run located in mesaInfo.RootDir, only looking at the
+// last rows of histories. MT phase is defined without knowing about previous MT episodes
+func loadMESASummary (mesaInfo *mesa.MESAInfo) {
+
+   bInfo := new(mesa.MESAbinaryInfo)
+   star1Info := new(mesa.MESAstarInfo)
+   star2Info := new(mesa.MESAstarInfo)
+
+   mesaInfo.Thresholds = thresholds
+   err := mesaInfo.LoadMESAData()
+
+   // if problems while loading stuff, just set the ProcId to a reserve value so that the html
+   // will warn about it
+   if err != nil {
+      io.LogError("WEB - html.go - loadMESASummary", "problem loading MESA data")
+      mesaInfo.ProcId = -98
+   }
+
+   // some defaults for MESAbinary search
+   bInfo.HistoryName = mesaInfo.BinaryFilename
+   bInfo.MTCase = "none"
+
+   // load MESAbinary info, only available for binary evolutions
+   if mesaInfo.IsBinaryEvolution {
       err = bInfo.LoadMESAbinaryData()
 
       // again, if problems were found, give some warning in the html
       if err != nil {
-         io.LogError("WEB - html.go - MESAhtml", "problem loading MESAbinary data")
+         io.LogError("WEB - html.go - loadMESASummary", "problem loading MESAbinary data")
          mesaInfo.ProcId = -97
       }
+   }
 
-      // star1 defaults
-      star1Info.HistoryName = mesaInfo.Star1Filename
+   // star1 defaults
+   star1Info.HistoryName = mesaInfo.Star1Filename
+   star1Info.Thresholds = thresholds.ForStage()
 
-      // load MESAstar data for star1
-      err = star1Info.LoadMESAstarData()
-      if err != nil {
-         io.LogError("WEB - html.go - MESAhtml", "problem loading MESAstar data for star 1")
-         mesaInfo.ProcId = -96
-      }
+   // load MESAstar data for star1
+   err = star1Info.LoadMESAstarData()
+   if err != nil {
+      io.LogError("WEB - html.go - loadMESASummary", "problem loading MESAstar data for star 1")
+      mesaInfo.ProcId = -96
+   }
 
-      // by default, Have2Stars is false. change accordingly to the value of point_mass_index column
-      if bInfo.PointMassIndex == 0 {
-         mesaInfo.Have2Stars = true
-      }
+   // by default, Have2Stars is false. change accordingly to the value of point_mass_index column
+   if bInfo.PointMassIndex == 0 {
+      mesaInfo.Have2Stars = true
+   }
 
-      // star2 defaults
-      star2Info.HistoryName = mesaInfo.Star2Filename
+   // star2 defaults
+   star2Info.HistoryName = mesaInfo.Star2Filename
+   star2Info.Thresholds = thresholds.ForStage()
 
-      // load MESAstar data for star2
+   // load MESAstar data for star2, if its LOG file was found
+   if star2Info.HistoryName != "" {
       err = star2Info.LoadMESAstarData()
       if err != nil {
-         io.LogError("WEB - html.go - MESAhtml", "problem loading MESAstar data for star 2")
+         io.LogError("WEB - html.go - loadMESASummary", "problem loading MESAstar data for star 2")
          mesaInfo.ProcId = -95
       }
+   }
 
-      // also. after having info on (possibly) both stars, check for a MT phase
-      if bInfo.DonorIndex == 1 {
-         bInfo.MTCase = mesa.SetMTCase(bInfo.RelRLOF1, star1Info.EvolState)
-      } else {
-         bInfo.MTCase = mesa.SetMTCase(bInfo.RelRLOF2, star2Info.EvolState)
-      }
-
-      // finally, store useful information inside the MESAInfo struct
-      mesaInfo.BinaryInfo = bInfo
-      mesaInfo.Star1Info  = star1Info
-      mesaInfo.Star2Info  = star2Info
-
-   } else {
+   // a point mass is a compact object, tell which one it is
+   if bInfo.PointMassIndex == 1 {
+      star1Info.Mass = bInfo.Star1Mass
+      star1Info.EvolStage, star1Info.EvolReason = mesa.ClassifyPointMass(bInfo.Star1Mass, thresholds.ForStage())
+      star1Info.EvolState = star1Info.EvolStage.String()
+   }
+   if bInfo.PointMassIndex == 2 {
+      star2Info.Mass = bInfo.Star2Mass
+      star2Info.EvolStage, star2Info.EvolReason = mesa.ClassifyPointMass(bInfo.Star2Mass, thresholds.ForStage())
+      star2Info.EvolState = star2Info.EvolStage.String()
+   }
 
-      // this is to get the correct message in the html page
-      mesaInfo.ProcId = -99
+   // merger time & chirp mass only make sense for a pair of compact objects. bin2dco runs end at the
+   // last core collapse, so the pair is the one left after it
+   if mesaInfo.IsBin2dco && mesaInfo.Bin2dco != nil {
+      if dco := mesaInfo.Bin2dco.CompactBinary(); dco != nil {
+         bInfo.IsCompactBinary = true
+         bInfo.MergerTime = dco.MergerTime
+         bInfo.ChirpMass = dco.ChirpMass
+      }
+   } else if mesaInfo.IsBinaryEvolution && star1Info.EvolStage.IsCompact() && star2Info.EvolStage.IsCompact() {
+      bInfo.SetCompactQuantities()
+   }
 
+   // also. after having info on (possibly) both stars, check for a MT phase
+   if mesaInfo.IsBinaryEvolution {
+      bInfo.MT = mesa.ClassifyMT(bInfo.MTInput(), star1Info.EvolStage, star2Info.EvolStage, thresholds.ForMT())
+      bInfo.MTCase = bInfo.MT.String()
    }
 
-   // server html
-   tmpl := template.Must(template.ParseFiles("web/html/mesa.html"))
-   _ = tmpl.Execute(writer, mesaInfo)
-   io.LogInfo("WEB - html.go - MESAhtml", "page sent in "+time.Since(timer).String())
+   // finally, store useful information inside the MESAInfo struct
+   mesaInfo.BinaryInfo = bInfo
+   mesaInfo.Star1Info  = star1Info
+   mesaInfo.Star2Info  = star2Info
 
 }
@@ -0,0 +1,132 @@
+package web
+
+import (
+   "fmt"
+   "html/template"
+   "net/http"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// controls differing between runs, for the API & inlistdiff.html
+type InlistDiffData struct {
+   Runs []Run
+   Diffs []mesa.InlistDiff
+   Groups []InlistDiffGroup
+   All bool
+   Columns int
+}
+
+
+// differences of a namelist, as shown in inlistdiff.html
+type InlistDiffGroup struct {
+   Title string
+   Diffs []mesa.InlistDiff
+}
+
+
+// inlists of the runs asked for in the "run" query parameters (at least two of them). all=1 also
+// returns controls set equally in every run
+func diffRunInlists (request *http.Request) (*InlistDiffData, int, error) {
+
+   query := request.URL.Query()
+   ids := query["run"]
+   if len(ids) < 2 {
+      return nil, http.StatusBadRequest, fmt.Errorf("select at least two runs to compare")
+   }
+
+   data := &InlistDiffData{All: query.Get("all") != ""}
+
+   var inlists []*mesa.Inlist
+   for _, id := range ids {
+      run := findRun(id)
+      if run == nil {
+         return nil, http.StatusNotFound, fmt.Errorf("unknown run %s", id)
+      }
+      in, err := mesa.LoadInlist(run.RootDir)
+      if err != nil {
+         return nil, http.StatusUnprocessableEntity, fmt.Errorf("problem reading inlists of run %s: %w", id, err)
+      }
+      data.Runs = append(data.Runs, *run)
+      inlists = append(inlists, in)
+   }
+
+   data.Columns = len(data.Runs) + 1
+   data.Diffs = mesa.DiffInlists(inlists, data.All)
+   if data.Diffs == nil {
+      data.Diffs = []mesa.InlistDiff{}
+   }
+
+   // diffs come sorted by namelist, split them where it changes
+   for _, diff := range data.Diffs {
+      nl := mesa.Namelist{Name: diff.Namelist, Star: diff.Star}
+      if n := len(data.Groups); n == 0 || data.Groups[n-1].Title != nl.Title() {
+         data.Groups = append(data.Groups, InlistDiffGroup{Title: nl.Title()})
+      }
+      data.Groups[len(data.Groups)-1].Diffs = append(data.Groups[len(data.Groups)-1].Diffs, diff)
+   }
+
+   return data, http.StatusOK, nil
+
+}
+
+
+// effective controls of a run, by namelist: GET /api/runs/:id/inlist
+func InlistAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   run := findRun(params.ByName("id"))
+   if run == nil {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "unknown run " + params.ByName("id")})
+      return
+   }
+
+   in, err := mesa.LoadInlist(run.RootDir)
+   if err != nil {
+      writeJSONError(writer, http.StatusUnprocessableEntity, err)
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, in)
+
+}
+
+
+// controls differing between runs: GET /api/inlists/diff?run=<id>&run=<id>...
+func InlistDiffAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   data, status, err := diffRunInlists(request)
+   if err != nil {
+      writeJSONError(writer, status, err)
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, struct {
+      Runs []Run
+      Diffs []mesa.InlistDiff
+   }{data.Runs, data.Diffs})
+
+}
+
+
+// inlistdiff.html serving func
+func InlistDiffHTML (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   // start counting time until serve files
+   timer := time.Now()
+
+   data, status, err := diffRunInlists(request)
+   if err != nil {
+      http.Error(writer, err.Error(), status)
+      return
+   }
+
+   tmpl := template.Must(template.ParseFiles("web/html/inlistdiff.html"))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - inlist.go - InlistDiffHTML", "page sent in "+time.Since(timer).String())
+
+}
@@ -0,0 +1,174 @@
+package web
+
+import (
+   "errors"
+   "fmt"
+   "net/http"
+   "net/url"
+   "strconv"
+   "strings"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/utils"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// launcher of runs started from the service, created on first use
+var (
+   launcherOnce sync.Once
+   launcher *utils.Launcher
+)
+
+
+func runLauncher () *utils.Launcher {
+
+   launcherOnce.Do(func() {
+      launcher = utils.NewLauncher()
+      io.LogInfo("WEB - launch.go - runLauncher", fmt.Sprintf("launching runs on %d cores, %d threads each by default", launcher.Cores, launcher.DefaultThreads))
+   })
+
+   return launcher
+
+}
+
+
+// launch a run with ./rn, or restart it with ./re when a photo is sent. threads sets OMP_NUM_THREADS.
+// returns the HTTP status, a message telling what happened & the run launched
+func launchRun (request *http.Request, id string) (int, string, *utils.ManagedRun) {
+
+   photo := request.FormValue("photo")
+   user, _, _ := request.BasicAuth()
+   entry := AuditEntry{Time: time.Now(), User: user, Remote: request.RemoteAddr, RunID: id, Action: "launch"}
+   if photo != "" {
+      entry.Action = "restart"
+   }
+
+   var launched *utils.ManagedRun
+   status, result := func() (int, string) {
+
+      if status, result := actionAllowed(request); status != http.StatusOK {
+         return status, result
+      }
+
+      threads := 0
+      if raw := request.FormValue("threads"); raw != "" {
+         n, err := strconv.Atoi(raw)
+         if err != nil || n <= 0 {
+            return http.StatusBadRequest, fmt.Sprintf("bad number of threads %q", raw)
+         }
+         threads = n
+      }
+
+      run := findRun(id)
+      if run == nil {
+         return http.StatusNotFound, "unknown run " + id
+      }
+      entry.RootDir = run.RootDir
+      if run.Running {
+         return http.StatusConflict, fmt.Sprintf("run is already running (PID %d)", run.ProcId)
+      }
+
+      r, err := runLauncher().Submit(utils.LaunchRequest{Dir: run.RootDir, Photo: photo, Threads: threads})
+      switch {
+      case errors.Is(err, utils.ErrAlreadyLaunched):
+         return http.StatusConflict, err.Error()
+      case errors.Is(err, utils.ErrNoScript), errors.Is(err, utils.ErrBadPhoto):
+         return http.StatusBadRequest, err.Error()
+      case err != nil:
+         return http.StatusInternalServerError, err.Error()
+      }
+      launched = &r
+      entry.Pid = r.Pid
+
+      command := strings.Join(r.Command, " ")
+      switch r.State {
+      case utils.LaunchQueued:
+         return http.StatusAccepted, fmt.Sprintf("%s queued with %d threads, waiting for free cores", command, r.Threads)
+      case utils.LaunchFailed:
+         return http.StatusInternalServerError, fmt.Sprintf("%s failed to start: %s", command, r.Error)
+      }
+
+      return http.StatusOK, fmt.Sprintf("%s started with %d threads (PID %d), output in %s", command, r.Threads, r.Pid, r.LogFile)
+
+   }()
+
+   entry.Result = result
+   audit(entry)
+
+   return status, result, launched
+
+}
+
+
+// launch a run: POST /api/runs/:id/launch with optional threads & photo (to restart from it)
+func RunLaunchAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   status, result, launched := launchRun(request, params.ByName("id"))
+   if launched == nil {
+      writeJSON(writer, status, map[string]string{"error": result})
+      return
+   }
+
+   writeJSON(writer, status, launched)
+
+}
+
+
+// launch a run from the runs page, which is shown again with the result. restarts from the photos
+// of the run page send back=run to go back to it
+func RunLaunchHTML (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   _, result, _ := launchRun(request, params.ByName("id"))
+
+   if request.FormValue("back") == "run" {
+      http.Redirect(writer, request, "/mesa?run=" + url.QueryEscape(params.ByName("id")) + "&msg=" + url.QueryEscape(result), http.StatusSeeOther)
+      return
+   }
+
+   http.Redirect(writer, request, "/runs?msg=" + url.QueryEscape(result), http.StatusSeeOther)
+
+}
+
+
+// runs launched by the service, queued ones included: GET /api/launches
+func LaunchesAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   writeJSON(writer, http.StatusOK, runLauncher().Runs())
+
+}
+
+
+// take a launched run out of the queue: POST /api/launches/:n/cancel
+func LaunchCancelAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   if status, result := actionAllowed(request); status != http.StatusOK {
+      writeJSON(writer, status, map[string]string{"error": result})
+      return
+   }
+
+   n, err := strconv.Atoi(params.ByName("n"))
+   if err != nil {
+      writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "bad launch number " + params.ByName("n")})
+      return
+   }
+
+   r, err := runLauncher().Cancel(n)
+   user, _, _ := request.BasicAuth()
+   entry := AuditEntry{Time: time.Now(), User: user, Remote: request.RemoteAddr, RunID: runID(r.Dir), RootDir: r.Dir, Action: "cancel", Result: "cancelled"}
+   if err != nil {
+      entry.Result = err.Error()
+   }
+   audit(entry)
+
+   if err != nil {
+      writeJSON(writer, http.StatusConflict, map[string]string{"error": err.Error()})
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, r)
+
+}
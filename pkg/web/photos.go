@@ -0,0 +1,101 @@
+package web
+
+import (
+   "math"
+   "net/http"
+   "sort"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// photos & saved models of a run, newest first. bin2dco runs also have those of each of their stages,
+// which ./re in the run directory cannot restart from
+func runPhotos (mesaInfo *mesa.MESAInfo) []mesa.Photo {
+
+   photos := dirPhotos(mesaInfo)
+
+   if mesaInfo.IsBin2dco && mesaInfo.Bin2dco != nil {
+      for _, stage := range mesaInfo.Bin2dco.Stages {
+         if stage.Dir == mesaInfo.RootDir {
+            continue
+         }
+         stageInfo := &mesa.MESAInfo{RootDir: stage.Dir}
+         if err := stageInfo.LoadMESAData(); err != nil {
+            io.LogError("WEB - photos.go - runPhotos", "problem loading stage " + stage.Name + ": " + err.Error())
+            continue
+         }
+         for _, photo := range dirPhotos(stageInfo) {
+            photo.Stage = stage.Name
+            photo.Restartable = false
+            photos = append(photos, photo)
+         }
+      }
+      sort.SliceStable(photos, func(i, j int) bool {
+         return photos[i].ModTime.After(photos[j].ModTime)
+      })
+   }
+
+   return photos
+
+}
+
+
+// photos & saved models in the root directory of a run, with model numbers of photos taken from its
+// binary history, or the one of star 1 for isolated stars
+func dirPhotos (mesaInfo *mesa.MESAInfo) []mesa.Photo {
+
+   history := mesaInfo.Star1Filename
+   if mesaInfo.IsBinaryEvolution {
+      history = mesaInfo.BinaryFilename
+   }
+
+   var models []int
+   if history != "" {
+      columns, err := readHistoryColumns(history, "model_number")
+      if err != nil {
+         io.LogError("WEB - photos.go - dirPhotos", "problem reading model numbers: " + err.Error())
+      }
+      for _, v := range columns["model_number"] {
+         if !math.IsNaN(v) {
+            models = append(models, int(v))
+         }
+      }
+   }
+
+   photos, err := mesa.ListPhotos(mesaInfo.RootDir, models)
+   if err != nil {
+      io.LogError("WEB - photos.go - dirPhotos", "problem listing photos: " + err.Error())
+   }
+
+   return photos
+
+}
+
+
+// photos & saved models of a run, newest first: GET /api/runs/:id/photos
+func PhotosAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   run := findRun(params.ByName("id"))
+   if run == nil {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "unknown run " + params.ByName("id")})
+      return
+   }
+
+   mesaInfo := &mesa.MESAInfo{ProcId: run.ProcId, RootDir: run.RootDir}
+   if err := mesaInfo.LoadMESAData(); err != nil {
+      writeJSONError(writer, http.StatusInternalServerError, err)
+      return
+   }
+
+   photos := runPhotos(mesaInfo)
+   if photos == nil {
+      photos = []mesa.Photo{}
+   }
+
+   writeJSON(writer, http.StatusOK, photos)
+
+}
@@ -0,0 +1,71 @@
+package web
+
+import (
+   "fmt"
+   "os"
+   "path/filepath"
+   "testing"
+   "time"
+
+   "web-service/pkg/mesa"
+)
+
+
+// photos of bin2dco runs are also found in the folders of their stages, with model numbers from the
+// history of each stage
+func TestRunPhotosBin2dco (t *testing.T) {
+
+   root := t.TempDir() + "/"
+   history := "1 2\nversion_number initial_don_mass\n\"r15140\" 10\n\n1 2\nmodel_number age\n%s"
+   files := map[string]string{
+      "cc_data/star_1.data": "star_index 1\nremnant_mass 1.5\n",
+      "stage1/binary_history.data": fmt.Sprintf(history, "1200 0\n1300 1\n"),
+      "stage1/photos/b_x300": "b",
+      "stage1/photos/1_x300": "1",
+      "stage2/binary_history.data": fmt.Sprintf(history, "1 0\n50 1\n"),
+      "stage2/photos/x050": "stage 2",
+      "photos/x100": "root",
+   }
+   for name, content := range files {
+      filename := filepath.Join(root, name)
+      if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+         t.Fatal(err)
+      }
+      if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+         t.Fatal(err)
+      }
+   }
+   // newest first: stage 2, then the run itself, then stage 1
+   for k, name := range []string{"stage1/photos/b_x300", "stage1/photos/1_x300", "photos/x100", "stage2/photos/x050"} {
+      at := time.Now().Add(time.Duration(k - 10) * time.Minute)
+      if err := os.Chtimes(filepath.Join(root, name), at, at); err != nil {
+         t.Fatal(err)
+      }
+   }
+
+   mesaInfo := &mesa.MESAInfo{RootDir: root}
+   if err := mesaInfo.LoadMESAData(); err != nil || !mesaInfo.IsBin2dco {
+      t.Fatalf("not a bin2dco run: %v", err)
+   }
+
+   photos := runPhotos(mesaInfo)
+   want := []struct {
+      stage, name string
+      model, files int
+      restartable bool
+   }{
+      {"stage2", "x050", 50, 1, false},
+      {"", "x100", -1, 1, true},
+      {"stage1", "x300", 1300, 2, false},
+   }
+   if len(photos) != len(want) {
+      t.Fatalf("got %d photos, want %d: %+v", len(photos), len(want), photos)
+   }
+   for k, w := range want {
+      p := photos[k]
+      if p.Stage != w.stage || p.Name != w.name || p.ModelNumber != w.model || len(p.Files) != w.files || p.Restartable != w.restartable {
+         t.Errorf("photo %d: got %+v, want %+v", k, p, w)
+      }
+   }
+
+}
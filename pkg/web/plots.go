@@ -0,0 +1,213 @@
+package web
+
+import (
+   "errors"
+   "net/http"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/plot"
+   "web-service/pkg/utils"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// a plot shown by default for a star or binary history
+type plotPreset struct {
+   Title string
+   X string
+   Y []string
+   XLabel, YLabel string
+   LogX, LogY bool
+   InvertX bool
+}
+
+
+// link to a plot, as embedded in mesa.html
+type PlotLink struct {
+   Title string
+   URL string
+}
+
+
+// info on mesa.html: the run itself plus its plots
+type MESAPageData struct {
+   *mesa.MESAInfo
+   RunID string
+   Plots []PlotLink
+   Job *utils.Job
+   Launch *utils.ManagedRun
+   Photos []mesa.Photo
+   Message string
+}
+
+
+// plots done for each star history
+var starPlots = map[string]plotPreset{
+   "hr": {Title: "HR diagram", X: "log_Teff", Y: []string{"log_L"}, XLabel: "log Teff [K]", YLabel: "log L [Lsun]", InvertX: true},
+   "center": {Title: "center conditions", X: "log_center_Rho", Y: []string{"log_center_T"}, XLabel: "log center Rho [g/cm3]", YLabel: "log center T [K]"},
+   "mass": {Title: "mass", X: "star_age", Y: []string{"star_mass"}, XLabel: "age [yr]", YLabel: "mass [Msun]"},
+}
+
+// plots done for the binary history
+var binaryPlots = map[string]plotPreset{
+   "mass": {Title: "masses", X: "age", Y: []string{"star_1_mass", "star_2_mass"}, XLabel: "age [yr]", YLabel: "mass [Msun]"},
+   "period": {Title: "orbital period", X: "age", Y: []string{"period_days"}, XLabel: "age [yr]", YLabel: "period [days]"},
+   "rlof": {Title: "Roche lobe overflow", X: "age", Y: []string{"rl_relative_overflow_1", "rl_relative_overflow_2"}, XLabel: "age [yr]", YLabel: "(R - RL) / RL"},
+}
+
+// max number of points drawn per series, long histories are downsampled to it
+const maxPlotPoints = 4000
+
+// order in which plots appear in mesa.html
+var starPlotOrder = []string{"hr", "center", "mass"}
+var binaryPlotOrder = []string{"mass", "period", "rlof"}
+
+
+// history filename of a source (star1, star2 or binary) of a run
+func historyFilename (mesaInfo *mesa.MESAInfo, source string) string {
+
+   switch source {
+   case "star1":
+      return mesaInfo.Star1Filename
+   case "star2":
+      return mesaInfo.Star2Filename
+   case "binary":
+      return mesaInfo.BinaryFilename
+   }
+
+   return ""
+
+}
+
+
+// preset plots available for a source
+func plotPresets (source string) map[string]plotPreset {
+
+   if source == "binary" {
+      return binaryPlots
+   }
+
+   return starPlots
+
+}
+
+
+// links to all the preset plots of a run
+func runPlotLinks (mesaInfo *mesa.MESAInfo) []PlotLink {
+
+   var links []PlotLink
+
+   for _, source := range []string{"star1", "star2", "binary"} {
+      if historyFilename(mesaInfo, source) == "" {
+         continue
+      }
+      order := starPlotOrder
+      if source == "binary" {
+         order = binaryPlotOrder
+      }
+      for _, name := range order {
+         links = append(links, PlotLink{
+            Title: source + ": " + plotPresets(source)[name].Title,
+            URL: "/plots/" + source + "/" + name + runQuery(mesaInfo),
+         })
+      }
+   }
+
+   return links
+
+}
+
+
+// load history columns of a preset into a plot
+func buildPlot (filename string, preset plotPreset) (*plot.Plot, error) {
+
+   columns := append([]string{preset.X}, preset.Y...)
+   data, err := readHistoryColumns(filename, columns...)
+   if err != nil {
+      return nil, err
+   }
+
+   p := &plot.Plot{
+      Title: preset.Title,
+      XLabel: preset.XLabel,
+      YLabel: preset.YLabel,
+      LogX: preset.LogX,
+      LogY: preset.LogY,
+      InvertX: preset.InvertX,
+   }
+   for _, y := range preset.Y {
+      index := plot.Downsample(data[preset.X], data[y], p.LogX, p.LogY, maxPlotPoints)
+      p.Series = append(p.Series, plot.Series{
+         Label: y,
+         X: plot.Pick(data[preset.X], index),
+         Y: plot.Pick(data[y], index),
+      })
+   }
+
+   return p, nil
+
+}
+
+
+// plot of a history as SVG: GET /plots/:source/:name?run=<id>
+// name is one of the presets, or custom with query parameters x, y (comma separated), logx & logy
+func PlotSVG (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   timer := time.Now()
+
+   source := params.ByName("source")
+   name := params.ByName("name")
+
+   filename := historyFilename(runFilesFromRequest(request), source)
+   if filename == "" {
+      http.Error(writer, "no history found for " + source, http.StatusNotFound)
+      return
+   }
+
+   var preset plotPreset
+   if name == "custom" {
+      query := request.URL.Query()
+      preset = plotPreset{
+         X: query.Get("x"),
+         Y: queryList(request, "y"),
+         LogX: query.Get("logx") != "",
+         LogY: query.Get("logy") != "",
+      }
+      preset.XLabel = preset.X
+      if len(preset.Y) == 1 {
+         preset.YLabel = preset.Y[0]
+      }
+      if preset.X == "" || len(preset.Y) == 0 {
+         http.Error(writer, "both x and y columns are needed", http.StatusBadRequest)
+         return
+      }
+   } else {
+      var ok bool
+      preset, ok = plotPresets(source)[name]
+      if !ok {
+         http.Error(writer, "unknown plot " + name, http.StatusNotFound)
+         return
+      }
+   }
+
+   p, err := buildPlot(filename, preset)
+   if err != nil {
+      status := http.StatusInternalServerError
+      if errors.Is(err, mesa.ErrUnknownColumn) {
+         status = http.StatusBadRequest
+      }
+      http.Error(writer, err.Error(), status)
+      return
+   }
+
+   writer.Header().Set("Content-Type", "image/svg+xml")
+   if err := p.WriteSVG(writer); err != nil {
+      io.LogError("WEB - plots.go - PlotSVG", "problem writing plot: " + err.Error())
+      return
+   }
+   io.LogInfo("WEB - plots.go - PlotSVG", "plot sent in "+time.Since(timer).String())
+
+}
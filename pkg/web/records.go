@@ -0,0 +1,236 @@
+package web
+
+import (
+   "fmt"
+   "net/http"
+   "os"
+   "strconv"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/store"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// record every known run in the database, every runsDiscoveryTTL
+func recordRuns () {
+
+   for {
+      timer := time.Now()
+      runs := listRuns()
+      recordPass(runs, timer)
+      io.LogDebug("WEB - records.go - recordRuns", fmt.Sprintf("%d runs recorded in %s", len(runs), time.Since(timer)))
+      time.Sleep(runsDiscoveryTTL)
+   }
+
+}
+
+
+// record the runs known at a time. runs recorded as running that are not known anymore (e.g. their
+// directory is not under a root and their process is gone) are marked as ended
+func recordPass (runs []Run, at time.Time) {
+
+   seen := make(map[string]bool, len(runs))
+   for _, run := range runs {
+      seen[run.ID] = true
+      if err := recordRun(run, at); err != nil {
+         io.LogError("WEB - records.go - recordPass", "problem recording run " + run.RootDir + ": " + err.Error())
+      }
+   }
+
+   running := true
+   records, _, err := runStore.QueryRuns(store.RunQuery{Running: &running})
+   if err != nil {
+      io.LogError("WEB - records.go - recordPass", "problem querying running runs: " + err.Error())
+      return
+   }
+   for k := range records {
+      r := &records[k]
+      if seen[r.ID] {
+         continue
+      }
+      r.Seen(at, 0)
+      if err := runStore.SaveRun(r); err != nil {
+         io.LogError("WEB - records.go - recordPass", "problem ending run " + r.RootDir + ": " + err.Error())
+      }
+   }
+
+}
+
+
+// update the record of a run seen at a time. histories are only checked for changes first: when
+// they did not change and the run did not start or stop, the record kept is still right and is
+// only marked as seen. otherwise status & outcome are found again, and final info & events are
+// loaded again if histories changed
+func recordRun (run Run, at time.Time) error {
+
+   r, err := runStore.Run(run.ID)
+   if err != nil {
+      return err
+   }
+
+   mesaInfo := &mesa.MESAInfo{ProcId: run.ProcId, RootDir: run.RootDir}
+   _ = mesaInfo.LoadMESAData()
+
+   var modTime time.Time
+   for _, path := range []string{mesaInfo.BinaryFilename, mesaInfo.Star1Filename, mesaInfo.Star2Filename} {
+      if info, err := os.Stat(path); path != "" && err == nil && info.ModTime().After(modTime) {
+         modTime = info.ModTime()
+      }
+   }
+   unchanged := r != nil && r.Star1 != nil && !modTime.After(r.HistoryModTime) && r.Running == run.Running
+
+   if r == nil {
+      r = &store.RunRecord{ID: run.ID}
+   }
+   r.RootDir = run.RootDir
+
+   pid := 0
+   if run.Running {
+      pid = run.ProcId
+   }
+   r.Seen(at, pid)
+
+   if unchanged {
+      return runStore.SaveRun(r)
+   }
+
+   row := gridRow(run)
+   r.Status = row.Status
+   r.Outcome = row.Outcome
+   r.IsBinary = row.IsBinary
+   r.InitialDonorMass = row.InitialDonorMass
+   r.InitialAccretorMass = row.InitialAccretorMass
+   r.InitialPeriod = row.InitialPeriod
+
+   if !modTime.IsZero() && (r.Star1 == nil || modTime.After(r.HistoryModTime)) {
+      loadMESAInfo(mesaInfo)
+      r.HistoryModTime = modTime
+      r.Star1 = mesaInfo.Star1Info
+      r.Star2 = nil
+      r.Binary = nil
+      r.Events = nil
+      if mesaInfo.IsBinaryEvolution {
+         r.Star2 = mesaInfo.Star2Info
+         r.Binary = mesaInfo.BinaryInfo
+      }
+      if mesaInfo.Timeline != nil {
+         r.Events = mesaInfo.Timeline.Events
+      }
+   }
+
+   return runStore.SaveRun(r)
+
+}
+
+
+// time in a query parameter, as RFC 3339 or a plain date
+func queryTime (raw string) (time.Time, error) {
+
+   if t, err := time.Parse(time.RFC3339, raw); err == nil {
+      return t, nil
+   }
+
+   return time.Parse("2006-01-02", raw)
+
+}
+
+
+// filters of records from query parameters: dir, outcome, status, running, binary, since, until,
+// limit & offset
+func recordsQuery (request *http.Request) (store.RunQuery, error) {
+
+   query := request.URL.Query()
+   q := store.RunQuery{
+      Dir: query.Get("dir"),
+      Outcome: query.Get("outcome"),
+      Status: query.Get("status"),
+   }
+
+   for name, target := range map[string]**bool{"running": &q.Running, "binary": &q.Binary} {
+      if raw := query.Get(name); raw != "" {
+         v, err := strconv.ParseBool(raw)
+         if err != nil {
+            return q, fmt.Errorf("bad %s %q", name, raw)
+         }
+         *target = &v
+      }
+   }
+
+   for name, target := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+      if raw := query.Get(name); raw != "" {
+         t, err := queryTime(raw)
+         if err != nil {
+            return q, fmt.Errorf("bad %s %q, use RFC 3339 or YYYY-MM-DD", name, raw)
+         }
+         *target = t
+      }
+   }
+
+   for name, target := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+      if raw := query.Get(name); raw != "" {
+         n, err := strconv.Atoi(raw)
+         if err != nil || n < 0 {
+            return q, fmt.Errorf("bad %s %q", name, raw)
+         }
+         *target = n
+      }
+   }
+
+   return q, nil
+
+}
+
+
+// records of runs ever seen by the service, last seen first: GET /api/records
+func RecordsAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   if runStore == nil {
+      writeJSON(writer, http.StatusServiceUnavailable, map[string]string{"error": "no database of runs"})
+      return
+   }
+
+   q, err := recordsQuery(request)
+   if err != nil {
+      writeJSONError(writer, http.StatusBadRequest, err)
+      return
+   }
+
+   records, total, err := runStore.QueryRuns(q)
+   if err != nil {
+      writeJSONError(writer, http.StatusInternalServerError, err)
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, struct {
+      Total int
+      Records []store.RunRecord
+   }{total, records})
+
+}
+
+
+// record of a run: GET /api/records/:id
+func RecordAPI (writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+   if runStore == nil {
+      writeJSON(writer, http.StatusServiceUnavailable, map[string]string{"error": "no database of runs"})
+      return
+   }
+
+   r, err := runStore.Run(params.ByName("id"))
+   if err != nil {
+      writeJSONError(writer, http.StatusInternalServerError, err)
+      return
+   }
+   if r == nil {
+      writeJSON(writer, http.StatusNotFound, map[string]string{"error": "no record of run " + params.ByName("id")})
+      return
+   }
+
+   writeJSON(writer, http.StatusOK, r)
+
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+   "os"
+   "path/filepath"
+   "testing"
+   "time"
+
+   "web-service/pkg/store"
+)
+
+
+// a run is only looked at again when its histories change or it starts or stops running. gridRow
+// caches every run it looks at, which tells whether it was called
+func TestRecordRun (t *testing.T) {
+
+   s, err := store.Open(filepath.Join(t.TempDir(), "service.db"))
+   if err != nil {
+      t.Fatal(err)
+   }
+   defer s.Close()
+   saved := runStore
+   runStore = s
+   defer func() { runStore = saved }()
+
+   root := t.TempDir() + "/"
+   history := filepath.Join(root, "LOGS", "history.data")
+   if err := os.MkdirAll(filepath.Dir(history), 0755); err != nil {
+      t.Fatal(err)
+   }
+   content := "1 2\nversion_number initial_mass\n\"r24.03.1\" 10\n\n1 2 3\nmodel_number star_age star_mass\n1 0 10\n2 1e5 9.9\n"
+   if err := os.WriteFile(history, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+   }
+
+   run := Run{ID: runID(root), RootDir: root}
+   looked := func() bool {
+      gridSync.Lock()
+      defer gridSync.Unlock()
+      _, ok := gridCache[root]
+      delete(gridCache, root)
+      return ok
+   }
+   record := func(at time.Time) *store.RunRecord {
+      t.Helper()
+      if err := recordRun(run, at); err != nil {
+         t.Fatal(err)
+      }
+      r, err := s.Run(run.ID)
+      if err != nil || r == nil {
+         t.Fatalf("got record %+v, %v", r, err)
+      }
+      return r
+   }
+
+   start := time.Now()
+   r := record(start)
+   if !looked() || r.Star1 == nil || r.HistoryModTime.IsZero() || r.Status == "" {
+      t.Fatalf("new run not looked at: %+v", r)
+   }
+   status := r.Status
+
+   r = record(start.Add(time.Minute))
+   if looked() {
+      t.Error("run looked at again with nothing changed")
+   }
+   if !r.LastSeen.Equal(start.Add(time.Minute)) || r.Status != status || r.Star1 == nil {
+      t.Errorf("record not kept: %+v", r)
+   }
+
+   // started running
+   run.Running, run.ProcId = true, os.Getpid()
+   r = record(start.Add(2 * time.Minute))
+   if !looked() || r.Status != gridRunning || !r.Running {
+      t.Errorf("run not looked at again once running: status %q", r.Status)
+   }
+
+   // dropped out of the list of runs while running, e.g. its directory was moved
+   end := start.Add(150 * time.Second)
+   recordPass(nil, end)
+   if r, err := s.Run(run.ID); err != nil || r == nil || r.Running || !r.EndedAt.Equal(end) {
+      t.Errorf("run not ended once missing: %+v, %v", r, err)
+   }
+   r = record(start.Add(160 * time.Second))
+   if !r.Running || !r.EndedAt.IsZero() {
+      t.Errorf("run not running again once back: %+v", r)
+   }
+   looked()
+
+   // history written
+   later := time.Now().Add(time.Hour)
+   if err := os.Chtimes(history, later, later); err != nil {
+      t.Fatal(err)
+   }
+   r = record(start.Add(3 * time.Minute))
+   if !looked() || !r.HistoryModTime.Equal(later) {
+      t.Errorf("run not looked at again once its history changed: %v", r.HistoryModTime)
+   }
+
+}
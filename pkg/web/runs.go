@@ -0,0 +1,394 @@
+package web
+
+import (
+   "crypto/sha1"
+   "encoding/hex"
+   "html/template"
+   "net/http"
+   "os"
+   "path/filepath"
+   "sort"
+   "strings"
+   "sync"
+   "time"
+
+   "web-service/pkg/io"
+   "web-service/pkg/mesa"
+   "web-service/pkg/store"
+   "web-service/pkg/utils"
+
+   "github.com/julienschmidt/httprouter"
+)
+
+
+// how long discovered runs are kept before walking root directories again
+const runsDiscoveryTTL = time.Minute
+
+
+// a MESA run known by the service, either running or found in a root directory
+type Run struct {
+   ID string
+   RootDir string
+   ProcId int
+   Running bool
+   Process *utils.ProcessDetail
+   Job *utils.Job
+   Launch *utils.ManagedRun
+   Annotation *store.Annotation
+}
+
+
+// registry of discovered runs, refreshed every runsDiscoveryTTL
+var (
+   runsSync sync.Mutex
+   discoveredRuns []string
+   discoveredAt time.Time
+)
+
+
+// ID of a run, derived from its root directory so that it is stable across restarts
+func runID (rootDir string) string {
+
+   sum := sha1.Sum([]byte(strings.TrimSuffix(rootDir, "/") + "/"))
+
+   return hex.EncodeToString(sum[:])[:12]
+
+}
+
+
+// root directories with MESA runs, from env variable MESA_RUNS_ROOTS (list separated by ':')
+func runsRoots () []string {
+
+   var roots []string
+   for _, root := range filepath.SplitList(os.Getenv("MESA_RUNS_ROOTS")) {
+      if root = strings.TrimSpace(root); root != "" {
+         roots = append(roots, root)
+      }
+   }
+
+   return roots
+
+}
+
+
+// directories of runs found in root directories, walking them again once the cache is too old
+func discoverRuns () []string {
+
+   runsSync.Lock()
+   defer runsSync.Unlock()
+
+   if discoveredRuns != nil && time.Since(discoveredAt) < runsDiscoveryTTL {
+      return discoveredRuns
+   }
+
+   runs, err := mesa.DiscoverRuns(runsRoots())
+   if err != nil {
+      io.LogError("WEB - runs.go - discoverRuns", "problem discovering MESA runs: " + err.Error())
+   }
+   if runs == nil {
+      runs = []string{}
+   }
+   discoveredRuns = runs
+   discoveredAt = time.Now()
+
+   return discoveredRuns
+
+}
+
+
+// all runs known: the one running (if any) plus all runs found in root directories
+func listRuns () []Run {
+
+   runs := knownRuns()
+
+   // batch jobs running (or that did run) each of them, the last launch from the service and what
+   // users noted about them
+   annotations := runAnnotations()
+   for k := range runs {
+      runs[k].Job = batchScheduler().JobFor(runs[k].RootDir, runs[k].ProcId)
+      runs[k].Launch = runLauncher().LastIn(runs[k].RootDir)
+      runs[k].Annotation = annotations[runs[k].ID]
+   }
+
+   sort.SliceStable(runs, func(i, j int) bool {
+      if runs[i].Running != runs[j].Running {
+         return runs[i].Running
+      }
+      return runs[i].RootDir < runs[j].RootDir
+   })
+
+   return runs
+
+}
+
+
+// runs running plus runs found in root directories, without their jobs, launches or annotations
+func knownRuns () []Run {
+
+   var runs []Run
+   seen := make(map[string]bool)
+
+   for _, live := range findLiveRuns() {
+      if seen[live.ID] {
+         continue
+      }
+      runs = append(runs, live)
+      seen[live.ID] = true
+   }
+
+   for _, dir := range discoverRuns() {
+      id := runID(dir)
+      if seen[id] {
+         continue
+      }
+      seen[id] = true
+      runs = append(runs, Run{ID: id, RootDir: dir})
+   }
+
+   return runs
+
+}
+
+
+// how MESA processes are found, set from MESA_PROCESS_BACKEND on first use
+var (
+   processFinderOnce sync.Once
+   processFinder utils.ProcessFinder
+)
+
+
+// batch scheduler running jobs in this computer, set from MESA_SCHEDULER on first use
+var (
+   schedulerOnce sync.Once
+   scheduler *utils.Scheduler
+)
+
+
+func batchScheduler () *utils.Scheduler {
+
+   schedulerOnce.Do(func() {
+      scheduler = utils.NewScheduler()
+      io.LogInfo("WEB - runs.go - batchScheduler", "batch scheduler: " + scheduler.Kind)
+   })
+
+   return scheduler
+
+}
+
+
+// backend finding MESA processes. pidfiles are searched for in the run directories discovered
+func mesaProcessFinder () utils.ProcessFinder {
+
+   processFinderOnce.Do(func() {
+      // already set, e.g. to a fake backend
+      if processFinder != nil {
+         return
+      }
+      var err error
+      processFinder, err = utils.NewProcessFinder(discoverRuns)
+      if err != nil {
+         io.LogError("WEB - runs.go - mesaProcessFinder", "problem setting process discovery, using procfs: " + err.Error())
+         processFinder = &utils.ProcfsFinder{Scanner: utils.DefaultProcessScanner()}
+      }
+      io.LogInfo("WEB - runs.go - mesaProcessFinder", "finding MESA processes with backend " + processFinder.Name())
+   })
+
+   return processFinder
+
+}
+
+
+// runs of the MESA processes running in this computer
+func findLiveRuns () []Run {
+
+   procs, err := mesaProcessFinder().FindProcesses()
+   if err != nil {
+      io.LogError("WEB - runs.go - findLiveRuns", "problem finding MESA processes: " + err.Error())
+   }
+
+   var runs []Run
+   for _, proc := range procs {
+      if proc.Loc == "" {
+         continue
+      }
+      runs = append(runs, Run{ID: runID(proc.Loc), RootDir: proc.Loc, ProcId: proc.Id, Running: true, Process: proc.Detail})
+   }
+
+   return runs
+
+}
+
+
+// run of the MESA process running in this computer, nil if there is none. with several of them, the
+// one started first
+func findLiveRun () *Run {
+
+   runs := findLiveRuns()
+   if len(runs) == 0 {
+      return nil
+   }
+
+   return &runs[0]
+
+}
+
+
+// run with a given ID, nil if unknown
+func findRun (id string) *Run {
+
+   for _, run := range listRuns() {
+      if run.ID == id {
+         return &run
+      }
+   }
+
+   return nil
+
+}
+
+
+// load all info of a run
+func loadRun (run *Run) *mesa.MESAInfo {
+
+   mesaInfo := new(mesa.MESAInfo)
+   mesaInfo.ProcId = run.ProcId
+   mesaInfo.RootDir = run.RootDir
+
+   loadMESAInfo(mesaInfo)
+
+   return mesaInfo
+
+}
+
+
+// run asked for in the "run" query parameter, or the one running in this computer if none. an
+// unknown run gets ProcId = -94 so that pages can warn about it
+func runFromRequest (request *http.Request) *mesa.MESAInfo {
+
+   id := request.URL.Query().Get("run")
+   if id == "" {
+      return currentMESARun()
+   }
+
+   run := findRun(id)
+   if run == nil {
+      return &mesa.MESAInfo{ProcId: -94}
+   }
+
+   return loadRun(run)
+
+}
+
+
+// run asked for in the "run" query parameter, or the one running in this computer if none, with
+// only the names of its histories. enough to read them, without loading summaries or timeline.
+// ProcId is -99 with no run running & -94 for an unknown run, as in runFromRequest
+func runFilesFromRequest (request *http.Request) *mesa.MESAInfo {
+
+   var run *Run
+   if id := request.URL.Query().Get("run"); id != "" {
+      for _, known := range knownRuns() {
+         if known.ID == id {
+            run = &known
+            break
+         }
+      }
+      if run == nil {
+         return &mesa.MESAInfo{ProcId: -94}
+      }
+   } else {
+      run = findLiveRun()
+      if run == nil {
+         return &mesa.MESAInfo{ProcId: -99}
+      }
+   }
+
+   mesaInfo := &mesa.MESAInfo{ProcId: run.ProcId, RootDir: run.RootDir, Thresholds: thresholds}
+   if err := mesaInfo.LoadMESAData(); err != nil {
+      io.LogError("WEB - runs.go - runFilesFromRequest", "problem loading MESA data: " + err.Error())
+      mesaInfo.ProcId = -98
+   }
+
+   return mesaInfo
+
+}
+
+
+// query string selecting a run in links, empty for runs without root directory
+func runQuery (mesaInfo *mesa.MESAInfo) string {
+
+   if mesaInfo.RootDir == "" {
+      return ""
+   }
+
+   return "?run=" + runID(mesaInfo.RootDir)
+
+}
+
+
+// list of known runs: GET /api/runs, filtered with query parameters tag, owner, starred & q
+func RunsAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   writeJSON(writer, http.StatusOK, filterRuns(listRuns(), request.URL.Query()))
+
+}
+
+
+// jobs of the batch scheduler, active ones first: GET /api/jobs
+func JobsAPI (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   jobs, err := batchScheduler().Jobs()
+   if err != nil {
+      writeJSONError(writer, http.StatusBadGateway, err)
+      return
+   }
+   if jobs == nil {
+      jobs = []utils.Job{}
+   }
+
+   writeJSON(writer, http.StatusOK, jobs)
+
+}
+
+
+// runs.html serving func
+func RunsHTML (writer http.ResponseWriter, request *http.Request, _ httprouter.Params) {
+
+   // start counting time until serve files
+   timer := time.Now()
+
+   query := request.URL.Query()
+
+   var tags []string
+   if runStore != nil {
+      var err error
+      if tags, err = runStore.Tags(); err != nil {
+         io.LogError("WEB - runs.go - RunsHTML", "problem reading tags: " + err.Error())
+      }
+   }
+
+   data := struct {
+      Roots []string
+      Runs []Run
+      Message string
+      HasStore bool
+      Tags []string
+      Tag, Owner, Query string
+      Starred bool
+   }{
+      Roots: runsRoots(),
+      Runs: filterRuns(listRuns(), query),
+      Message: query.Get("msg"),
+      HasStore: runStore != nil,
+      Tags: tags,
+      Tag: query.Get("tag"),
+      Owner: query.Get("owner"),
+      Query: query.Get("q"),
+      Starred: query.Get("starred") != "",
+   }
+
+   tmpl := template.Must(template.ParseFiles("web/html/runs.html"))
+   _ = tmpl.Execute(writer, data)
+   io.LogInfo("WEB - runs.go - RunsHTML", "page sent in "+time.Since(timer).String())
+
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+   "errors"
+   "testing"
+
+   "web-service/pkg/utils"
+)
+
+
+// live runs are those of the processes found by the backend set, even when it also fails
+func TestFindLiveRuns (t *testing.T) {
+
+   detail := &utils.ProcessDetail{Pid: 100, Name: "star", Cwd: "/work/run1"}
+   saved := processFinder
+   processFinder = &utils.FakeFinder{
+      Processes: []utils.MESAprocess{
+         {ExecName: "star", Id: 100, Loc: "/work/run1/", Detail: detail},
+         {ExecName: "binary", Id: 200},
+         {ExecName: "binary", Id: 300, Loc: "/work/run2/"},
+      },
+      Err: errors.New("cannot list every process"),
+   }
+   defer func() { processFinder = saved }()
+
+   if mesaProcessFinder().Name() != "fake" {
+      t.Fatalf("backend %q replaced the one set", mesaProcessFinder().Name())
+   }
+
+   runs := findLiveRuns()
+   if len(runs) != 2 {
+      t.Fatalf("got %d runs, want the 2 processes with a run directory", len(runs))
+   }
+   if runs[0].RootDir != "/work/run1/" || runs[0].ProcId != 100 || !runs[0].Running || runs[0].Process != detail {
+      t.Errorf("got first run %+v", runs[0])
+   }
+   if runs[0].ID != runID("/work/run1") || runs[1].ID != runID("/work/run2/") {
+      t.Errorf("got IDs %s & %s", runs[0].ID, runs[1].ID)
+   }
+
+   if run := findLiveRun(); run == nil || run.ProcId != 100 {
+      t.Errorf("got live run %+v, want the first one found", run)
+   }
+
+   processFinder = &utils.FakeFinder{}
+   if run := findLiveRun(); run != nil {
+      t.Errorf("got live run %+v without processes", run)
+   }
+
+}
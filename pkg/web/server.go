@@ -61,6 +61,18 @@ func (p Program) run() {
 
    io.LogDebug("WEB - server.go - run", "serving web files")
 
+   // thresholds of stage & MT classification, when changed in a config file
+   initThresholds()
+
+   // parsed histories are kept in a cache, when asked for
+   initHistoryCache()
+
+   // notes & tags of runs, and a record of every run seen, are kept in a database
+   initStore()
+   if runStore != nil {
+      go recordRuns()
+   }
+
    router := httprouter.New()
    router.ServeFiles("/html/*filepath", http.Dir("web/html"))
    router.ServeFiles("/css/*filepath", http.Dir("web/css"))
@@ -71,6 +83,40 @@ func (p Program) run() {
    router.GET("/index", BasicAuth(Index))
    router.GET("/dashboard", BasicAuth(Dashboard))
    router.GET("/mesa", BasicAuth(MESAhtml))
+   router.GET("/runs", BasicAuth(RunsHTML))
+   router.POST("/runs/:id/control", BasicAuth(RunControlHTML))
+   router.POST("/runs/:id/launch", BasicAuth(RunLaunchHTML))
+   router.POST("/runs/:id/annotation", BasicAuth(AnnotationHTML))
+   router.POST("/runs/:id/star", BasicAuth(StarHTML))
+   router.GET("/grid", BasicAuth(GridHTML))
+   router.GET("/grid/map.svg", BasicAuth(GridMapSVG))
+   router.GET("/inlists/diff", BasicAuth(InlistDiffHTML))
+   router.GET("/compare", BasicAuth(CompareHTML))
+   router.GET("/compare/plot.svg", BasicAuth(ComparePlotSVG))
+   router.GET("/mesa/profiles/:star", BasicAuth(ProfileHTML))
+   router.GET("/plots/:source/:name", BasicAuth(PlotSVG))
+
+   router.GET("/api/runs", BasicAuth(RunsAPI))
+   router.GET("/api/jobs", BasicAuth(JobsAPI))
+   router.POST("/api/runs/:id/control", BasicAuth(RunControlAPI))
+   router.POST("/api/runs/:id/launch", BasicAuth(RunLaunchAPI))
+   router.GET("/api/runs/:id/photos", BasicAuth(PhotosAPI))
+   router.GET("/api/runs/:id/inlist", BasicAuth(InlistAPI))
+   router.GET("/api/runs/:id/annotation", BasicAuth(AnnotationAPI))
+   router.PUT("/api/runs/:id/annotation", BasicAuth(AnnotationUpdateAPI))
+   router.GET("/api/records", BasicAuth(RecordsAPI))
+   router.GET("/api/records/:id", BasicAuth(RecordAPI))
+   router.GET("/api/inlists/diff", BasicAuth(InlistDiffAPI))
+   router.GET("/api/compare", BasicAuth(CompareAPI))
+   router.GET("/api/launches", BasicAuth(LaunchesAPI))
+   router.POST("/api/launches/:n/cancel", BasicAuth(LaunchCancelAPI))
+   router.GET("/api/grid", BasicAuth(GridAPI))
+   router.GET("/api/profiles/:star", BasicAuth(ProfilesAPI))
+   router.GET("/api/profiles/:star/:number", BasicAuth(ProfileAPI))
+   router.GET("/api/series/:source", BasicAuth(SeriesAPI))
+   router.GET("/api/export/:source", BasicAuth(ExportAPI))
+   router.GET("/api/timeline", BasicAuth(TimelineAPI))
+   router.GET("/api/bin2dco", BasicAuth(Bin2dcoAPI))
 
    // get port number from env variables
    port := os.Getenv("PORT")